@@ -0,0 +1,90 @@
+package grf
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"time"
+)
+
+// APIKey is an API key stored in the api_keys collection, see APIKeyAuthenticator.
+// Only a hash of the key is stored, the key itself is handed out once by CreateAPIKey.
+type APIKey struct {
+	_ struct{} `grf:"collection=api_keys"`
+	// The SHA-256 hash of the key, hex encoded.
+	ID string `json:"id" bson:"_id" grf:"id=string"`
+	// The ID of the principal the key acts for.
+	Principal string     `json:"principal" bson:"principal"`
+	Tenant    string     `json:"tenant" bson:"tenant"`
+	Roles     []string   `json:"roles" bson:"roles"`
+	Name      string     `json:"name" bson:"name"`
+	CreatedAt time.Time  `json:"createdAt" bson:"createdAt" grf:"createdAt"`
+	ExpiresAt *time.Time `json:"expiresAt" bson:"expiresAt"`
+}
+
+// APIKeyAuthenticator authenticates requests with an API key in a header, checked against the api_keys collection
+// of the app context. The principal is the one the key was created for, the id of the key is its "apiKey" claim.
+type APIKeyAuthenticator struct {
+	// The header with the key. Defaults to X-API-Key.
+	Header string
+}
+
+func (a APIKeyAuthenticator) Authenticate(ctx *Ctx, r *http.Request) (*Principal, error) {
+	header := a.Header
+	if header == "" {
+		header = "X-API-Key"
+	}
+	key := r.Header.Get(header)
+	if key == "" {
+		return nil, nil
+	}
+	var apiKey APIKey
+	if err := ReadOne(r.Context(), ctx, &apiKey, hashSecret(key)); err != nil {
+		if errors.Is(err, ErrNotFound) || errors.Is(err, ErrInvalidID) {
+			return nil, newError(ErrUnauthorized, "invalid API key", nil)
+		}
+		return nil, err
+	}
+	if apiKey.ExpiresAt != nil && time.Now().After(*apiKey.ExpiresAt) {
+		return nil, newError(ErrUnauthorized, "the API key expired", nil)
+	}
+	return &Principal{ID: apiKey.Principal, Tenant: apiKey.Tenant, Roles: apiKey.Roles, Claims: map[string]any{"apiKey": apiKey.ID}}, nil
+}
+
+// Stores a new API key with the principal, tenant, roles, name and expiry of apiKey and returns the key.
+// The key can't be recovered later, only its hash is stored. apiKey gets the id of the stored key.
+func CreateAPIKey(ctx context.Context, appCtx *Ctx, apiKey *APIKey) (string, error) {
+	key, err := newSecret()
+	if err != nil {
+		return "", err
+	}
+	apiKey.ID = hashSecret(key)
+	if err := Create(ctx, appCtx, apiKey); err != nil {
+		return "", err
+	}
+	return key, nil
+}
+
+// Deletes the API key with the id, requests with it are refused from then on.
+func RevokeAPIKey(ctx context.Context, appCtx *Ctx, id string) error {
+	return Delete[APIKey](ctx, appCtx, id)
+}
+
+// Returns a random secret for API keys and sessions.
+func newSecret() (string, error) {
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(secret), nil
+}
+
+// Returns the hash secrets are stored under.
+func hashSecret(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
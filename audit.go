@@ -0,0 +1,175 @@
+package grf
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"time"
+)
+
+// Audit fields are filled in by the services, tag them with the name of what they hold:
+//
+//	CreatedAt time.Time `json:"createdAt" bson:"createdAt" grf:"createdAt"`
+//	UpdatedAt time.Time `json:"updatedAt" bson:"updatedAt" grf:"updatedAt"`
+//	CreatedBy string    `json:"createdBy" bson:"createdBy" grf:"createdBy"`
+//
+// createdAt and updatedAt are time.Time or *time.Time fields, set to the time of the change.
+// createdBy is a string or *string field, set to the ID of the Principal in the context of Create.
+// Create sets all of them, ReplaceOne keeps the stored createdAt and createdBy and UpdateOne only sets updatedAt.
+const (
+	AuditCreatedAt = "createdAt"
+	AuditUpdatedAt = "updatedAt"
+	AuditCreatedBy = "createdBy"
+)
+
+// Options of the fields grf fills in itself. Whatever clients send for them is ignored.
+var managedOptions = []string{AuditCreatedAt, AuditUpdatedAt, AuditCreatedBy, "softdelete", "version", ScopeTenant, ScopeOwner}
+
+// Returns the time audit fields are set to. Rounded to milliseconds, what every backend can store.
+func auditTime() time.Time {
+	return time.Now().UTC().Truncate(time.Millisecond)
+}
+
+// Reports whether the model has any createdAt or createdBy field, which are kept from the stored object on replace.
+func hasCreationFields(model *Model) bool {
+	return model.FieldWithOption(AuditCreatedAt) != nil || model.FieldWithOption(AuditCreatedBy) != nil
+}
+
+// Fills in the managed fields of a new object, replacing whatever the client sent.
+func auditCreate(ctx context.Context, object any) {
+	model := modelOf(reflect.TypeOf(object))
+	value := reflect.ValueOf(object).Elem()
+	now := auditTime()
+	for _, field := range model.Fields {
+		target := value.FieldByIndex(field.Index)
+		switch {
+		case field.Options.Has(AuditCreatedAt), field.Options.Has(AuditUpdatedAt):
+			setFieldValue(target, now)
+		case field.Options.Has(AuditCreatedBy):
+			target.SetZero()
+			if principal := PrincipalFrom(ctx); principal != nil {
+				setFieldValue(target, principal.ID)
+			}
+		case field.Options.Has("softdelete"):
+			target.SetZero()
+		case field.Options.Has("version"):
+			setVersion(field, object, 1)
+		}
+	}
+}
+
+// Fills in the managed fields of a replacement. The creation fields are taken from the stored object.
+func auditReplace(object, stored any) {
+	model := modelOf(reflect.TypeOf(object))
+	value, storedValue := reflect.ValueOf(object).Elem(), reflect.ValueOf(stored).Elem()
+	for _, field := range model.Fields {
+		target := value.FieldByIndex(field.Index)
+		switch {
+		case field.Options.Has(AuditCreatedAt), field.Options.Has(AuditCreatedBy):
+			target.Set(storedValue.FieldByIndex(field.Index))
+		case field.Options.Has(AuditUpdatedAt):
+			setFieldValue(target, auditTime())
+		case field.Options.Has("softdelete"):
+			target.SetZero()
+		case field.Options.Has("version"):
+			setVersion(field, object, versionOf(field, stored)+1)
+		}
+	}
+}
+
+// Returns the patch without changes to managed fields, setting the updatedAt fields and incrementing the version instead.
+func auditPatch(model *Model, patch Patch) Patch {
+	var managed []string
+	for _, field := range model.Fields {
+		for _, option := range managedOptions {
+			if field.Options.Has(option) {
+				managed = append(managed, field.BSONName)
+				break
+			}
+		}
+	}
+	if len(managed) == 0 {
+		return patch
+	}
+	isManaged := func(path string) bool {
+		for _, name := range managed {
+			if path == name || strings.HasPrefix(path, name+".") {
+				return true
+			}
+		}
+		return false
+	}
+
+	audited := Patch{Set: map[string]any{}, Test: patch.Test}
+	for path, value := range patch.Set {
+		if !isManaged(path) {
+			audited.Set[path] = value
+		}
+	}
+	for _, path := range patch.Unset {
+		if !isManaged(path) {
+			audited.Unset = append(audited.Unset, path)
+		}
+	}
+	for path, values := range patch.Push {
+		if !isManaged(path) {
+			audited.Push = setEntry(audited.Push, path, values)
+		}
+	}
+	for path, values := range patch.Pull {
+		if !isManaged(path) {
+			audited.Pull = setEntry(audited.Pull, path, values)
+		}
+	}
+	for from, to := range patch.Rename {
+		if !isManaged(from) && !isManaged(to) {
+			audited.Rename = setEntry(audited.Rename, from, to)
+		}
+	}
+	for path, amount := range patch.Inc {
+		if !isManaged(path) {
+			audited.Inc = setEntry(audited.Inc, path, amount)
+		}
+	}
+
+	// Only patches that change something are touched, so empty patches are still refused.
+	if audited.IsEmpty() {
+		return audited
+	}
+	return touch(model, audited)
+}
+
+// Adds setting the updatedAt fields and incrementing the version to the patch.
+func touch(model *Model, patch Patch) Patch {
+	if field := model.FieldWithOption(AuditUpdatedAt); field != nil {
+		patch.Set = setEntry(patch.Set, field.BSONName, any(auditTime()))
+	}
+	if field := versionField(model); field != nil {
+		patch.Inc = setEntry(patch.Inc, field.BSONName, any(int64(1)))
+	}
+	return patch
+}
+
+// Sets the key of a map that may still be nil.
+func setEntry[V any](m map[string]V, key string, value V) map[string]V {
+	if m == nil {
+		m = map[string]V{}
+	}
+	m[key] = value
+	return m
+}
+
+// Sets a field to the value, allocating pointer fields. Values of other types than the field's are left out.
+func setFieldValue(target reflect.Value, v any) {
+	value := reflect.ValueOf(v)
+	if target.Kind() == reflect.Pointer {
+		if !value.Type().AssignableTo(target.Type().Elem()) {
+			return
+		}
+		target.Set(reflect.New(target.Type().Elem()))
+		target = target.Elem()
+	}
+	if value.Type().AssignableTo(target.Type()) {
+		target.Set(value)
+	}
+}
@@ -0,0 +1,113 @@
+package grf
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type Entry struct {
+	Id        primitive.ObjectID `json:"id,omitempty" bson:"_id,omitempty"`
+	Title     string             `json:"title" bson:"title"`
+	CreatedAt time.Time          `json:"createdAt" bson:"createdAt" grf:"createdAt"`
+	UpdatedAt *time.Time         `json:"updatedAt" bson:"updatedAt" grf:"updatedAt"`
+	CreatedBy string             `json:"createdBy" bson:"createdBy" grf:"createdBy"`
+}
+
+func TestAuditFields(t *testing.T) {
+	longAgo := time.Date(2000, 1, 1, 0, 0, 0, 0, time.UTC)
+	alice := ContextWithPrincipal(context.Background(), &Principal{ID: "alice"})
+	bob := ContextWithPrincipal(context.Background(), &Principal{ID: "bob"})
+
+	for name, appCtx := range backendContexts(t) {
+		t.Run(name, func(t *testing.T) {
+			before := auditTime()
+			entry := Entry{Title: "first", CreatedAt: longAgo, UpdatedAt: &longAgo, CreatedBy: "mallory"}
+			if err := Create(alice, appCtx, &entry); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if entry.CreatedAt.Before(before) || entry.UpdatedAt == nil || !entry.UpdatedAt.Equal(entry.CreatedAt) {
+				t.Errorf("create: got createdAt %v and updatedAt %v, want the time of creation", entry.CreatedAt, entry.UpdatedAt)
+			}
+			if entry.CreatedBy != "alice" {
+				t.Errorf("create: got createdBy %q, want alice", entry.CreatedBy)
+			}
+			created := entry.CreatedAt
+			id := entry.Id.Hex()
+
+			time.Sleep(2 * time.Millisecond)
+			replacement := Entry{Title: "second", CreatedAt: longAgo, CreatedBy: "mallory"}
+			if err := ReplaceOne(bob, appCtx, &replacement, id); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			var stored Entry
+			if err := ReadOne(context.Background(), appCtx, &stored, id); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !stored.CreatedAt.Equal(created) || stored.CreatedBy != "alice" {
+				t.Errorf("replace: got createdAt %v by %q, want %v by alice", stored.CreatedAt, stored.CreatedBy, created)
+			}
+			if stored.UpdatedAt == nil || !stored.UpdatedAt.After(created) {
+				t.Errorf("replace: got updatedAt %v, want after %v", stored.UpdatedAt, created)
+			}
+			replaced := *stored.UpdatedAt
+
+			time.Sleep(2 * time.Millisecond)
+			patch := Patch{Set: map[string]any{"title": "third", "createdBy": "mallory", "createdAt": longAgo}}
+			if err := UpdateOne(bob, appCtx, &stored, id, patch); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if stored.Title != "third" || !stored.CreatedAt.Equal(created) || stored.CreatedBy != "alice" {
+				t.Errorf("update: got %+v, want the title changed and the creation kept", stored)
+			}
+			if stored.UpdatedAt == nil || !stored.UpdatedAt.After(replaced) {
+				t.Errorf("update: got updatedAt %v, want after %v", stored.UpdatedAt, replaced)
+			}
+
+			err := UpdateOne(bob, appCtx, &stored, id, Patch{Set: map[string]any{"createdBy": "mallory"}})
+			if !errors.Is(err, ErrValidation) {
+				t.Errorf("update of managed fields only: got %v, want a validation error", err)
+			}
+		})
+	}
+}
+
+func TestAuditPatch(t *testing.T) {
+	var tests = []struct {
+		name  string
+		patch Patch
+		want  Patch
+	}{
+		{
+			"managed fields are dropped",
+			Patch{Set: map[string]any{"title": "a", "createdAt": "x"}, Unset: []string{"createdBy"}},
+			Patch{Set: map[string]any{"title": "a", "updatedAt": nil}},
+		},
+		{
+			"nested paths",
+			Patch{Set: map[string]any{"createdAt.day": 1}, Rename: map[string]string{"title": "createdBy"}},
+			Patch{Set: map[string]any{}},
+		},
+		{
+			"other operations",
+			Patch{Inc: map[string]any{"views": 1}, Push: map[string][]any{"createdBy": {"a"}}},
+			Patch{Set: map[string]any{"updatedAt": nil}, Inc: map[string]any{"views": 1}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := auditPatch(getModel[Entry](), tt.patch)
+			if _, ok := got.Set["updatedAt"]; ok {
+				// The time of the update is not known in advance.
+				got.Set["updatedAt"] = nil
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
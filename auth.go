@@ -0,0 +1,91 @@
+package grf
+
+import (
+	"log"
+	"net/http"
+	"strings"
+)
+
+// Authenticator finds out who a request is made by.
+// Authenticate returns nil without an error when the request carries no credentials it knows, so the next
+// authenticator of the app context gets a go. Credentials that are there but don't check out are an ErrUnauthorized.
+// JWTAuthenticator, APIKeyAuthenticator and SessionAuthenticator come with grf.
+type Authenticator interface {
+	Authenticate(ctx *Ctx, r *http.Request) (*Principal, error)
+}
+
+// Authenticators that tell clients how to authenticate in the WWW-Authenticate header of 401 responses.
+type challenger interface {
+	challenge() string
+}
+
+// Whether the routes of a resource need an authenticated principal.
+type authentication int
+
+const (
+	// Routes need a principal when the app context has authenticators.
+	authenticationDefault authentication = iota
+	authenticationPublic
+	authenticationRequired
+)
+
+// Lets anonymous requests through on the routes. Requests with credentials are still authenticated,
+// so the handlers and the services know the principal when there is one, and bad credentials are still refused.
+func Public() RouteOption {
+	return func(c *routeConfig) {
+		c.authentication = authenticationPublic
+	}
+}
+
+// Refuses anonymous requests on the routes with a 401. That is already the default for the routes of an app
+// context with authenticators, Authenticated keeps it so when they are left out.
+func Authenticated() RouteOption {
+	return func(c *routeConfig) {
+		c.authentication = authenticationRequired
+	}
+}
+
+// Resolves the principal of the request with the authenticators of the app context and adds it to the request context,
+// where PrincipalFrom finds it. Requests that already carry a principal are left alone.
+// Returns ErrUnauthorized when the route needs a principal and there is none.
+func authenticate(ctx *Ctx, r *http.Request) (*http.Request, error) {
+	principal := PrincipalFrom(r.Context())
+	for i := 0; principal == nil && i < len(ctx.Authenticators); i++ {
+		var err error
+		if principal, err = ctx.Authenticators[i].Authenticate(ctx, r); err != nil {
+			log.Println("Error authenticating", r.Method, r.URL.Path, err)
+			return r, err
+		}
+		if principal != nil {
+			r = r.WithContext(ContextWithPrincipal(r.Context(), principal))
+		}
+	}
+	if principal == nil && requiresAuthentication(ctx, r) {
+		return r, newError(ErrUnauthorized, "authentication required", nil)
+	}
+	return r, nil
+}
+
+// Reports whether the route of the request needs an authenticated principal.
+func requiresAuthentication(ctx *Ctx, r *http.Request) bool {
+	switch routeConfigOf(r).authentication {
+	case authenticationPublic:
+		return false
+	case authenticationRequired:
+		return true
+	}
+	return len(ctx.Authenticators) > 0
+}
+
+// Sets the WWW-Authenticate header of a 401 response to the schemes of the app context's authenticators.
+func setChallenges(ctx *Ctx, w http.ResponseWriter) {
+	var challenges []string
+	for _, authenticator := range ctx.Authenticators {
+		if c, ok := authenticator.(challenger); ok {
+			challenges = append(challenges, c.challenge())
+		}
+	}
+	if len(challenges) > 0 {
+		w.Header().Set("WWW-Authenticate", strings.Join(challenges, ", "))
+	}
+}
@@ -0,0 +1,125 @@
+package grf
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestAuthenticators(t *testing.T) {
+	secret := []byte("secret")
+	sessions := SessionAuthenticator{}
+	for name, appCtx := range backendContexts(t) {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			appCtx.Authenticators = []Authenticator{JWTAuthenticator{Key: secret}, APIKeyAuthenticator{}, sessions}
+			mux := http.NewServeMux()
+			memos := RegisterCRUDRoutes[Memo]("/memos", ServeMux(mux), appCtx)
+			memos.Handle(http.MethodGet, "/me", H{Ctx: appCtx, Fn: func(ctx *Ctx, w http.ResponseWriter, r *http.Request) {
+				w.Write([]byte(PrincipalFrom(r.Context()).ID))
+			}})
+			RegisterCRUDRoutes[Memo]("/public", ServeMux(mux), appCtx, Public())
+
+			token, _ := SignJWT(map[string]any{"sub": "ada", "exp": time.Now().Add(time.Hour).Unix()}, secret)
+			expired, _ := SignJWT(map[string]any{"sub": "ada", "exp": time.Now().Add(-time.Hour).Unix()}, secret)
+			forged, _ := SignJWT(map[string]any{"sub": "ada"}, []byte("guess"))
+			key, err := CreateAPIKey(ctx, appCtx, &APIKey{Principal: "grace", Name: "ci"})
+			if err != nil {
+				t.Fatal(err)
+			}
+			past := time.Now().Add(-time.Hour)
+			stale, _ := CreateAPIKey(ctx, appCtx, &APIKey{Principal: "grace", ExpiresAt: &past})
+			login := httptest.NewRecorder()
+			if err := sessions.Start(ctx, appCtx, login, &Principal{ID: "linus"}); err != nil {
+				t.Fatal(err)
+			}
+			cookie := login.Result().Cookies()[0]
+
+			var tests = []struct {
+				name   string
+				path   string
+				header string
+				value  string
+				status int
+				body   string
+			}{
+				{"anonymous", "/memos/me", "", "", http.StatusUnauthorized, ""},
+				{"anonymous public", "/public/", "", "", http.StatusOK, ""},
+				{"token", "/memos/me", "Authorization", "Bearer " + token, http.StatusOK, "ada"},
+				{"expired token", "/memos/me", "Authorization", "Bearer " + expired, http.StatusUnauthorized, ""},
+				{"forged token", "/memos/me", "Authorization", "Bearer " + forged, http.StatusUnauthorized, ""},
+				{"forged token public", "/public/", "Authorization", "Bearer " + forged, http.StatusUnauthorized, ""},
+				{"other scheme", "/memos/me", "Authorization", "Basic " + token, http.StatusUnauthorized, ""},
+				{"API key", "/memos/me", "X-API-Key", key, http.StatusOK, "grace"},
+				{"unknown API key", "/memos/me", "X-API-Key", "guess", http.StatusUnauthorized, ""},
+				{"expired API key", "/memos/me", "X-API-Key", stale, http.StatusUnauthorized, ""},
+				{"session", "/memos/me", "Cookie", cookie.Name + "=" + cookie.Value, http.StatusOK, "linus"},
+				{"unknown session", "/memos/me", "Cookie", cookie.Name + "=guess", http.StatusUnauthorized, ""},
+			}
+			for _, tt := range tests {
+				t.Run(tt.name, func(t *testing.T) {
+					req := httptest.NewRequest(http.MethodGet, tt.path, nil)
+					if tt.header != "" {
+						req.Header.Set(tt.header, tt.value)
+					}
+					res := httptest.NewRecorder()
+					mux.ServeHTTP(res, req)
+					if res.Code != tt.status {
+						t.Fatalf("status %d, want %d: %s", res.Code, tt.status, res.Body.String())
+					}
+					if tt.body != "" && res.Body.String() != tt.body {
+						t.Errorf("got principal %q, want %q", res.Body.String(), tt.body)
+					}
+					if res.Code == http.StatusUnauthorized && res.Header().Get("WWW-Authenticate") != "Bearer" {
+						t.Errorf("WWW-Authenticate is %q", res.Header().Get("WWW-Authenticate"))
+					}
+				})
+			}
+
+			logout := httptest.NewRecorder()
+			req := httptest.NewRequest(http.MethodPost, "/logout", nil)
+			req.AddCookie(cookie)
+			if err := sessions.End(ctx, appCtx, logout, req); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := sessions.Authenticate(appCtx, req); err == nil {
+				t.Error("the session is still valid after it ended")
+			}
+			if err := RevokeAPIKey(ctx, appCtx, hashSecret(key)); err != nil {
+				t.Fatal(err)
+			}
+			req.Header.Set("X-API-Key", key)
+			if _, err := (APIKeyAuthenticator{}).Authenticate(appCtx, req); err == nil {
+				t.Error("the API key is still valid after it was revoked")
+			}
+		})
+	}
+}
+
+func TestAuthenticatedRoutes(t *testing.T) {
+	var tests = []struct {
+		name           string
+		authenticators []Authenticator
+		opts           []RouteOption
+		status         int
+	}{
+		{"no authenticators", nil, nil, http.StatusOK},
+		{"authenticators", []Authenticator{JWTAuthenticator{Key: []byte("secret")}}, nil, http.StatusUnauthorized},
+		{"public", []Authenticator{JWTAuthenticator{Key: []byte("secret")}}, []RouteOption{Public()}, http.StatusOK},
+		{"authenticated", nil, []RouteOption{Authenticated()}, http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			appCtx := &Ctx{Backend: NewMemoryBackend(), Authenticators: tt.authenticators}
+			mux := http.NewServeMux()
+			RegisterCRUDRoutes[Memo]("/memos", ServeMux(mux), appCtx, tt.opts...)
+			res := httptest.NewRecorder()
+			mux.ServeHTTP(res, httptest.NewRequest(http.MethodGet, "/memos/", nil))
+			if res.Code != tt.status {
+				t.Errorf("status %d, want %d", res.Code, tt.status)
+			}
+		})
+	}
+}
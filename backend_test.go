@@ -0,0 +1,176 @@
+package grf
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	_ "modernc.org/sqlite"
+)
+
+type Memo struct {
+	Id    primitive.ObjectID `json:"id,omitempty" bson:"_id,omitempty"`
+	Title string             `json:"title" bson:"title"`
+	Views int                `json:"views" bson:"views"`
+}
+
+// Returns an app context for each backend, with nothing stored yet.
+func backendContexts(t *testing.T) map[string]*Ctx {
+	db, err := sql.Open("sqlite", ":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Every connection would get a database of its own.
+	db.SetMaxOpenConns(1)
+	t.Cleanup(func() { db.Close() })
+	return map[string]*Ctx{
+		"memory": {Backend: NewMemoryBackend()},
+		"sqlite": {Backend: NewSQLBackend(db, SQLite)},
+	}
+}
+
+func TestBackendQueries(t *testing.T) {
+	for name, appCtx := range backendContexts(t) {
+		t.Run(name, func(t *testing.T) {
+			testBackendQueries(t, appCtx)
+		})
+	}
+}
+
+func testBackendQueries(t *testing.T, appCtx *Ctx) {
+	ctx := context.Background()
+	for _, title := range []string{"walk the dog", "feed the cat", "wash the Dog"} {
+		if err := Create(ctx, appCtx, &Memo{Title: title, Views: len(title)}); err != nil {
+			t.Fatalf("create %q: %v", title, err)
+		}
+	}
+
+	var tests = []struct {
+		name  string
+		query Query
+		want  []string
+	}{
+		{"everything", Query{}, []string{"walk the dog", "feed the cat", "wash the Dog"}},
+		{"eq", Query{Filter: Filter{{Field: "title", Op: OpEq, Value: "feed the cat"}}}, []string{"feed the cat"}},
+		{"ne", Query{Filter: Filter{{Field: "title", Op: OpNe, Value: "feed the cat"}}}, []string{"walk the dog", "wash the Dog"}},
+		{"contains", Query{Filter: Filter{{Field: "title", Op: OpContains, Value: "dog"}}}, []string{"walk the dog"}},
+		{"icontains", Query{Filter: Filter{{Field: "title", Op: OpIContains, Value: "dog"}}}, []string{"walk the dog", "wash the Dog"}},
+		{"startswith", Query{Filter: Filter{{Field: "title", Op: OpStartsWith, Value: "wa"}}}, []string{"walk the dog", "wash the Dog"}},
+		{"numbers across types", Query{Filter: Filter{{Field: "views", Op: OpGte, Value: int64(12)}}}, []string{"walk the dog", "feed the cat", "wash the Dog"}},
+		{"in", Query{Filter: Filter{{Field: "title", Op: OpIn, Value: []string{"feed the cat", "nope"}}}}, []string{"feed the cat"}},
+		{"sort desc", Query{Sort: []SortField{{Field: "title", Desc: true}}}, []string{"wash the Dog", "walk the dog", "feed the cat"}},
+		{"skip and limit", Query{Sort: []SortField{{Field: "title"}}, Skip: 1, Limit: 1}, []string{"walk the dog"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var memos []Memo
+			if err := ReadQuery(ctx, appCtx, &memos, tt.query); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if len(memos) != len(tt.want) {
+				t.Fatalf("got %d memos, want %d", len(memos), len(tt.want))
+			}
+			for i, memo := range memos {
+				if memo.Title != tt.want[i] {
+					t.Errorf("memo %d is %q, want %q", i, memo.Title, tt.want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestBackendWrites(t *testing.T) {
+	for name, appCtx := range backendContexts(t) {
+		t.Run(name, func(t *testing.T) {
+			testBackendWrites(t, appCtx)
+		})
+	}
+}
+
+func testBackendWrites(t *testing.T, appCtx *Ctx) {
+	ctx := context.Background()
+	memo := Memo{Title: "walk the dog"}
+	if err := Create(ctx, appCtx, &memo); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if memo.Id.IsZero() {
+		t.Fatalf("expected the generated id to be set")
+	}
+	id := memo.Id.Hex()
+
+	if err := Create(ctx, appCtx, &memo); !errors.Is(err, ErrConflict) {
+		t.Errorf("creating a duplicate id: got %v, want ErrConflict", err)
+	}
+
+	if err := ReplaceOne(ctx, appCtx, &Memo{Title: "walk the cat"}, id); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	var updated Memo
+	patch := Patch{Set: map[string]any{"views": 3}, Test: Filter{{Field: "title", Op: OpEq, Value: "walk the cat"}}}
+	if err := UpdateOne(ctx, appCtx, &updated, id, patch); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if updated.Title != "walk the cat" || updated.Views != 3 || updated.Id != memo.Id {
+		t.Errorf("got %+v after replace and patch", updated)
+	}
+
+	patch.Test = Filter{{Field: "title", Op: OpEq, Value: "walk the dog"}}
+	if err := UpdateOne(ctx, appCtx, &updated, id, patch); !errors.Is(err, ErrConflict) {
+		t.Errorf("failed test: got %v, want ErrConflict", err)
+	}
+
+	if err := Delete[Memo](ctx, appCtx, id); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := ReadOne(ctx, appCtx, &updated, id); !errors.Is(err, ErrNotFound) {
+		t.Errorf("reading a deleted memo: got %v, want ErrNotFound", err)
+	}
+	if err := Delete[Memo](ctx, appCtx, id); !errors.Is(err, ErrNotFound) {
+		t.Errorf("deleting a deleted memo: got %v, want ErrNotFound", err)
+	}
+}
+
+func TestBackendRelations(t *testing.T) {
+	RegisterModel[Project]()
+	RegisterModel[Task]()
+	for name, appCtx := range backendContexts(t) {
+		t.Run(name, func(t *testing.T) {
+			testBackendRelations(t, appCtx)
+		})
+	}
+}
+
+func testBackendRelations(t *testing.T, appCtx *Ctx) {
+	ctx := context.Background()
+
+	project, other := Project{}, Project{}
+	Create(ctx, appCtx, &project)
+	Create(ctx, appCtx, &other)
+	parent := Task{ProjectID: other.Id, Watchers: []primitive.ObjectID{project.Id, other.Id}}
+	Create(ctx, appCtx, &parent)
+	child := Task{ProjectID: project.Id, Parent: parent.Id}
+	Create(ctx, appCtx, &child)
+
+	// The child restricts deleting its parent, so the whole cascade rolls back.
+	if err := Delete[Project](ctx, appCtx, other.Id.Hex()); !errors.Is(err, ErrConflict) {
+		t.Fatalf("got %v, want ErrConflict", err)
+	}
+	var tasks []Task
+	Read(ctx, appCtx, &tasks)
+	if len(tasks) != 2 || len(tasks[0].Watchers) != 2 {
+		t.Fatalf("expected the failed delete to roll back, got %+v", tasks)
+	}
+
+	if err := Delete[Project](ctx, appCtx, project.Id.Hex()); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	Read(ctx, appCtx, &tasks)
+	if len(tasks) != 1 || tasks[0].Id != parent.Id {
+		t.Fatalf("expected the child to be cascaded, got %+v", tasks)
+	}
+	if len(tasks[0].Watchers) != 1 || tasks[0].Watchers[0] != other.Id {
+		t.Errorf("expected the project to be pulled from watchers, got %v", tasks[0].Watchers)
+	}
+}
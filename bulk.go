@@ -0,0 +1,446 @@
+package grf
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+)
+
+// The most items a bulk request may have.
+var BulkLimit = 1000
+
+// The largest body of a bulk request, larger ones are a 413.
+const bulkBodyLimit = 1 << 20
+
+// BulkResult is the outcome of one item of a bulk operation. Results are in the order of the items.
+type BulkResult struct {
+	// The status code the item would have been answered with on its own.
+	Status int `json:"status"`
+	// The id of the object the item created, updated or deleted.
+	ID    any      `json:"id,omitempty"`
+	Error *Problem `json:"error,omitempty"`
+}
+
+// BulkPatch is an item of BulkUpdate, the patch for the object with the id.
+type BulkPatch struct {
+	ID    string          `json:"id"`
+	Patch json.RawMessage `json:"patch"`
+}
+
+// The results of the items of a bulk operation, as they are written.
+type bulkBatch struct {
+	results []BulkResult
+	atomic  bool
+	// The first item that failed, -1 while none did, and its error.
+	failed int
+	err    error
+}
+
+// Records that the item succeeded.
+func (b *bulkBatch) succeed(i int, id any, status int) {
+	b.results[i] = BulkResult{Status: status, ID: id}
+}
+
+// Records that the item failed.
+func (b *bulkBatch) fail(i int, id any, err error) {
+	log.Println("Error in item", i, "of the bulk operation.", err)
+	problem := problemOf(err)
+	b.results[i] = BulkResult{Status: problem.Status, ID: id, Error: &problem}
+	if b.failed < 0 || i < b.failed {
+		b.failed, b.err = i, err
+	}
+}
+
+// Reports whether an atomic batch failed already, so there is no point in writing the rest.
+func (b *bulkBatch) stopped() bool {
+	return b.atomic && b.failed >= 0
+}
+
+// Runs a bulk operation and collects the results of its items. write records the outcome of every item in the batch,
+// an error it returns fails the items it didn't record.
+// Atomic batches run in a transaction that is rolled back when an item fails, the first failing item is reported
+// with its error and the others as 424 Failed Dependency. The error of the first failing item is returned then.
+func runBulk(ctx context.Context, appCtx *Ctx, n int, atomic bool, write func(ctx context.Context, batch *bulkBatch) error) ([]BulkResult, error) {
+	newBatch := func() *bulkBatch {
+		return &bulkBatch{results: make([]BulkResult, n), atomic: atomic, failed: -1}
+	}
+	if !atomic {
+		batch := newBatch()
+		if err := write(ctx, batch); err != nil {
+			for i, result := range batch.results {
+				if result.Status == 0 {
+					batch.fail(i, nil, err)
+				}
+			}
+		}
+		return batch.results, nil
+	}
+
+	var batch *bulkBatch
+	err := WithTransaction(ctx, appCtx, func(ctx context.Context) error {
+		// A retried transaction starts over, nothing of the attempt before it was kept.
+		batch = newBatch()
+		if err := write(ctx, batch); err != nil {
+			batch.failed = -1
+			return err
+		}
+		return batch.err
+	})
+	if err == nil {
+		return batch.results, nil
+	}
+	failed := batch.failed
+	for i := range batch.results {
+		if i == failed {
+			continue
+		}
+		problem := problemOf(err)
+		if failed >= 0 {
+			problem = Problem{
+				Type:   "about:blank",
+				Title:  http.StatusText(http.StatusFailedDependency),
+				Status: http.StatusFailedDependency,
+				Detail: fmt.Sprintf("item %d of the batch failed, nothing was changed", failed),
+			}
+		}
+		batch.results[i] = BulkResult{Status: problem.Status, ID: batch.results[i].ID, Error: &problem}
+	}
+	return batch.results, err
+}
+
+// Creates the objects in one go with InsertMany. Each object is validated and its hooks run like with Create.
+// The generated ids are set on the objects.
+// Atomic batches are created in a transaction and fail as a whole, with the error of the first failing object.
+func BulkCreate[K any](ctx context.Context, appCtx *Ctx, objects []K, atomic bool) ([]BulkResult, error) {
+	ctx, cancel := operationContext[K](ctx, appCtx, ActionCreate)
+	defer cancel()
+
+	return runBulk(ctx, appCtx, len(objects), atomic, func(ctx context.Context, batch *bulkBatch) error {
+		// The objects that are valid, and where they are in objects.
+		var valid []K
+		var indexes []int
+		for i := range objects {
+			object := &objects[i]
+			err := beforeCreate(ctx, appCtx, object)
+			if err == nil {
+				auditCreate(ctx, object)
+				err = stampScope(ctx, object)
+			}
+			if err == nil {
+				err = Validate(object)
+			}
+			if err != nil {
+				batch.fail(i, nil, err)
+				continue
+			}
+			valid = append(valid, *object)
+			indexes = append(indexes, i)
+		}
+		if batch.stopped() || len(valid) == 0 {
+			return nil
+		}
+
+		err := RepositoryFor[K](appCtx).CreateMany(ctx, valid)
+		var errs BulkWriteErrors
+		if err != nil && !errors.As(err, &errs) {
+			return err
+		}
+		for j, i := range indexes {
+			objects[i] = valid[j]
+			err, failed := errs[j]
+			if !failed {
+				err = afterCreate(ctx, appCtx, &objects[i])
+			}
+			if err != nil {
+				batch.fail(i, nil, err)
+				continue
+			}
+			batch.succeed(i, getID(&objects[i]), http.StatusCreated)
+		}
+		log.Println("Created objects in bulk.", len(valid)-len(errs))
+		return nil
+	})
+}
+
+// Applies JSON Merge Patches to the objects with the given ids in one go with BulkWrite.
+// The patches are checked like with UpdateOne.
+// Atomic batches are updated in a transaction and fail as a whole, with the error of the first failing patch.
+func BulkUpdate[K any](ctx context.Context, appCtx *Ctx, patches []BulkPatch, atomic bool) ([]BulkResult, error) {
+	return bulkUpdate[K](ctx, appCtx, patches, atomic, nil)
+}
+
+// Checks whether the object matching the filter may be changed, before an item of a bulk operation changes it.
+type bulkCheck func(ctx context.Context, filter Filter) error
+
+func bulkUpdate[K any](ctx context.Context, appCtx *Ctx, patches []BulkPatch, atomic bool, check bulkCheck) ([]BulkResult, error) {
+	ctx, cancel := operationContext[K](ctx, appCtx, ActionUpdate)
+	defer cancel()
+
+	return runBulk(ctx, appCtx, len(patches), atomic, func(ctx context.Context, batch *bulkBatch) error {
+		// The updates of the valid patches, and where they are in patches.
+		var updates []BulkWriteModel
+		var indexes []int
+		for i, item := range patches {
+			update, err := bulkWriteModel[K](ctx, item, check)
+			if err != nil {
+				batch.fail(i, item.ID, err)
+				continue
+			}
+			updates = append(updates, update)
+			indexes = append(indexes, i)
+		}
+		if batch.stopped() || len(updates) == 0 {
+			return nil
+		}
+
+		repository := RepositoryFor[K](appCtx)
+		matched, err := repository.BulkWrite(ctx, updates)
+		var errs BulkWriteErrors
+		if err != nil && !errors.As(err, &errs) {
+			return err
+		}
+		// The write only counts the matches, when some are missing the stored objects tell which.
+		var found map[string]bool
+		if matched < int64(len(updates)-len(errs)) {
+			if found, err = foundIDs(ctx, repository, updates); err != nil {
+				return err
+			}
+		}
+		for j, i := range indexes {
+			switch err, failed := errs[j]; {
+			case failed:
+				batch.fail(i, patches[i].ID, err)
+			case found != nil && !found[formatID(updates[j].Filter[0].Value)]:
+				batch.fail(i, patches[i].ID, newError(ErrNotFound, "", nil))
+			default:
+				batch.succeed(i, patches[i].ID, http.StatusOK)
+			}
+		}
+		log.Println("Updated objects in bulk.", matched)
+		return nil
+	})
+}
+
+// Returns the update of an item of a bulk update, checked like with UpdateOne. The first condition of the filter is the id.
+func bulkWriteModel[K any](ctx context.Context, item BulkPatch, check bulkCheck) (BulkWriteModel, error) {
+	patch, err := ParseMergePatch[K](item.Patch)
+	if err != nil {
+		return BulkWriteModel{}, newError(ErrBadRequest, err.Error(), err)
+	}
+	filter, err := idFilter[K](item.ID)
+	if err != nil {
+		return BulkWriteModel{}, err
+	}
+	if filter, err = scoped[K](ctx, filter); err != nil {
+		return BulkWriteModel{}, err
+	}
+	filter = withoutDeleted[K](filter)
+	if check != nil {
+		if err := check(ctx, filter); err != nil {
+			return BulkWriteModel{}, err
+		}
+	}
+	model := getModel[K]()
+	patch = auditPatch(model, patch)
+	if patch.IsEmpty() {
+		return BulkWriteModel{}, newError(ErrValidation, "patch does not change anything", nil)
+	}
+	if err := validatePatch(model, patch); err != nil {
+		return BulkWriteModel{}, err
+	}
+	return BulkWriteModel{Filter: filter, Patch: patch}, nil
+}
+
+// Returns the formatted ids of the objects matching the filters of the updates, see bulkWriteModel.
+// The managed fields the filters check can't be patched, so they still match after the updates.
+func foundIDs[K any](ctx context.Context, repository Repository[K], updates []BulkWriteModel) (map[string]bool, error) {
+	ids := make([]any, len(updates))
+	for i, update := range updates {
+		ids[i] = update.Filter[0].Value
+	}
+	// Only the ids differ between the filters.
+	filter := append(Filter{{Field: "_id", Op: OpIn, Value: ids}}, updates[0].Filter[1:]...)
+	var objects []K
+	if err := repository.List(ctx, Query{Filter: filter}, &objects); err != nil {
+		return nil, err
+	}
+	found := make(map[string]bool, len(objects))
+	for i := range objects {
+		found[formatID(getID(&objects[i]))] = true
+	}
+	return found, nil
+}
+
+// Deletes the objects with the given ids through Delete.
+// Atomic batches are deleted in a transaction and fail as a whole, with the error of the first failing delete.
+func BulkDelete[K any](ctx context.Context, appCtx *Ctx, ids []string, atomic bool) ([]BulkResult, error) {
+	return bulkDelete[K](ctx, appCtx, ids, atomic, nil)
+}
+
+func bulkDelete[K any](ctx context.Context, appCtx *Ctx, ids []string, atomic bool, check bulkCheck) ([]BulkResult, error) {
+	return runBulk(ctx, appCtx, len(ids), atomic, func(ctx context.Context, batch *bulkBatch) error {
+		for i, id := range ids {
+			if batch.stopped() {
+				break
+			}
+			filter, err := idFilter[K](id)
+			if err == nil && check != nil {
+				err = check(ctx, withoutDeleted[K](filter))
+			}
+			if err == nil {
+				err = deleteOne[K](ctx, appCtx, filter, "")
+			}
+			if err != nil {
+				batch.fail(i, id, err)
+				continue
+			}
+			batch.succeed(i, id, http.StatusNoContent)
+		}
+		return nil
+	})
+}
+
+// Deletes the objects matching the filter one by one through Delete, see BulkDelete.
+func BulkDeleteWhere[K any](ctx context.Context, appCtx *Ctx, filter Filter, atomic bool) ([]BulkResult, error) {
+	return bulkDeleteWhere[K](ctx, appCtx, filter, atomic, nil)
+}
+
+func bulkDeleteWhere[K any](ctx context.Context, appCtx *Ctx, filter Filter, atomic bool, check bulkCheck) ([]BulkResult, error) {
+	// One more than the limit is enough to know the filter matches too many.
+	var objects []K
+	if err := ReadQuery(ctx, appCtx, &objects, Query{Filter: filter, Limit: int64(BulkLimit) + 1}); err != nil {
+		return nil, err
+	}
+	if len(objects) > BulkLimit {
+		return nil, newError(ErrRequestTooLarge, fmt.Sprintf("the filter matches more than %d objects", BulkLimit), nil)
+	}
+	ids := make([]string, len(objects))
+	for i := range objects {
+		ids[i] = formatID(getID(&objects[i]))
+	}
+	return bulkDelete[K](ctx, appCtx, ids, atomic, check)
+}
+
+// Adds the bulk routes for type T to the router.
+// POST /bulk with a list of objects.
+// PATCH /bulk with a list of {"id": ..., "patch": {...}} items, the patches are JSON Merge Patches.
+// DELETE /bulk with a list of ids, or without a body and with filters in the query string like GET /.
+// ?atomic=true makes a batch all-or-nothing.
+func AddBulkRoutes[T any](r Router, ctx *Ctx, opts ...RouteOption) {
+	config := newRouteConfig[T](opts)
+	config.handle(r, http.MethodPost, "/bulk", ActionCreate, ctx, BulkCreateHandler[T])
+	config.handle(r, http.MethodPatch, "/bulk", ActionUpdate, ctx, BulkUpdateHandler[T])
+	config.handle(r, http.MethodDelete, "/bulk", ActionDelete, ctx, BulkDeleteHandler[T])
+}
+
+// Creates a list of objects of type T. Responds with the result of every object.
+func BulkCreateHandler[T any](ctx *Ctx, w http.ResponseWriter, r *http.Request) {
+	var objects []T
+	if !decodeBulk(w, r, &objects) {
+		return
+	}
+	results, err := BulkCreate(r.Context(), ctx, objects, isAtomic(r))
+	writeBulk(w, r, http.StatusCreated, results, err)
+}
+
+// Patches a list of objects of type T. Responds with the result of every patch.
+func BulkUpdateHandler[T any](ctx *Ctx, w http.ResponseWriter, r *http.Request) {
+	var patches []BulkPatch
+	if !decodeBulk(w, r, &patches) {
+		return
+	}
+	results, err := bulkUpdate[T](r.Context(), ctx, patches, isAtomic(r), objectCheck[T](ctx, r, ActionUpdate))
+	writeBulk(w, r, http.StatusOK, results, err)
+}
+
+// Deletes a list of objects of type T, given by their ids or by filters in the query string.
+// Responds with the result of every object.
+func BulkDeleteHandler[T any](ctx *Ctx, w http.ResponseWriter, r *http.Request) {
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, bulkBodyLimit))
+	if err != nil {
+		WriteError(w, r, decodeError(err))
+		return
+	}
+	if len(bytes.TrimSpace(body)) > 0 {
+		var ids []string
+		r.Body = io.NopCloser(bytes.NewReader(body))
+		if !decodeBulk(w, r, &ids) {
+			return
+		}
+		results, err := bulkDelete[T](r.Context(), ctx, ids, isAtomic(r), objectCheck[T](ctx, r, ActionDelete))
+		writeBulk(w, r, http.StatusOK, results, err)
+		return
+	}
+
+	values := r.URL.Query()
+	values.Del("atomic")
+	query, err := ParseQuery[T](values)
+	if err != nil {
+		WriteError(w, r, newError(ErrBadRequest, err.Error(), err))
+		return
+	}
+	if len(query.Filter) == 0 {
+		// Deleting everything takes more than an empty request.
+		WriteError(w, r, newError(ErrBadRequest, "give the ids to delete in the body or filters in the query string", nil))
+		return
+	}
+	results, err := bulkDeleteWhere[T](r.Context(), ctx, query.Filter, isAtomic(r), objectCheck[T](ctx, r, ActionDelete))
+	if results == nil && err != nil {
+		WriteError(w, r, err)
+		return
+	}
+	writeBulk(w, r, http.StatusOK, results, err)
+}
+
+// Returns the check of the object permissions of the route for the items of a bulk request, see authorizeObject.
+func objectCheck[T any](appCtx *Ctx, r *http.Request, action Action) bulkCheck {
+	return func(ctx context.Context, filter Filter) error {
+		return authorizeObject[T](ctx, appCtx, r, action, filter)
+	}
+}
+
+// Decodes the list of items of a bulk request. Writes the error response and reports false if it is no valid list.
+func decodeBulk[T any](w http.ResponseWriter, r *http.Request, items *[]T) bool {
+	decoder := json.NewDecoder(http.MaxBytesReader(w, r.Body, bulkBodyLimit))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(items); err != nil {
+		log.Println("Error decoding the bulk request.", err)
+		WriteError(w, r, decodeError(err))
+		return false
+	}
+	if len(*items) > BulkLimit {
+		WriteError(w, r, newError(ErrRequestTooLarge, fmt.Sprintf("a bulk request can't have more than %d items", BulkLimit), nil))
+		return false
+	}
+	return true
+}
+
+// Reports whether the bulk request asks to be all-or-nothing.
+func isAtomic(r *http.Request) bool {
+	atomic, _ := strconv.ParseBool(r.URL.Query().Get("atomic"))
+	return atomic
+}
+
+// Writes the results of a bulk request. The status is the given one if every item succeeded,
+// the status of the failure for a failed atomic batch and 207 Multi-Status otherwise.
+func writeBulk(w http.ResponseWriter, r *http.Request, status int, results []BulkResult, err error) {
+	if results == nil {
+		results = []BulkResult{}
+	}
+	for _, result := range results {
+		if result.Error != nil {
+			status = http.StatusMultiStatus
+			break
+		}
+	}
+	if err != nil {
+		status = StatusOf(err)
+	}
+	writeJSON(w, r, status, results)
+}
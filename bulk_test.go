@@ -0,0 +1,219 @@
+package grf
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type Ticket struct {
+	Id    primitive.ObjectID `json:"id,omitempty" bson:"_id,omitempty"`
+	Title string             `json:"title" bson:"title" grf:"required"`
+	Done  bool               `json:"done" bson:"done" grf:"filter"`
+}
+
+func TestBulkRoutes(t *testing.T) {
+	for name, appCtx := range backendContexts(t) {
+		t.Run(name, func(t *testing.T) {
+			mux := http.NewServeMux()
+			RegisterCRUDRoutes[Ticket]("/tickets", ServeMux(mux), appCtx)
+			request := func(method, target, body string) ([]BulkResult, int) {
+				res := httptest.NewRecorder()
+				mux.ServeHTTP(res, httptest.NewRequest(method, target, strings.NewReader(body)))
+				var results []BulkResult
+				json.Unmarshal(res.Body.Bytes(), &results)
+				return results, res.Code
+			}
+			statuses := func(results []BulkResult) []int {
+				var statuses []int
+				for _, result := range results {
+					statuses = append(statuses, result.Status)
+				}
+				return statuses
+			}
+			count := func() int {
+				var tickets []Ticket
+				res := httptest.NewRecorder()
+				mux.ServeHTTP(res, httptest.NewRequest(http.MethodGet, "/tickets/", nil))
+				json.Unmarshal(res.Body.Bytes(), &tickets)
+				return len(tickets)
+			}
+
+			results, code := request(http.MethodPost, "/tickets/bulk", `[{"title": "a"}, {"title": "b"}]`)
+			if code != http.StatusCreated || !reflect.DeepEqual(statuses(results), []int{201, 201}) {
+				t.Fatalf("create: status %d, results %v", code, statuses(results))
+			}
+			first, second := results[0].ID.(string), results[1].ID.(string)
+
+			var tests = []struct {
+				name     string
+				method   string
+				target   string
+				body     string
+				want     int
+				statuses []int
+				count    int
+			}{
+				{"partial create", http.MethodPost, "/tickets/bulk", `[{"title": "c"}, {"title": ""}]`, http.StatusMultiStatus, []int{201, 422}, 3},
+				{"atomic create", http.MethodPost, "/tickets/bulk?atomic=true", `[{"title": "d"}, {"title": ""}]`, http.StatusUnprocessableEntity, []int{424, 422}, 3},
+				{"update", http.MethodPatch, "/tickets/bulk", `[{"id": "` + first + `", "patch": {"done": true}}, {"id": "nope", "patch": {"done": true}}]`, http.StatusMultiStatus, []int{200, 400}, 3},
+				{"atomic update", http.MethodPatch, "/tickets/bulk?atomic=1", `[{"id": "` + second + `", "patch": {"done": true}}, {"id": "` + second + `", "patch": {"title": null}}]`, http.StatusUnprocessableEntity, []int{424, 422}, 3},
+				{"delete by filter", http.MethodDelete, "/tickets/bulk?done=true", "", http.StatusOK, []int{204}, 2},
+				{"delete by id", http.MethodDelete, "/tickets/bulk", `["` + second + `", "` + second + `"]`, http.StatusMultiStatus, []int{204, 404}, 1},
+				{"delete everything", http.MethodDelete, "/tickets/bulk", "", http.StatusBadRequest, nil, 1},
+				{"not a list", http.MethodPost, "/tickets/bulk", `{"title": "e"}`, http.StatusBadRequest, nil, 1},
+				{"body too large", http.MethodDelete, "/tickets/bulk", `["` + strings.Repeat("a", bulkBodyLimit) + `"]`, http.StatusRequestEntityTooLarge, nil, 1},
+			}
+			for _, tt := range tests {
+				results, code := request(tt.method, tt.target, tt.body)
+				if code != tt.want || !reflect.DeepEqual(statuses(results), tt.statuses) {
+					t.Errorf("%s: status %d and results %v, want %d and %v", tt.name, code, statuses(results), tt.want, tt.statuses)
+				}
+				if got := count(); got != tt.count {
+					t.Errorf("%s: %d tickets left, want %d", tt.name, got, tt.count)
+				}
+			}
+		})
+	}
+}
+
+// Fails the commit of the second transaction.
+type commitFailingBackend struct {
+	*MemoryBackend
+	transactions int
+}
+
+func (b *commitFailingBackend) WithTransaction(ctx context.Context, fn func(ctx context.Context) error) error {
+	b.transactions++
+	err := b.MemoryBackend.WithTransaction(ctx, fn)
+	if err == nil && b.transactions == 2 {
+		return errors.New("commit failed")
+	}
+	return err
+}
+
+func TestAtomicBulkRetry(t *testing.T) {
+	appCtx := &Ctx{Backend: &commitFailingBackend{MemoryBackend: NewMemoryBackend()}}
+	attempt := 0
+	results, err := runBulk(context.Background(), appCtx, 2, true, func(ctx context.Context, batch *bulkBatch) error {
+		attempt++
+		batch.succeed(0, 0, http.StatusOK)
+		if attempt == 1 {
+			batch.fail(1, 1, newError(ErrTransient, "", nil))
+			return nil
+		}
+		batch.succeed(1, 1, http.StatusOK)
+		return nil
+	})
+	if err == nil {
+		t.Fatal("expected the failed commit")
+	}
+	// The item that failed in the first attempt didn't fail the batch, the commit did.
+	for i, result := range results {
+		if result.Status != http.StatusInternalServerError {
+			t.Errorf("item %d: status %d, want %d", i, result.Status, http.StatusInternalServerError)
+		}
+	}
+}
+
+// Counts the writes that reach the backend.
+type countingBackend struct {
+	*MemoryBackend
+	writes map[string]int
+}
+
+func (b *countingBackend) Insert(ctx context.Context, c Collection, object any) (any, error) {
+	b.writes["Insert"]++
+	return b.MemoryBackend.Insert(ctx, c, object)
+}
+
+func (b *countingBackend) InsertMany(ctx context.Context, c Collection, objects []any) ([]any, error) {
+	b.writes["InsertMany"]++
+	return b.MemoryBackend.InsertMany(ctx, c, objects)
+}
+
+func (b *countingBackend) UpdateOne(ctx context.Context, c Collection, filter Filter, patch Patch, object any) error {
+	b.writes["UpdateOne"]++
+	return b.MemoryBackend.UpdateOne(ctx, c, filter, patch, object)
+}
+
+func (b *countingBackend) BulkWrite(ctx context.Context, c Collection, updates []BulkWriteModel) (int64, error) {
+	b.writes["BulkWrite"]++
+	return b.MemoryBackend.BulkWrite(ctx, c, updates)
+}
+
+func TestBulkWritesInOneGo(t *testing.T) {
+	backend := &countingBackend{MemoryBackend: NewMemoryBackend(), writes: map[string]int{}}
+	appCtx := &Ctx{Backend: backend}
+	ctx := context.Background()
+
+	tickets := []Ticket{{Title: "a"}, {Title: ""}, {Title: "c"}}
+	results, err := BulkCreate(ctx, appCtx, tickets, false)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !reflect.DeepEqual(statusesOf(results), []int{201, 422, 201}) || tickets[0].Id.IsZero() || tickets[2].Id.IsZero() {
+		t.Errorf("create: results %v, tickets %v", statusesOf(results), tickets)
+	}
+
+	missing := primitive.NewObjectID().Hex()
+	patches := []BulkPatch{
+		{ID: tickets[0].Id.Hex(), Patch: json.RawMessage(`{"done": true}`)},
+		{ID: missing, Patch: json.RawMessage(`{"done": true}`)},
+		{ID: tickets[2].Id.Hex(), Patch: json.RawMessage(`{"title": "d"}`)},
+	}
+	results, err = BulkUpdate[Ticket](ctx, appCtx, patches, false)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !reflect.DeepEqual(statusesOf(results), []int{200, 404, 200}) {
+		t.Errorf("update: results %v", statusesOf(results))
+	}
+	if want := map[string]int{"InsertMany": 1, "BulkWrite": 1}; !reflect.DeepEqual(backend.writes, want) {
+		t.Errorf("got writes %v, want %v", backend.writes, want)
+	}
+
+	var stored Ticket
+	if err := ReadOne(ctx, appCtx, &stored, tickets[2].Id.Hex()); err != nil || stored.Title != "d" {
+		t.Errorf("got %+v, %v", stored, err)
+	}
+}
+
+func statusesOf(results []BulkResult) []int {
+	var statuses []int
+	for _, result := range results {
+		statuses = append(statuses, result.Status)
+	}
+	return statuses
+}
+
+func TestBulkDeleteWhereLimit(t *testing.T) {
+	defer func(limit int) { BulkLimit = limit }(BulkLimit)
+	BulkLimit = 2
+	appCtx := &Ctx{Backend: NewMemoryBackend()}
+	ctx := context.Background()
+	for _, title := range []string{"a", "b", "c"} {
+		if err := Create(ctx, appCtx, &Ticket{Title: title}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	_, err := BulkDeleteWhere[Ticket](ctx, appCtx, Filter{{Field: "title", Op: OpNe, Value: ""}}, false)
+	if !errors.Is(err, ErrRequestTooLarge) {
+		t.Errorf("got %v, want request too large", err)
+	}
+	if count, _ := RepositoryFor[Ticket](appCtx).Count(ctx, nil); count != 3 {
+		t.Errorf("%d tickets left, want 3", count)
+	}
+	results, err := BulkDeleteWhere[Ticket](ctx, appCtx, Filter{{Field: "title", Op: OpNe, Value: "a"}}, false)
+	if err != nil || len(results) != 2 {
+		t.Errorf("got %v and %v, want two deletes", results, err)
+	}
+}
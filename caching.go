@@ -0,0 +1,92 @@
+package grf
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"reflect"
+	"strings"
+	"time"
+)
+
+// Sets a Cache-Control header on the read routes, like "private, max-age=60" or "no-cache".
+// Without it the responses have no Cache-Control and clients decide themselves.
+func WithCacheControl(policy string) RouteOption {
+	return func(c *routeConfig) {
+		c.cacheControl = policy
+	}
+}
+
+// Returns the strong ETag of a response body.
+func contentETag(data []byte) string {
+	sum := sha256.Sum256(data)
+	return `"` + hex.EncodeToString(sum[:16]) + `"`
+}
+
+// Returns when the object was last modified, from its updatedAt field. Zero for models without one.
+func lastModified(object any) time.Time {
+	model := modelOf(reflect.TypeOf(object))
+	field := model.FieldWithOption(AuditUpdatedAt)
+	if field == nil {
+		return time.Time{}
+	}
+	value := reflect.Indirect(reflect.ValueOf(object).Elem().FieldByIndex(field.Index))
+	if !value.IsValid() {
+		return time.Time{}
+	}
+	t, _ := value.Interface().(time.Time)
+	return t
+}
+
+// Reports whether the copy the client has is still current, going by If-None-Match or else If-Modified-Since.
+func isNotModified(r *http.Request, etag string, modified time.Time) bool {
+	if ifNoneMatch := r.Header.Get("If-None-Match"); ifNoneMatch != "" {
+		// If-None-Match uses the weak comparison, see RFC 9110.
+		for _, candidate := range strings.Split(ifNoneMatch, ",") {
+			candidate = strings.TrimPrefix(strings.TrimSpace(candidate), "W/")
+			if candidate == "*" || candidate == strings.TrimPrefix(etag, "W/") {
+				return true
+			}
+		}
+		return false
+	}
+	since, err := http.ParseTime(r.Header.Get("If-Modified-Since"))
+	if err != nil || modified.IsZero() {
+		return false
+	}
+	// HTTP dates have a resolution of seconds.
+	return !modified.Truncate(time.Second).After(since)
+}
+
+// Writes the value as the json response of a read route, with the caching headers.
+// Responds 304 Not Modified with no body when the client's copy is current.
+// An empty etag is computed from the body.
+func writeCacheable(w http.ResponseWriter, r *http.Request, v any, etag string, modified time.Time) {
+	b, err := json.Marshal(v)
+	if err != nil {
+		log.Print("Error marshalling.")
+		log.Print(err.Error())
+		WriteError(w, r, err)
+		return
+	}
+	if etag == "" {
+		etag = contentETag(b)
+	}
+	w.Header().Set("ETag", etag)
+	if !modified.IsZero() {
+		w.Header().Set("Last-Modified", modified.UTC().Format(http.TimeFormat))
+	}
+	if policy := routeConfigOf(r).cacheControl; policy != "" {
+		w.Header().Set("Cache-Control", policy)
+	}
+	if isNotModified(r, etag, modified) {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	fmt.Fprintln(w, string(b))
+}
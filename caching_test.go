@@ -0,0 +1,110 @@
+package grf
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type Bulletin struct {
+	Id        primitive.ObjectID `json:"id,omitempty" bson:"_id,omitempty"`
+	Title     string             `json:"title" bson:"title"`
+	UpdatedAt *time.Time         `json:"updatedAt" bson:"updatedAt" grf:"updatedAt"`
+}
+
+func TestConditionalGet(t *testing.T) {
+	mux := http.NewServeMux()
+	RegisterCRUDRoutes[Bulletin]("/bulletins", ServeMux(mux), &Ctx{Backend: NewMemoryBackend()}, WithCacheControl("private, max-age=60"))
+	res := httptest.NewRecorder()
+	mux.ServeHTTP(res, httptest.NewRequest(http.MethodPost, "/bulletins/", strings.NewReader(`{"title": "a"}`)))
+	location := res.Header().Get("Location")
+
+	for _, target := range []string{location, "/bulletins/"} {
+		res = httptest.NewRecorder()
+		mux.ServeHTTP(res, httptest.NewRequest(http.MethodGet, target, nil))
+		etag, modified := res.Header().Get("ETag"), res.Header().Get("Last-Modified")
+		list := target == "/bulletins/"
+		if res.Code != http.StatusOK || etag == "" || (modified == "") != list {
+			t.Fatalf("GET %s: status %d, ETag %q, Last-Modified %q", target, res.Code, etag, modified)
+		}
+		if got := res.Header().Get("Cache-Control"); got != "private, max-age=60" {
+			t.Errorf("GET %s: Cache-Control %q", target, got)
+		}
+		later := time.Now().Add(time.Hour).UTC().Format(http.TimeFormat)
+		earlier := time.Now().Add(-time.Hour).UTC().Format(http.TimeFormat)
+
+		// Lists have no Last-Modified, they are only validated by their ETag.
+		var tests = []struct {
+			name     string
+			header   string
+			value    string
+			want     int
+			wantList int
+		}{
+			{"same etag", "If-None-Match", etag, http.StatusNotModified, http.StatusNotModified},
+			{"weak etag", "If-None-Match", "W/" + etag, http.StatusNotModified, http.StatusNotModified},
+			{"one of the etags", "If-None-Match", `"other", ` + etag, http.StatusNotModified, http.StatusNotModified},
+			{"any", "If-None-Match", "*", http.StatusNotModified, http.StatusNotModified},
+			{"other etag", "If-None-Match", `"other"`, http.StatusOK, http.StatusOK},
+			{"not modified since", "If-Modified-Since", modified, http.StatusNotModified, http.StatusOK},
+			{"not modified since later", "If-Modified-Since", later, http.StatusNotModified, http.StatusOK},
+			{"modified since", "If-Modified-Since", earlier, http.StatusOK, http.StatusOK},
+		}
+		for _, tt := range tests {
+			t.Run(target+"/"+tt.name, func(t *testing.T) {
+				if list {
+					tt.want = tt.wantList
+				}
+				req := httptest.NewRequest(http.MethodGet, target, nil)
+				req.Header.Set(tt.header, tt.value)
+				res := httptest.NewRecorder()
+				mux.ServeHTTP(res, req)
+				if res.Code != tt.want {
+					t.Errorf("status %d, want %d", res.Code, tt.want)
+				}
+				if tt.want == http.StatusNotModified && (res.Body.Len() > 0 || res.Header().Get("ETag") != etag) {
+					t.Errorf("304 with body %q and ETag %q", res.Body.String(), res.Header().Get("ETag"))
+				}
+			})
+		}
+	}
+
+	// Changing the object changes the ETag of the object and of the list.
+	res = httptest.NewRecorder()
+	mux.ServeHTTP(res, httptest.NewRequest(http.MethodGet, "/bulletins/", nil))
+	listETag := res.Header().Get("ETag")
+	mux.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodPatch, location, strings.NewReader(`{"title": "b"}`)))
+	req := httptest.NewRequest(http.MethodGet, "/bulletins/", nil)
+	req.Header.Set("If-None-Match", listETag)
+	res = httptest.NewRecorder()
+	mux.ServeHTTP(res, req)
+	if res.Code != http.StatusOK {
+		t.Errorf("list after a change: status %d, want %d", res.Code, http.StatusOK)
+	}
+}
+
+func TestListModifiedSinceIgnored(t *testing.T) {
+	mux := http.NewServeMux()
+	RegisterCRUDRoutes[Bulletin]("/bulletins", ServeMux(mux), &Ctx{Backend: NewMemoryBackend()})
+	var locations []string
+	for _, title := range []string{"a", "b"} {
+		res := httptest.NewRecorder()
+		mux.ServeHTTP(res, httptest.NewRequest(http.MethodPost, "/bulletins/", strings.NewReader(`{"title": "`+title+`"}`)))
+		locations = append(locations, res.Header().Get("Location"))
+	}
+	since := time.Now().Add(time.Hour).UTC().Format(http.TimeFormat)
+	// Deleting an object leaves the updatedAt of the rest as it was.
+	mux.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodDelete, locations[0], nil))
+
+	req := httptest.NewRequest(http.MethodGet, "/bulletins/", nil)
+	req.Header.Set("If-Modified-Since", since)
+	res := httptest.NewRecorder()
+	mux.ServeHTTP(res, req)
+	if res.Code != http.StatusOK || !strings.Contains(res.Body.String(), `"b"`) || strings.Contains(res.Body.String(), `"a"`) {
+		t.Errorf("list after a delete: status %d, body %s", res.Code, res.Body.String())
+	}
+}
@@ -0,0 +1,185 @@
+package grf
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// Kinds of errors returned by the grf services and handlers.
+// Check for them with errors.Is, e.g. errors.Is(err, grf.ErrNotFound).
+var (
+	ErrNotFound             = errors.New("not found")
+	ErrInvalidID            = errors.New("invalid id")
+	ErrConflict             = errors.New("conflict")
+	ErrValidation           = errors.New("validation failed")
+	ErrTimeout              = errors.New("timeout")
+	ErrBadRequest           = errors.New("bad request")
+	ErrRequestTooLarge      = errors.New("request too large")
+	ErrUnsupportedMediaType = errors.New("unsupported media type")
+	ErrPreconditionFailed   = errors.New("precondition failed")
+	ErrUnauthorized         = errors.New("unauthorized")
+	ErrForbidden            = errors.New("forbidden")
+	ErrTooManyRequests      = errors.New("too many requests")
+	// A conflict with a concurrent transaction. Running the transaction again may succeed, see WithTransaction.
+	ErrTransient = errors.New("transient error")
+)
+
+// HTTP status codes the error kinds are rendered with. Anything else is a 500.
+var errorStatuses = []struct {
+	kind   error
+	status int
+}{
+	{ErrNotFound, http.StatusNotFound},
+	{ErrInvalidID, http.StatusBadRequest},
+	{ErrConflict, http.StatusConflict},
+	{ErrValidation, http.StatusUnprocessableEntity},
+	{ErrTimeout, http.StatusGatewayTimeout},
+	{ErrBadRequest, http.StatusBadRequest},
+	{ErrRequestTooLarge, http.StatusRequestEntityTooLarge},
+	{ErrUnsupportedMediaType, http.StatusUnsupportedMediaType},
+	{ErrPreconditionFailed, http.StatusPreconditionFailed},
+	{ErrUnauthorized, http.StatusUnauthorized},
+	{ErrForbidden, http.StatusForbidden},
+	{ErrTooManyRequests, http.StatusTooManyRequests},
+	{ErrTransient, http.StatusServiceUnavailable},
+}
+
+// Error is an error of a known kind with a message that is safe to show to clients.
+type Error struct {
+	Kind   error
+	Detail string
+	Err    error
+}
+
+func newError(kind error, detail string, err error) *Error {
+	return &Error{Kind: kind, Detail: detail, Err: err}
+}
+
+func (e *Error) Error() string {
+	msg := e.Kind.Error()
+	if e.Detail != "" {
+		msg += ": " + e.Detail
+	}
+	if e.Err != nil {
+		msg += ": " + e.Err.Error()
+	}
+	return msg
+}
+
+func (e *Error) Unwrap() []error {
+	if e.Err == nil {
+		return []error{e.Kind}
+	}
+	return []error{e.Kind, e.Err}
+}
+
+// Returns the HTTP status code for the error.
+func StatusOf(err error) int {
+	for _, s := range errorStatuses {
+		if errors.Is(err, s.kind) {
+			return s.status
+		}
+	}
+	return http.StatusInternalServerError
+}
+
+// Problem is an RFC 7807 problem details object.
+type Problem struct {
+	Type     string `json:"type"`
+	Title    string `json:"title"`
+	Status   int    `json:"status"`
+	Detail   string `json:"detail,omitempty"`
+	Instance string `json:"instance,omitempty"`
+	// Every field that failed validation, for 422 responses.
+	Errors ValidationErrors `json:"errors,omitempty"`
+}
+
+// Writes the error as an application/problem+json response with the matching status code.
+// Details of unknown errors are not sent to the client.
+func WriteError(w http.ResponseWriter, r *http.Request, err error) {
+	recordFailure(r, err)
+	problem := problemOf(err)
+	problem.Instance = r.URL.Path
+	if problem.Status >= http.StatusInternalServerError {
+		log.Println("Error handling", r.Method, r.URL.Path, err)
+	}
+
+	b, err := json.Marshal(problem)
+	if err != nil {
+		log.Println("Error marshalling problem.", err)
+		http.Error(w, problem.Title, problem.Status)
+		return
+	}
+	w.Header().Set("Content-Type", "application/problem+json")
+	w.WriteHeader(problem.Status)
+	fmt.Fprintln(w, string(b))
+}
+
+// Returns the problem details of the error, with what is safe to show to clients.
+func problemOf(err error) Problem {
+	status := StatusOf(err)
+	problem := Problem{
+		Type:   "about:blank",
+		Title:  http.StatusText(status),
+		Status: status,
+	}
+	var grfError *Error
+	if errors.As(err, &grfError) {
+		problem.Detail = grfError.Detail
+	}
+	var validationErrors ValidationErrors
+	if errors.As(err, &validationErrors) {
+		problem.Errors = validationErrors
+		if problem.Detail == "" {
+			problem.Detail = "One or more fields are invalid."
+		}
+	}
+	return problem
+}
+
+// Translates errors from the mongo driver into grf errors.
+func mongoError(err error) error {
+	switch {
+	case err == nil:
+		return nil
+	case errors.Is(err, mongo.ErrNoDocuments):
+		return newError(ErrNotFound, "", err)
+	case mongo.IsDuplicateKeyError(err):
+		return newError(ErrConflict, "an object with the same unique fields already exists", err)
+	case errors.Is(err, context.DeadlineExceeded) || mongo.IsTimeout(err):
+		return newError(ErrTimeout, "the database did not respond in time", err)
+	case isTransient(err):
+		return newError(ErrTransient, "the change conflicted with another one, try again", err)
+	}
+	return err
+}
+
+// Translates errors from decoding a json request body into grf errors.
+func decodeError(err error) error {
+	var unmarshallError *json.UnmarshalTypeError
+	var syntaxError *json.SyntaxError
+	switch {
+	case errors.As(err, &syntaxError):
+		return newError(ErrBadRequest, fmt.Sprintf("Request body contains badly-formed JSON (at position %d)", syntaxError.Offset), err)
+	case errors.As(err, &unmarshallError):
+		return newError(ErrBadRequest, fmt.Sprintf("Request body contains an invalid value for the %q field (at position %d)", unmarshallError.Field, unmarshallError.Offset), err)
+	case errors.Is(err, io.ErrUnexpectedEOF):
+		return newError(ErrBadRequest, "Request body contains badly-formed JSON", err)
+	case strings.HasPrefix(err.Error(), "json: unknown field "):
+		fieldName := strings.TrimPrefix(err.Error(), "json: unknown field ")
+		return newError(ErrBadRequest, fmt.Sprintf("Request body contains unknown field %s", fieldName), err)
+	case errors.Is(err, io.EOF):
+		return newError(ErrBadRequest, "Request body must not be empty", err)
+	case err.Error() == "http: request body too large":
+		return newError(ErrRequestTooLarge, "Request body must not be larger than 1MB", err)
+	}
+	return err
+}
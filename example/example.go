@@ -10,7 +10,6 @@ import (
 	"time"
 
 	grf "github.com/Jyothis-P/go-rest-framework"
-	"github.com/gorilla/mux"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
@@ -20,8 +19,15 @@ import (
 // Make sure to give json and bson structs as necessary.
 type Todo struct {
 	Id        primitive.ObjectID `json:"id,omitempty" bson:"_id,omitempty"`
-	Title     string             `json:"title" bson:"title"`
-	Completed bool               `json:"completed" bson:"completed"`
+	Title     string             `json:"title" bson:"title" grf:"required,max=200,filter,sort"`
+	Completed bool               `json:"completed" bson:"completed" grf:"filter"`
+	// Deleting a project deletes its todos too.
+	ProjectID primitive.ObjectID `json:"projectId,omitempty" bson:"projectId,omitempty" grf:"ref=Project,onDelete=cascade,filter"`
+}
+
+type Project struct {
+	Id   primitive.ObjectID `json:"id,omitempty" bson:"_id,omitempty"`
+	Name string             `json:"name" bson:"name" grf:"required"`
 }
 
 func (todo *Todo) markCompleted(completed bool) {
@@ -43,14 +49,16 @@ func main() {
 		DB: db,
 	}
 
-	// Create a router.
-	r := mux.NewRouter().StrictSlash(true)
+	// Create a router. The standard library's ServeMux works, so does gorilla/mux through gorilla.Mux.
+	r := http.NewServeMux()
+	router := grf.ServeMux(r)
 
 	// Register routes for the model.
-	todoRouter := grf.RegisterCRUDRoutes[Todo]("/todo", r, &appContext)
+	todoRouter := grf.RegisterCRUDRoutes[Todo]("/todo", router, &appContext)
+	grf.RegisterCRUDRoutes[Project]("/project", router, &appContext)
 
-	todoRouter.Handle("/{id}/customDeleteTodo", grf.H{Ctx: &appContext, Fn: customDeleteHandler}).Methods("DELETE")
-	todoRouter.Handle("/{id}/markComplete", grf.H{Ctx: &appContext, Fn: markComplete}).Methods("PUT")
+	todoRouter.Handle(http.MethodDelete, "/{id}/customDeleteTodo", grf.H{Ctx: &appContext, Fn: customDeleteHandler})
+	todoRouter.Handle(http.MethodPut, "/{id}/markComplete", grf.H{Ctx: &appContext, Fn: markComplete})
 
 	// Set up server.
 	const PORT string = "8001"
@@ -87,10 +95,8 @@ func main() {
 
 // Customer Handler function using the generic Delete service.
 func customDeleteHandler(appCtx *grf.Ctx, w http.ResponseWriter, r *http.Request) {
-	vars := mux.Vars(r)
-
 	// You can use any of the generic service functions or your own custom service.
-	err := grf.Delete[Todo](appCtx.DB, vars["id"])
+	err := grf.Delete[Todo](r.Context(), appCtx, grf.PathParam(r, "id"))
 	if err != nil {
 		http.Error(w, "Error deleting TODO.", http.StatusInternalServerError)
 		return
@@ -102,8 +108,7 @@ func customDeleteHandler(appCtx *grf.Ctx, w http.ResponseWriter, r *http.Request
 
 // Custom Handler with a custom service making use of the db connection passed from context.
 func markComplete(appCtx *grf.Ctx, w http.ResponseWriter, r *http.Request) {
-	vars := mux.Vars(r)
-	err := finisherService(appCtx.DB, vars["id"])
+	err := finisherService(appCtx.DB, grf.PathParam(r, "id"))
 	if err != nil {
 		http.Error(w, "Error completing TODO.", http.StatusInternalServerError)
 		return
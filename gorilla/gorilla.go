@@ -0,0 +1,33 @@
+// Package gorilla adapts gorilla/mux routers to grf, so users of http.ServeMux don't depend on gorilla/mux.
+package gorilla
+
+import (
+	"net/http"
+
+	grf "github.com/Jyothis-P/go-rest-framework"
+	"github.com/gorilla/mux"
+)
+
+// Adapts a gorilla/mux router.
+func Mux(r *mux.Router) grf.Router {
+	return muxRouter{r}
+}
+
+type muxRouter struct {
+	router *mux.Router
+}
+
+func (m muxRouter) Handle(method, path string, handler http.Handler) {
+	route := m.router.Handle(path, grf.WithRouter(m, handler))
+	if method != "" {
+		route.Methods(method)
+	}
+}
+
+func (m muxRouter) Group(prefix string) grf.Router {
+	return muxRouter{m.router.PathPrefix(prefix).Subrouter()}
+}
+
+func (m muxRouter) PathValue(r *http.Request, name string) string {
+	return mux.Vars(r)[name]
+}
@@ -0,0 +1,63 @@
+package gorilla_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	grf "github.com/Jyothis-P/go-rest-framework"
+	"github.com/Jyothis-P/go-rest-framework/gorilla"
+	"github.com/gorilla/mux"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type Memo struct {
+	Id    primitive.ObjectID `json:"id,omitempty" bson:"_id,omitempty"`
+	Title string             `json:"title" bson:"title"`
+}
+
+func TestMux(t *testing.T) {
+	r := mux.NewRouter()
+	appCtx := &grf.Ctx{Backend: grf.NewMemoryBackend()}
+	memos := grf.RegisterCRUDRoutes[Memo]("/memo", gorilla.Mux(r), appCtx)
+	memos.Handle(http.MethodGet, "/{id}/title", grf.H{Ctx: appCtx, Fn: func(ctx *grf.Ctx, w http.ResponseWriter, r *http.Request) {
+		var memo Memo
+		if err := grf.ReadOne(r.Context(), ctx, &memo, grf.PathParam(r, "id")); err != nil {
+			grf.WriteError(w, r, err)
+			return
+		}
+		w.Write([]byte(memo.Title))
+	}})
+
+	res := httptest.NewRecorder()
+	r.ServeHTTP(res, httptest.NewRequest(http.MethodPost, "/memo/", strings.NewReader(`{"title": "walk the dog"}`)))
+	if res.Code != http.StatusCreated {
+		t.Fatalf("create: status %d, body %s", res.Code, res.Body.String())
+	}
+	location := res.Header().Get("Location")
+
+	var tests = []struct {
+		method string
+		path   string
+		status int
+		body   string
+	}{
+		{http.MethodGet, location, http.StatusOK, `"title":"walk the dog"`},
+		{http.MethodGet, location + "/title", http.StatusOK, "walk the dog"},
+		{http.MethodGet, "/memo/", http.StatusOK, `[{"id":`},
+		{http.MethodPut, location, http.StatusOK, `"title":"feed the cat"`},
+		{http.MethodDelete, location, http.StatusNoContent, ""},
+		{http.MethodGet, location, http.StatusNotFound, ""},
+	}
+	for _, step := range tests {
+		res := httptest.NewRecorder()
+		r.ServeHTTP(res, httptest.NewRequest(step.method, step.path, strings.NewReader(`{"title": "feed the cat"}`)))
+		if res.Code != step.status {
+			t.Fatalf("%s %s: status %d, want %d", step.method, step.path, res.Code, step.status)
+		}
+		if !strings.Contains(res.Body.String(), step.body) {
+			t.Fatalf("%s %s: body %s, want %s in it", step.method, step.path, res.Body.String(), step.body)
+		}
+	}
+}
@@ -1,7 +1,9 @@
 package grf
 
 import (
+	"errors"
 	"net/http"
+	"time"
 
 	"go.mongodb.org/mongo-driver/mongo"
 )
@@ -10,6 +12,34 @@ import (
 // Handy for keeping values like database connections.
 type Ctx struct {
 	DB *mongo.Database
+	// Storage for the generic services and handlers. Defaults to a MongoBackend over DB.
+	Backend Backend
+	// How long an operation of the generic services may take. Defaults to DefaultTimeout, negative means no limit.
+	// Models can set their own by implementing Timeouter.
+	Timeout time.Duration
+	// Timeouts of specific actions, for every model. They override Timeout.
+	Timeouts map[Action]time.Duration
+	// Names the collections of the models. Defaults to PluralNamer, Todo is stored in todos.
+	CollectionNamer CollectionNamer
+	// Resolve the principal of the requests to the H handlers, tried in order. With any authenticator,
+	// routes refuse anonymous requests unless they are registered with Public.
+	Authenticators []Authenticator
+	// Routes the requests to the H handlers to the database of their tenant. The handlers get a copy of
+	// the app context with the DB of the tenant.
+	TenantDatabases *TenantDatabases
+}
+
+// Returns the Backend the generic services run against.
+func (ctx *Ctx) backend() Backend {
+	if ctx.Backend != nil {
+		return ctx.Backend
+	}
+	return &MongoBackend{DB: ctx.DB}
+}
+
+// Returns the collection the objects of the model are stored in.
+func (ctx *Ctx) collection(model *Model) Collection {
+	return collectionOf(ctx.CollectionNamer, model)
 }
 
 // An adapter for handler functions with an added app context passed in.
@@ -19,6 +49,29 @@ type H struct {
 	Fn func(*Ctx, http.ResponseWriter, *http.Request)
 }
 
+// Authenticates the request, see Ctx.Authenticators, and passes it on to Fn.
+// The principal is in the request context, see PrincipalFrom. With TenantDatabases, Fn gets the app context
+// of the tenant of the request.
 func (appHandler H) ServeHTTP(w http.ResponseWriter, r *http.Request) {
-	appHandler.Fn(appHandler.Ctx, w, r)
+	ctx := appHandler.Ctx
+	if ctx != nil {
+		var err error
+		if r, err = authenticate(ctx, r); err != nil {
+			if errors.Is(err, ErrUnauthorized) {
+				setChallenges(ctx, w)
+			}
+			WriteError(w, r, err)
+			return
+		}
+	}
+	if ctx != nil && ctx.TenantDatabases != nil {
+		tenantCtx, release, err := routeTenant(ctx, r)
+		if err != nil {
+			WriteError(w, r, err)
+			return
+		}
+		defer release()
+		ctx = tenantCtx
+	}
+	appHandler.Fn(ctx, w, r)
 }
@@ -6,99 +6,125 @@ import (
 	"fmt"
 	"io"
 	"log"
+	"mime"
 	"net/http"
-	"strings"
-
-	"github.com/gorilla/mux"
+	"time"
 )
 
 // Function to register the basic CRUD routes given a model.
 // User can register individual routes from the generic handlers.
 // Or they can use this function to generate teh default REST endpoints.
-// Problem comes when it is mongodb which does not support CASCADE delete out of the box and you need a better logic for deleting.
-// Maybe add an optional callback function?
-// Putting a pin on it. [This can be good for atomics]
+// Works with any Router, wrap a gorilla/mux router with Mux or a http.ServeMux with ServeMux.
+// mongodb does not support CASCADE delete out of the box, declare references with `grf:"ref=Model,onDelete=cascade"` instead.
+// Models can implement the lifecycle hooks (BeforeDelete, AfterCreate, ...) to run custom logic around the generic services.
 // [For objects with more complex dependencies, use the handlers you need and create the rest yourself]
-func RegisterCRUDRoutes[T any](pathPrefix string, r *mux.Router, ctx *Ctx) *mux.Router {
-	subRouter := r.PathPrefix(pathPrefix).Subrouter()
-	subRouter.Handle("/", H{Ctx: ctx, Fn: GetAllHandler[T]}).Methods("GET")
-	subRouter.Handle("/{id}", H{Ctx: ctx, Fn: GetHandler[T]}).Methods("GET")
-	subRouter.Handle("/{id}", H{Ctx: ctx, Fn: ReplaceHandler[T]}).Methods("PUT")
-	subRouter.Handle("/", H{Ctx: ctx, Fn: CreateHandler[T]}).Methods("POST")
-	subRouter.Handle("/{id}", H{Ctx: ctx, Fn: DeleteHandler[T]}).Methods("DELETE")
+// Options change the routes, WithLookup serves the objects under other fields than their id.
+func RegisterCRUDRoutes[T any](pathPrefix string, r Router, ctx *Ctx, opts ...RouteOption) Router {
+	RegisterModel[T]()
+	subRouter := r.Group(pathPrefix)
+	// Before the object routes, so /bulk and /trash are not taken for ids.
+	AddBulkRoutes[T](subRouter, ctx, opts...)
+	if isSoftDeleted[T]() {
+		AddTrashRoutes[T](subRouter, ctx, opts...)
+	}
+	AddReadRoutes[T](subRouter, ctx, opts...)
+	AddReplaceRoute[T](subRouter, ctx, opts...)
+	AddUpdateRoute[T](subRouter, ctx, opts...)
+	AddCreateRoute[T](subRouter, ctx, opts...)
+	AddDeleteRoute[T](subRouter, ctx, opts...)
 	return subRouter
 }
 
 // Adds Read and ReadOne routes for type T to the router.
 // GET /
 // GET /{id}
-func AddReadRoutes[T any](r *mux.Router, ctx *Ctx) {
-	r.Handle("/", H{Ctx: ctx, Fn: GetAllHandler[T]}).Methods("GET")
-	r.Handle("/{id}", H{Ctx: ctx, Fn: GetHandler[T]}).Methods("GET")
+func AddReadRoutes[T any](r Router, ctx *Ctx, opts ...RouteOption) {
+	config := newRouteConfig[T](opts)
+	config.handle(r, http.MethodGet, "/", ActionList, ctx, GetAllHandler[T])
+	config.handle(r, http.MethodGet, config.objectPath(), ActionRead, ctx, GetHandler[T])
 }
 
 // Adds Delete route for type T to the router.
 // DELETE /{id}
-func AddDeleteRoute[T any](r *mux.Router, ctx *Ctx) {
-	r.Handle("/{id}", H{Ctx: ctx, Fn: DeleteHandler[T]}).Methods("DELETE")
+func AddDeleteRoute[T any](r Router, ctx *Ctx, opts ...RouteOption) {
+	config := newRouteConfig[T](opts)
+	config.handle(r, http.MethodDelete, config.objectPath(), ActionDelete, ctx, DeleteHandler[T])
 }
 
 // Adds Create route for type T to the router.
 // POST /
 // body must containt the object as defined by the model and its struct tags.
-func AddCreateRoute[T any](r *mux.Router, ctx *Ctx) {
-	r.Handle("/", H{Ctx: ctx, Fn: CreateHandler[T]}).Methods("POST")
+func AddCreateRoute[T any](r Router, ctx *Ctx, opts ...RouteOption) {
+	config := newRouteConfig[T](opts)
+	config.handle(r, http.MethodPost, "/", ActionCreate, ctx, CreateHandler[T])
 }
 
 // Adds Replace route for type T to the router.
 // PUT /{id}
 // body must contain the entire object with the required changes.
 // if any field is not supplied(except _id), it will be reset to its nil value.
-func AddReplaceRoute[T any](r *mux.Router, ctx *Ctx) {
-	r.Handle("/{id}", H{Ctx: ctx, Fn: ReplaceHandler[T]}).Methods("PUT")
+func AddReplaceRoute[T any](r Router, ctx *Ctx, opts ...RouteOption) {
+	config := newRouteConfig[T](opts)
+	config.handle(r, http.MethodPut, config.objectPath(), ActionReplace, ctx, ReplaceHandler[T])
+}
+
+// Adds Update route for type T to the router.
+// PATCH /{id}
+// body must be a JSON Merge Patch (application/merge-patch+json) or a JSON Patch (application/json-patch+json).
+// Only the fields in the patch are changed.
+func AddUpdateRoute[T any](r Router, ctx *Ctx, opts ...RouteOption) {
+	config := newRouteConfig[T](opts)
+	config.handle(r, http.MethodPatch, config.objectPath(), ActionUpdate, ctx, UpdateHandler[T])
+}
+
+// Adds the trash routes for the soft deleted type T to the router.
+// GET /trash
+// POST /{id}/restore
+// DELETE /trash/{id}
+func AddTrashRoutes[T any](r Router, ctx *Ctx, opts ...RouteOption) {
+	config := newRouteConfig[T](opts)
+	config.handle(r, http.MethodGet, "/trash", ActionList, ctx, TrashHandler[T])
+	config.handle(r, http.MethodPost, config.objectPath()+"/restore", ActionUpdate, ctx, RestoreHandler[T])
+	config.handle(r, http.MethodDelete, "/trash"+config.objectPath(), ActionDelete, ctx, PurgeHandler[T])
 }
 
+// Responds with the object with the given id, its ETag and, for models with an updatedAt field, Last-Modified.
+// Responds 304 Not Modified to If-None-Match and If-Modified-Since when the client's copy is current.
 func GetHandler[K any](ctx *Ctx, w http.ResponseWriter, r *http.Request) {
-	vars := mux.Vars(r)
 	var object K
-	err := ReadOne(ctx.DB, &object, vars["id"])
-	if err != nil {
-		log.Print("Error retrieving object.")
-		log.Print(err.Error())
-		w.WriteHeader(http.StatusInternalServerError)
-		return
+	err := ReadOneBy(r.Context(), ctx, &object, requestLookup(r))
+	if err == nil {
+		err = checkObjectPermissions(r, ActionRead, &object)
 	}
-	b, err := json.Marshal(object)
 	if err != nil {
-		log.Print("Error marshalling.")
+		log.Print("Error retrieving object.")
 		log.Print(err.Error())
-		w.WriteHeader(http.StatusInternalServerError)
+		WriteError(w, r, err)
 		return
 	}
-	w.WriteHeader(http.StatusOK)
-	fmt.Fprintln(w, string(b))
+	writeCacheable(w, r, object, ETag(&object), lastModified(&object))
 }
 
+// Lists the objects of type K.
+// Supports limit, offset/page, sort and field filters in the query string. See ParseQuery.
+// The ETag is a hash of the list, clients validate their copy with If-None-Match.
 func GetAllHandler[K any](ctx *Ctx, w http.ResponseWriter, r *http.Request) {
-	var objects []K
-	err := Read(ctx.DB, &objects)
-	log.Println(objects)
+	query, err := ParseQuery[K](r.URL.Query())
 	if err != nil {
-		w.WriteHeader(http.StatusInternalServerError)
-		fmt.Fprintln(w, "Error getting all objects.")
+		log.Println("Error parsing the query.", err)
+		WriteError(w, r, newError(ErrBadRequest, err.Error(), err))
 		return
 	}
 
-	log.Println(objects)
-	b, err := json.Marshal(objects)
+	var objects []K
+	err = ReadQuery(r.Context(), ctx, &objects, query)
 	if err != nil {
-		log.Print("Error marshalling.")
-		log.Print(err.Error())
-		w.WriteHeader(http.StatusInternalServerError)
+		log.Println("Error getting all objects.", err)
+		WriteError(w, r, err)
 		return
 	}
-	w.WriteHeader(http.StatusOK)
-	fmt.Fprintln(w, string(b))
+	// The latest updatedAt doesn't tell whether objects were deleted or scoped out, so lists have no Last-Modified.
+	writeCacheable(w, r, objects, "", time.Time{})
 }
 
 func CreateHandler[T any](ctx *Ctx, w http.ResponseWriter, r *http.Request) {
@@ -110,30 +136,30 @@ func CreateHandler[T any](ctx *Ctx, w http.ResponseWriter, r *http.Request) {
 
 	// Let the gatekeeping begin.
 	if err != nil {
-		log.Println("Error decoding the object from the request.")
-		msg, statusCode := validateJsonError(err)
-		http.Error(w, msg, statusCode)
-		log.Println(msg)
+		log.Println("Error decoding the object from the request.", err)
+		WriteError(w, r, decodeError(err))
 		return
 	}
 
 	log.Println("Decoded object: ", object)
 
 	// Attempting to save the object to the db.
-	res, err := Create(ctx.DB, object)
+	err = Create(r.Context(), ctx, &object)
 
 	if err != nil {
 		log.Print("Error saving object to db.")
 		log.Print(err.Error())
-		w.WriteHeader(http.StatusInternalServerError)
+		WriteError(w, r, err)
 		return
 	}
-	w.WriteHeader(http.StatusOK)
-	fmt.Fprintf(w, "Object created!, id: %s", *res)
+	w.Header().Set("Location", objectLocation(r, &object))
+	w.Header().Set("ETag", ETag(&object))
+	writeJSON(w, r, http.StatusCreated, object)
 }
 
+// Replaces the object with the given id.
+// With an If-Match header, only while its ETag is one of the given ones. Responds 412 otherwise.
 func ReplaceHandler[T any](ctx *Ctx, w http.ResponseWriter, r *http.Request) {
-	vars := mux.Vars(r)
 	decoder := json.NewDecoder(r.Body)
 	decoder.DisallowUnknownFields()
 
@@ -142,71 +168,164 @@ func ReplaceHandler[T any](ctx *Ctx, w http.ResponseWriter, r *http.Request) {
 
 	// Let the gatekeeping begin.
 	if err != nil {
-		log.Println("Error decoding the object from the request.")
-		msg, statusCode := validateJsonError(err)
-		http.Error(w, msg, statusCode)
-		log.Println(msg)
+		log.Println("Error decoding the object from the request.", err)
+		WriteError(w, r, decodeError(err))
 		return
 	}
 
 	log.Println("Decoded object: ", object)
 
-	// Attempting to save the object to the db.
-	err = ReplaceOne(ctx.DB, &object, vars["id"])
+	// Attempting to save the object to the db, as long as it is still the version the client has seen.
+	filter, err := lookupFilter[T](requestLookup(r))
+	if err == nil {
+		err = authorizeObject[T](r.Context(), ctx, r, ActionReplace, withoutDeleted[T](filter))
+	}
+	if err == nil {
+		err = replaceOne(r.Context(), ctx, &object, filter, r.Header.Get("If-Match"))
+	}
 	if err != nil {
 		log.Print("Error replacing object in db.")
 		log.Print(err.Error())
-		w.WriteHeader(http.StatusInternalServerError)
+		WriteError(w, r, err)
 		return
 	}
-	w.WriteHeader(http.StatusOK)
-	fmt.Fprintf(w, "Object updated!")
+	w.Header().Set("ETag", ETag(&object))
+	writeJSON(w, r, http.StatusOK, object)
 }
 
-func DeleteHandler[T any](ctx *Ctx, w http.ResponseWriter, r *http.Request) {
-	vars := mux.Vars(r)
-
-	// Adding additional checks in this generic function would be difficult.
-	// mongodb does not support cascade deletes.
-	// If you need more validation and dependency checking, please use a seperate handler for the same.
-	err := Delete[T](ctx.DB, vars["id"])
-	if err != nil {
-		http.Error(w, "Error deleting object.", http.StatusInternalServerError)
-		return
-	}
-
-	w.WriteHeader(http.StatusOK)
-	fmt.Fprintln(w, "Object deleted.")
-}
-
-func validateJsonError(err error) (string, int) {
-	msg := ""
-	var statusCode int
-	var unmarshallError *json.UnmarshalTypeError
-	var syntaxError *json.SyntaxError
-	switch {
-	case errors.As(err, &syntaxError):
-		msg = fmt.Sprintf("Request body contains badly-formed JSON (at position %d)", syntaxError.Offset)
-		statusCode = http.StatusBadRequest
-	case errors.As(err, &unmarshallError):
-		msg = fmt.Sprintf("Request body contains an invalid value for the %q field (at position %d)", unmarshallError.Field, unmarshallError.Offset)
-		statusCode = http.StatusBadRequest
-	case errors.Is(err, io.ErrUnexpectedEOF):
-		msg = "Request body contains badly-formed JSON"
-		statusCode = http.StatusBadRequest
-	case strings.HasPrefix(err.Error(), "json: unknown field "):
-		fieldName := strings.TrimPrefix(err.Error(), "json: unknown field ")
-		msg = fmt.Sprintf("Request body contains unknown field %s", fieldName)
-		statusCode = http.StatusBadRequest
-	case errors.Is(err, io.EOF):
-		msg = "Request body must not be empty"
-		statusCode = http.StatusBadRequest
-	case err.Error() == "http: request body too large":
-		msg = "Request body must not be larger than 1MB"
-		statusCode = http.StatusRequestEntityTooLarge
+// Partially updates the object with the given id, or the fields set up with WithLookup.
+// application/json bodies are treated as merge patches.
+func UpdateHandler[T any](ctx *Ctx, w http.ResponseWriter, r *http.Request) {
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		log.Println("Error reading the request body.", err)
+		WriteError(w, r, decodeError(err))
+		return
+	}
+
+	var patch Patch
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	switch mediaType {
+	case MergePatchMediaType, "application/json", "":
+		patch, err = ParseMergePatch[T](body)
+	case JSONPatchMediaType:
+		patch, err = ParseJSONPatch[T](body)
 	default:
-		msg = http.StatusText(http.StatusInternalServerError)
-		statusCode = http.StatusInternalServerError
+		w.Header().Set("Accept-Patch", MergePatchMediaType+", "+JSONPatchMediaType)
+		WriteError(w, r, newError(ErrUnsupportedMediaType, "unsupported patch format "+mediaType, nil))
+		return
+	}
+	if err != nil {
+		log.Println("Error parsing the patch.", err)
+		if !errors.Is(err, ErrValidation) {
+			err = newError(ErrBadRequest, err.Error(), err)
+		}
+		WriteError(w, r, err)
+		return
+	}
+
+	var object T
+	filter, err := lookupFilter[T](requestLookup(r))
+	if err == nil {
+		err = authorizeObject[T](r.Context(), ctx, r, ActionUpdate, withoutDeleted[T](filter))
+	}
+	if err == nil {
+		err = updateOne(r.Context(), ctx, &object, filter, patch)
+	}
+	if err != nil {
+		log.Print("Error updating object in db.")
+		log.Print(err.Error())
+		WriteError(w, r, err)
+		return
+	}
+	w.Header().Set("ETag", ETag(&object))
+	writeJSON(w, r, http.StatusOK, object)
+}
+
+// Deletes the object with the given id. Honours If-Match like ReplaceHandler.
+func DeleteHandler[T any](ctx *Ctx, w http.ResponseWriter, r *http.Request) {
+	// mongodb does not support cascade deletes, Delete enforces the references declared on registered models instead.
+	// If you need more validation and dependency checking, use the delete hooks or a seperate handler for the same.
+	filter, err := lookupFilter[T](requestLookup(r))
+	if err == nil {
+		err = authorizeObject[T](r.Context(), ctx, r, ActionDelete, withoutDeleted[T](filter))
+	}
+	if err == nil {
+		err = deleteOne[T](r.Context(), ctx, filter, r.Header.Get("If-Match"))
+	}
+	if err != nil {
+		log.Println("Error deleting object.", err)
+		WriteError(w, r, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// Lists the soft deleted objects of type K. Takes the same query string as GetAllHandler.
+func TrashHandler[K any](ctx *Ctx, w http.ResponseWriter, r *http.Request) {
+	query, err := ParseQuery[K](r.URL.Query())
+	if err != nil {
+		log.Println("Error parsing the query.", err)
+		WriteError(w, r, newError(ErrBadRequest, err.Error(), err))
+		return
+	}
+
+	var objects []K
+	err = ReadTrash(r.Context(), ctx, &objects, query)
+	if err != nil {
+		log.Println("Error getting the trash.", err)
+		WriteError(w, r, err)
+		return
+	}
+	writeJSON(w, r, http.StatusOK, objects)
+}
+
+// Takes a soft deleted object out of the trash and responds with it.
+func RestoreHandler[T any](ctx *Ctx, w http.ResponseWriter, r *http.Request) {
+	var object T
+	filter, err := lookupFilter[T](requestLookup(r))
+	if err == nil {
+		err = authorizeObject[T](r.Context(), ctx, r, ActionUpdate, onlyDeleted[T](filter))
+	}
+	if err == nil {
+		err = restore(r.Context(), ctx, &object, filter)
+	}
+	if err != nil {
+		log.Println("Error restoring object.", err)
+		WriteError(w, r, err)
+		return
+	}
+	writeJSON(w, r, http.StatusOK, object)
+}
+
+// Permanently deletes a soft deleted object from the trash.
+func PurgeHandler[T any](ctx *Ctx, w http.ResponseWriter, r *http.Request) {
+	filter, err := lookupFilter[T](requestLookup(r))
+	if err == nil {
+		err = authorizeObject[T](r.Context(), ctx, r, ActionDelete, onlyDeleted[T](filter))
+	}
+	if err == nil {
+		err = purge[T](r.Context(), ctx, filter)
+	}
+	if err != nil {
+		log.Println("Error purging object.", err)
+		WriteError(w, r, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// Writes the value as a json response with the given status code.
+func writeJSON(w http.ResponseWriter, r *http.Request, status int, v any) {
+	b, err := json.Marshal(v)
+	if err != nil {
+		log.Print("Error marshalling.")
+		log.Print(err.Error())
+		WriteError(w, r, err)
+		return
 	}
-	return msg, statusCode
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	fmt.Fprintln(w, string(b))
 }
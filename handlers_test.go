@@ -2,11 +2,14 @@ package grf_test
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
 	"log"
 	"net/http"
 	"net/http/httptest"
 	"regexp"
+	"strings"
 	"testing"
 
 	grf "github.com/Jyothis-P/go-rest-framework"
@@ -49,8 +52,12 @@ func TestCreateHandler(t *testing.T) {
 		}
 		grf.CreateHandler[Todo](&appContext, res, req)
 
-		// Regex pattern to match the string with a changeable ObjectID
-		pattern := `Object created!, id: \{ObjectID\("[0-9a-fA-F]{24}"\)}`
+		if res.Code != http.StatusCreated {
+			t.Fatalf("Status is %d. Expected: %d", res.Code, http.StatusCreated)
+		}
+
+		// Regex pattern to match the location with a changeable ObjectID
+		pattern := `^/todo/([0-9a-fA-F]{24})$`
 
 		// Compile the regex pattern
 		r, err := regexp.Compile(pattern)
@@ -59,12 +66,141 @@ func TestCreateHandler(t *testing.T) {
 			return
 		}
 
-		act := res.Body.String()
-		exp := `Object created!, id: \{ObjectID\("[0-9a-fA-F]{24}"\)}`
-		// Check if the pattern matches the string
-		match := r.MatchString(res.Body.String())
-		if !match {
-			t.Fatalf("Response is %s. Expected: %s", act, exp)
+		location := res.Header().Get("Location")
+		match := r.FindStringSubmatch(location)
+		if match == nil {
+			t.Fatalf("Location is %s. Expected: %s", location, pattern)
+		}
+
+		var created Todo
+		if err := json.Unmarshal(res.Body.Bytes(), &created); err != nil {
+			t.Fatalf("Response is not a Todo: %s", res.Body.String())
+		}
+		if created.Id.Hex() != match[1] {
+			t.Fatalf("Id is %s. Expected: %s", created.Id.Hex(), match[1])
+		}
+		if created.Title != testTodo.Title {
+			t.Fatalf("Title is %s. Expected: %s", created.Title, testTodo.Title)
+		}
+	})
+}
+
+func TestErrorResponses(t *testing.T) {
+
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+
+	mt.Run("Invalid id is a bad request", func(mt *mtest.T) {
+		req := httptest.NewRequest("GET", "http://localhost:8001/todo/nope", nil)
+		req.SetPathValue("id", "nope")
+		res := httptest.NewRecorder()
+
+		grf.GetHandler[Todo](&grf.Ctx{DB: mt.DB}, res, req)
+		assertProblem(t, res, http.StatusBadRequest)
+	})
+
+	mt.Run("Missing object is not found", func(mt *mtest.T) {
+		id := primitive.NewObjectID().Hex()
+		req := httptest.NewRequest("GET", "http://localhost:8001/todo/"+id, nil)
+		req.SetPathValue("id", id)
+		res := httptest.NewRecorder()
+
+		mt.AddMockResponses(mtest.CreateCursorResponse(0, "test_db.todos", mtest.FirstBatch))
+		grf.GetHandler[Todo](&grf.Ctx{DB: mt.DB}, res, req)
+		assertProblem(t, res, http.StatusNotFound)
+	})
+
+	mt.Run("Duplicate key is a conflict", func(mt *mtest.T) {
+		jsonTodo, err := json.Marshal(testTodo)
+		if err != nil {
+			t.Fatal(err)
+		}
+		req := httptest.NewRequest("POST", "http://localhost:8001/todo/", bytes.NewReader(jsonTodo))
+		res := httptest.NewRecorder()
+
+		mt.AddMockResponses(mtest.CreateWriteErrorsResponse(mtest.WriteError{Index: 0, Code: 11000, Message: "duplicate key error"}))
+		grf.CreateHandler[Todo](&grf.Ctx{DB: mt.DB}, res, req)
+		assertProblem(t, res, http.StatusConflict)
+	})
+
+	mt.Run("Malformed body is a bad request", func(mt *mtest.T) {
+		req := httptest.NewRequest("POST", "http://localhost:8001/todo/", strings.NewReader(`{"title": `))
+		res := httptest.NewRecorder()
+
+		grf.CreateHandler[Todo](&grf.Ctx{DB: mt.DB}, res, req)
+		assertProblem(t, res, http.StatusBadRequest)
+	})
+}
+
+func assertProblem(t *testing.T, res *httptest.ResponseRecorder, status int) {
+	t.Helper()
+	if res.Code != status {
+		t.Fatalf("Status is %d. Expected: %d. Body: %s", res.Code, status, res.Body.String())
+	}
+	if ct := res.Header().Get("Content-Type"); ct != "application/problem+json" {
+		t.Fatalf("Content-Type is %q. Expected: application/problem+json", ct)
+	}
+	var problem grf.Problem
+	if err := json.Unmarshal(res.Body.Bytes(), &problem); err != nil {
+		t.Fatalf("Body is not a problem: %v", err)
+	}
+	if problem.Status != status {
+		t.Fatalf("Problem status is %d. Expected: %d", problem.Status, status)
+	}
+}
+
+// A todo that refuses the title rest, fails on crash and shouts the others.
+type LoudTodo struct {
+	Id    primitive.ObjectID `json:"id,omitempty" bson:"_id,omitempty"`
+	Title string             `json:"title" bson:"title"`
+}
+
+func (t *LoudTodo) BeforeCreate(ctx context.Context, appCtx *grf.Ctx) error {
+	if t.Title == "rest" {
+		return &grf.Error{Kind: grf.ErrValidation, Detail: "no resting allowed"}
+	}
+	if t.Title == "crash" {
+		return errors.New("dial tcp 10.0.0.1:27017: connection refused")
+	}
+	t.Title = strings.ToUpper(t.Title)
+	return nil
+}
+
+func TestCreateHooks(t *testing.T) {
+
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+
+	mt.Run("Before hook changes are saved", func(mt *mtest.T) {
+		req := httptest.NewRequest("POST", "http://localhost:8001/loudtodo/", strings.NewReader(`{"title": "walk"}`))
+		res := httptest.NewRecorder()
+
+		mt.AddMockResponses(mtest.CreateSuccessResponse())
+		grf.CreateHandler[LoudTodo](&grf.Ctx{DB: mt.DB}, res, req)
+
+		var created LoudTodo
+		if err := json.Unmarshal(res.Body.Bytes(), &created); err != nil {
+			t.Fatalf("Response is not a LoudTodo: %s", res.Body.String())
+		}
+		if created.Title != "WALK" {
+			t.Fatalf("Title is %s. Expected: WALK", created.Title)
+		}
+	})
+
+	mt.Run("Before hook error aborts", func(mt *mtest.T) {
+		req := httptest.NewRequest("POST", "http://localhost:8001/loudtodo/", strings.NewReader(`{"title": "rest"}`))
+		res := httptest.NewRecorder()
+
+		grf.CreateHandler[LoudTodo](&grf.Ctx{DB: mt.DB}, res, req)
+		assertProblem(t, res, http.StatusUnprocessableEntity)
+	})
+
+	mt.Run("Before hook failure is a server error", func(mt *mtest.T) {
+		req := httptest.NewRequest("POST", "http://localhost:8001/loudtodo/", strings.NewReader(`{"title": "crash"}`))
+		res := httptest.NewRecorder()
+
+		grf.CreateHandler[LoudTodo](&grf.Ctx{DB: mt.DB}, res, req)
+		assertProblem(t, res, http.StatusInternalServerError)
+		if strings.Contains(res.Body.String(), "10.0.0.1") {
+			t.Errorf("the details of the failure were sent to the client: %s", res.Body.String())
 		}
 	})
 }
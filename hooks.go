@@ -0,0 +1,116 @@
+package grf
+
+import (
+	"context"
+	"errors"
+)
+
+// Lifecycle hooks a model can implement to run custom logic around the generic services.
+// Hooks get the context of the operation and the app context, so they can use the database too.
+//
+// An error from a Before hook aborts the operation. Errors that are not grf errors are reported to
+// clients as validation failures (422). An error from an After hook is returned from the service,
+// but the change to the database has already been made.
+
+// Called by Create before the object is inserted. Changes to the object are saved.
+type BeforeCreator interface {
+	BeforeCreate(ctx context.Context, appCtx *Ctx) error
+}
+
+// Called by Create after the object is inserted. The id of the object is set.
+type AfterCreator interface {
+	AfterCreate(ctx context.Context, appCtx *Ctx) error
+}
+
+// Called by ReplaceOne before the stored object is replaced. Changes to the object are saved.
+type BeforeReplacer interface {
+	BeforeReplace(ctx context.Context, appCtx *Ctx) error
+}
+
+// Called by ReplaceOne after the stored object is replaced.
+type AfterReplacer interface {
+	AfterReplace(ctx context.Context, appCtx *Ctx) error
+}
+
+// Called by Delete on the stored object before it is deleted.
+type BeforeDeleter interface {
+	BeforeDelete(ctx context.Context, appCtx *Ctx) error
+}
+
+// Called by Delete on the stored object after it is deleted.
+type AfterDeleter interface {
+	AfterDelete(ctx context.Context, appCtx *Ctx) error
+}
+
+// Called by Read, ReadQuery and ReadOne on every object read from the database.
+type AfterReader interface {
+	AfterRead(ctx context.Context, appCtx *Ctx) error
+}
+
+// Reports the field errors of a Before hook as a 422, like those of Validate. Other errors are left as they are,
+// so errors of no kind are a 500 and their details are not sent to the client.
+func beforeHookError(err error) error {
+	var grfError *Error
+	var fields ValidationErrors
+	if !errors.As(err, &grfError) && errors.As(err, &fields) {
+		return newError(ErrValidation, "", err)
+	}
+	return err
+}
+
+func beforeCreate(ctx context.Context, appCtx *Ctx, object any) error {
+	if hook, ok := object.(BeforeCreator); ok {
+		return beforeHookError(hook.BeforeCreate(ctx, appCtx))
+	}
+	return nil
+}
+
+func afterCreate(ctx context.Context, appCtx *Ctx, object any) error {
+	if hook, ok := object.(AfterCreator); ok {
+		return hook.AfterCreate(ctx, appCtx)
+	}
+	return nil
+}
+
+func beforeReplace(ctx context.Context, appCtx *Ctx, object any) error {
+	if hook, ok := object.(BeforeReplacer); ok {
+		return beforeHookError(hook.BeforeReplace(ctx, appCtx))
+	}
+	return nil
+}
+
+func afterReplace(ctx context.Context, appCtx *Ctx, object any) error {
+	if hook, ok := object.(AfterReplacer); ok {
+		return hook.AfterReplace(ctx, appCtx)
+	}
+	return nil
+}
+
+func beforeDelete(ctx context.Context, appCtx *Ctx, object any) error {
+	if hook, ok := object.(BeforeDeleter); ok {
+		return beforeHookError(hook.BeforeDelete(ctx, appCtx))
+	}
+	return nil
+}
+
+func afterDelete(ctx context.Context, appCtx *Ctx, object any) error {
+	if hook, ok := object.(AfterDeleter); ok {
+		return hook.AfterDelete(ctx, appCtx)
+	}
+	return nil
+}
+
+func afterRead(ctx context.Context, appCtx *Ctx, object any) error {
+	if hook, ok := object.(AfterReader); ok {
+		return hook.AfterRead(ctx, appCtx)
+	}
+	return nil
+}
+
+// Reports whether the model K has hooks around deletes, in which case the object is loaded first.
+func hasDeleteHooks[K any]() bool {
+	var object any = new(K)
+	_, before := object.(BeforeDeleter)
+	_, after := object.(AfterDeleter)
+	return before || after
+}
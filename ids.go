@@ -0,0 +1,139 @@
+package grf
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"github.com/google/uuid"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// How the ids of a model are generated on create and parsed on lookup.
+// Picked with a tag on the id field, `grf:"id=uuidv7"`. Without one, ObjectID fields use IDObjectID,
+// integer fields IDAutoIncrement and everything else IDString.
+const (
+	// A mongodb ObjectID, in URLs as 24 hex characters.
+	IDObjectID = "objectid"
+	// A random UUID (version 4) in a string field.
+	IDUUID = "uuid"
+	// A time ordered UUID (version 7) in a string field.
+	IDUUIDv7 = "uuidv7"
+	// A string the caller supplies, like a slug. Creating an object without one fails.
+	IDString = "string"
+	// The next integer of a sequence kept in the counters collection, starting at 1.
+	IDAutoIncrement = "autoincrement"
+)
+
+// The collection holding the sequences of IDAutoIncrement models, one document per collection.
+const CountersCollection = "counters"
+
+// A sequence of ids in the counters collection.
+type counter struct {
+	Name string `bson:"_id"`
+	Seq  int64  `bson:"seq"`
+}
+
+// Returns the id strategy of the model's id field.
+func idStrategy(field *Field) (string, error) {
+	if strategy, ok := field.Options.Get("id"); ok {
+		switch strategy = strings.ToLower(strategy); strategy {
+		case IDObjectID, IDUUID, IDUUIDv7, IDString, IDAutoIncrement:
+			return strategy, nil
+		}
+		return "", fmt.Errorf("%s has an unknown id strategy %q", field.Name, strategy)
+	}
+	switch {
+	case indirect(field.Type) == objectIDType:
+		return IDObjectID, nil
+	case isIntegerID(field):
+		return IDAutoIncrement, nil
+	}
+	return IDString, nil
+}
+
+// Sets a new id on the object if it has none, following the strategy of the collection's model.
+func generateID(ctx context.Context, backend Backend, c Collection, object any) error {
+	field := c.Model.IDField()
+	if field == nil || !reflect.ValueOf(object).Elem().FieldByIndex(field.Index).IsZero() {
+		return nil
+	}
+	strategy, err := idStrategy(field)
+	if err != nil {
+		return err
+	}
+
+	var id any
+	switch strategy {
+	case IDObjectID:
+		id = primitive.NewObjectID()
+	case IDUUID:
+		id = uuid.NewString()
+	case IDUUIDv7:
+		v7, err := uuid.NewV7()
+		if err != nil {
+			return err
+		}
+		id = v7.String()
+	case IDString:
+		return newError(ErrValidation, "", ValidationErrors{{Field: field.JSONName, Message: "is required"}})
+	case IDAutoIncrement:
+		if id, err = nextSequence(ctx, backend, c.Name); err != nil {
+			return err
+		}
+	}
+	setID(object, id)
+	return nil
+}
+
+// Returns the next value of the named sequence. The counter is created on first use.
+func nextSequence(ctx context.Context, backend Backend, name string) (int64, error) {
+	counters := Collection{Name: CountersCollection, Model: getModel[counter]()}
+	filter := Filter{{Field: "_id", Op: OpEq, Value: name}}
+	for {
+		var next counter
+		err := backend.UpdateOne(ctx, counters, filter, Patch{Inc: map[string]any{"seq": int64(1)}}, &next)
+		if err == nil {
+			return next.Seq, nil
+		}
+		if !errors.Is(err, ErrNotFound) {
+			return 0, err
+		}
+		_, err = backend.Insert(ctx, counters, &counter{Name: name, Seq: 1})
+		if err == nil {
+			return 1, nil
+		}
+		// Someone else created the counter in the meantime, incrementing it again.
+		if !errors.Is(err, ErrConflict) {
+			return 0, err
+		}
+	}
+}
+
+// Converts an id from a URL into the value stored in the model's id field.
+func parseID(field *Field, id string) (any, error) {
+	strategy, err := idStrategy(field)
+	if err != nil {
+		return nil, err
+	}
+	switch strategy {
+	case IDObjectID:
+		return parseObjectID(id)
+	case IDUUID, IDUUIDv7:
+		parsed, err := uuid.Parse(id)
+		if err != nil {
+			return nil, newError(ErrInvalidID, fmt.Sprintf("%q is not a valid id", id), err)
+		}
+		return parsed.String(), nil
+	case IDAutoIncrement:
+		number, err := strconv.ParseInt(id, 10, 64)
+		if err != nil {
+			return nil, newError(ErrInvalidID, fmt.Sprintf("%q is not a valid id", id), err)
+		}
+		return number, nil
+	}
+	return id, nil
+}
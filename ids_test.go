@@ -0,0 +1,115 @@
+package grf
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type ObjectIDThing struct {
+	Id   primitive.ObjectID `json:"id,omitempty" bson:"_id,omitempty"`
+	Name string             `json:"name" bson:"name"`
+}
+
+type UUIDThing struct {
+	Id   string `json:"id" bson:"_id" grf:"id=uuid"`
+	Name string `json:"name" bson:"name"`
+}
+
+type UUIDv7Thing struct {
+	Id   string `json:"id" bson:"_id" grf:"id=uuidv7"`
+	Name string `json:"name" bson:"name"`
+}
+
+type SlugThing struct {
+	Id   string `json:"id" bson:"_id"`
+	Name string `json:"name" bson:"name"`
+}
+
+type SequenceThing struct {
+	Id   int    `json:"id" bson:"_id"`
+	Name string `json:"name" bson:"name"`
+}
+
+func TestIDStrategies(t *testing.T) {
+	uuid := `[0-9a-f]{8}-[0-9a-f]{4}-%s[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}`
+	var tests = []struct {
+		name     string
+		register func(r Router, appCtx *Ctx)
+		body     string
+		location string
+		invalid  string
+	}{
+		{"objectid", func(r Router, appCtx *Ctx) { RegisterCRUDRoutes[ObjectIDThing]("/things", r, appCtx) }, `{"name": "a"}`, `[0-9a-f]{24}`, "nope"},
+		{"uuid", func(r Router, appCtx *Ctx) { RegisterCRUDRoutes[UUIDThing]("/things", r, appCtx) }, `{"name": "a"}`, strings.Replace(uuid, "%s", "4", 1), "nope"},
+		{"uuidv7", func(r Router, appCtx *Ctx) { RegisterCRUDRoutes[UUIDv7Thing]("/things", r, appCtx) }, `{"name": "a"}`, strings.Replace(uuid, "%s", "7", 1), "nope"},
+		{"string", func(r Router, appCtx *Ctx) { RegisterCRUDRoutes[SlugThing]("/things", r, appCtx) }, `{"id": "first-thing", "name": "a"}`, `first-thing`, ""},
+		{"autoincrement", func(r Router, appCtx *Ctx) { RegisterCRUDRoutes[SequenceThing]("/things", r, appCtx) }, `{"name": "a"}`, `1`, "nope"},
+	}
+	for name, appCtx := range backendContexts(t) {
+		for _, tt := range tests {
+			t.Run(name+"/"+tt.name, func(t *testing.T) {
+				mux := http.NewServeMux()
+				tt.register(ServeMux(mux), appCtx)
+
+				res := httptest.NewRecorder()
+				mux.ServeHTTP(res, httptest.NewRequest(http.MethodPost, "/things/", strings.NewReader(tt.body)))
+				if res.Code != http.StatusCreated {
+					t.Fatalf("create: status %d, body %s", res.Code, res.Body.String())
+				}
+				location := res.Header().Get("Location")
+				if !regexp.MustCompile(`^/things/` + tt.location + `$`).MatchString(location) {
+					t.Fatalf("Location is %s, want /things/%s", location, tt.location)
+				}
+
+				for _, method := range []string{http.MethodGet, http.MethodPut, http.MethodDelete} {
+					res = httptest.NewRecorder()
+					mux.ServeHTTP(res, httptest.NewRequest(method, location, strings.NewReader(`{"name": "b"}`)))
+					if res.Code >= 300 {
+						t.Fatalf("%s %s: status %d, body %s", method, location, res.Code, res.Body.String())
+					}
+				}
+
+				if tt.invalid != "" {
+					res = httptest.NewRecorder()
+					mux.ServeHTTP(res, httptest.NewRequest(http.MethodGet, "/things/"+tt.invalid, nil))
+					if res.Code != http.StatusBadRequest {
+						t.Errorf("invalid id: status %d, want %d", res.Code, http.StatusBadRequest)
+					}
+				}
+			})
+		}
+	}
+}
+
+func TestAutoIncrementSequence(t *testing.T) {
+	for name, appCtx := range backendContexts(t) {
+		t.Run(name, func(t *testing.T) {
+			repository := RepositoryFor[SequenceThing](appCtx)
+			for want := 1; want <= 3; want++ {
+				thing := SequenceThing{Name: "a"}
+				if err := repository.Create(context.Background(), &thing); err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				if thing.Id != want {
+					t.Errorf("got id %d, want %d", thing.Id, want)
+				}
+			}
+		})
+	}
+}
+
+func TestStringIDIsRequired(t *testing.T) {
+	mux := http.NewServeMux()
+	RegisterCRUDRoutes[SlugThing]("/things", ServeMux(mux), &Ctx{Backend: NewMemoryBackend()})
+	res := httptest.NewRecorder()
+	mux.ServeHTTP(res, httptest.NewRequest(http.MethodPost, "/things/", strings.NewReader(`{"name": "a"}`)))
+	if res.Code != http.StatusUnprocessableEntity {
+		t.Errorf("status %d, want %d", res.Code, http.StatusUnprocessableEntity)
+	}
+}
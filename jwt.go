@@ -0,0 +1,210 @@
+package grf
+
+import (
+	"crypto"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	_ "crypto/sha256"
+	_ "crypto/sha512"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+)
+
+// JWTAuthenticator authenticates requests with a JSON Web Token in an "Authorization: Bearer <token>" header.
+// Tokens are signed with HMAC (HS256, HS384, HS512) or RSA (RS256, RS384, RS512) depending on the key.
+// The principal is the subject of the token, its roles are in the "roles" claim, its tenant in the "tenant" claim
+// and every claim is in Claims.
+type JWTAuthenticator struct {
+	// The key the tokens are verified with: the secret for HMAC as a []byte, a *rsa.PublicKey for RSA.
+	Key any
+	// The issuer the tokens must be from, any when empty.
+	Issuer string
+	// The audience the tokens must be for, any when empty.
+	Audience string
+	// How far the clocks of the issuer and the server may be apart, for the expiry of tokens.
+	Leeway time.Duration
+	// The claim with the roles of the principal, a list of strings. Defaults to "roles".
+	RolesClaim string
+	// The claim with the tenant of the principal. Defaults to "tenant".
+	TenantClaim string
+}
+
+// The hash functions of the supported signing algorithms.
+var jwtHashes = map[string]crypto.Hash{
+	"HS256": crypto.SHA256, "HS384": crypto.SHA384, "HS512": crypto.SHA512,
+	"RS256": crypto.SHA256, "RS384": crypto.SHA384, "RS512": crypto.SHA512,
+}
+
+func (a JWTAuthenticator) Authenticate(ctx *Ctx, r *http.Request) (*Principal, error) {
+	scheme, token, found := strings.Cut(r.Header.Get("Authorization"), " ")
+	if !found || !strings.EqualFold(scheme, "Bearer") {
+		return nil, nil
+	}
+	claims, err := a.verify(strings.TrimSpace(token), time.Now())
+	if err != nil {
+		return nil, newError(ErrUnauthorized, "invalid token", err)
+	}
+	subject, _ := claims["sub"].(string)
+	if subject == "" {
+		return nil, newError(ErrUnauthorized, "invalid token", errors.New("the token has no subject"))
+	}
+	rolesClaim := a.RolesClaim
+	if rolesClaim == "" {
+		rolesClaim = "roles"
+	}
+	tenantClaim := a.TenantClaim
+	if tenantClaim == "" {
+		tenantClaim = "tenant"
+	}
+	tenant, _ := claims[tenantClaim].(string)
+	return &Principal{ID: subject, Tenant: tenant, Roles: stringList(claims[rolesClaim]), Claims: claims}, nil
+}
+
+func (a JWTAuthenticator) challenge() string {
+	return "Bearer"
+}
+
+// Checks the signature and the registered claims of the token and returns its claims.
+func (a JWTAuthenticator) verify(token string, now time.Time) (map[string]any, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, errors.New("malformed token")
+	}
+	var header struct {
+		Alg string `json:"alg"`
+	}
+	if err := decodeJWTPart(parts[0], &header); err != nil {
+		return nil, err
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, errors.New("malformed signature")
+	}
+	if err := verifySignature(header.Alg, a.Key, parts[0]+"."+parts[1], signature); err != nil {
+		return nil, err
+	}
+
+	var claims map[string]any
+	if err := decodeJWTPart(parts[1], &claims); err != nil {
+		return nil, err
+	}
+	if exp, ok := claims["exp"].(float64); ok && now.After(time.Unix(int64(exp), 0).Add(a.Leeway)) {
+		return nil, errors.New("the token expired")
+	}
+	if nbf, ok := claims["nbf"].(float64); ok && now.Add(a.Leeway).Before(time.Unix(int64(nbf), 0)) {
+		return nil, errors.New("the token is not valid yet")
+	}
+	if a.Issuer != "" && claims["iss"] != a.Issuer {
+		return nil, fmt.Errorf("the token is not issued by %s", a.Issuer)
+	}
+	if a.Audience != "" && claims["aud"] != a.Audience && !slices.Contains(stringList(claims["aud"]), a.Audience) {
+		return nil, fmt.Errorf("the token is not meant for %s", a.Audience)
+	}
+	return claims, nil
+}
+
+// Checks the signature of a token with the key. The algorithm must be one for the type of the key,
+// so a token can't pass an RSA public key off as an HMAC secret.
+func verifySignature(alg string, key any, signed string, signature []byte) error {
+	hash, ok := jwtHashes[alg]
+	if !ok {
+		return fmt.Errorf("unsupported algorithm %q", alg)
+	}
+	switch key := key.(type) {
+	case []byte:
+		if !strings.HasPrefix(alg, "HS") {
+			return fmt.Errorf("unexpected algorithm %q for an HMAC key", alg)
+		}
+		mac := hmac.New(hash.New, key)
+		mac.Write([]byte(signed))
+		if !hmac.Equal(signature, mac.Sum(nil)) {
+			return errors.New("invalid signature")
+		}
+		return nil
+	case *rsa.PublicKey:
+		if !strings.HasPrefix(alg, "RS") {
+			return fmt.Errorf("unexpected algorithm %q for an RSA key", alg)
+		}
+		h := hash.New()
+		h.Write([]byte(signed))
+		if err := rsa.VerifyPKCS1v15(key, hash, h.Sum(nil), signature); err != nil {
+			return errors.New("invalid signature")
+		}
+		return nil
+	}
+	return fmt.Errorf("unsupported key type %T", key)
+}
+
+// Signs the claims as a JSON Web Token, with HS256 for a []byte secret and RS256 for a *rsa.PrivateKey.
+// Handy for issuing tokens to log in and in tests.
+func SignJWT(claims map[string]any, key any) (string, error) {
+	var alg string
+	switch key.(type) {
+	case []byte:
+		alg = "HS256"
+	case *rsa.PrivateKey:
+		alg = "RS256"
+	default:
+		return "", fmt.Errorf("unsupported key type %T", key)
+	}
+	header, err := json.Marshal(map[string]string{"alg": alg, "typ": "JWT"})
+	if err != nil {
+		return "", err
+	}
+	payload, err := json.Marshal(claims)
+	if err != nil {
+		return "", err
+	}
+	signed := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(payload)
+
+	var signature []byte
+	switch key := key.(type) {
+	case []byte:
+		mac := hmac.New(crypto.SHA256.New, key)
+		mac.Write([]byte(signed))
+		signature = mac.Sum(nil)
+	case *rsa.PrivateKey:
+		h := crypto.SHA256.New()
+		h.Write([]byte(signed))
+		if signature, err = rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, h.Sum(nil)); err != nil {
+			return "", err
+		}
+	}
+	return signed + "." + base64.RawURLEncoding.EncodeToString(signature), nil
+}
+
+// Decodes the base64url encoded json of a part of a token.
+func decodeJWTPart(part string, v any) error {
+	data, err := base64.RawURLEncoding.DecodeString(part)
+	if err != nil {
+		return errors.New("malformed token")
+	}
+	if err := json.Unmarshal(data, v); err != nil {
+		return errors.New("malformed token")
+	}
+	return nil
+}
+
+// Returns the strings of a claim holding a string or a list of them.
+func stringList(claim any) []string {
+	switch claim := claim.(type) {
+	case string:
+		return []string{claim}
+	case []any:
+		var list []string
+		for _, item := range claim {
+			if s, ok := item.(string); ok {
+				list = append(list, s)
+			}
+		}
+		return list
+	}
+	return nil
+}
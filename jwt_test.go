@@ -0,0 +1,60 @@
+package grf
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestJWTVerify(t *testing.T) {
+	secret := []byte("secret")
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now()
+	sign := func(claims map[string]any, key any) string {
+		token, err := SignJWT(claims, key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return token
+	}
+	valid := sign(map[string]any{"sub": "ada"}, secret)
+	parts := strings.Split(valid, ".")
+	unsigned := base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"none"}`)) + "." + parts[1] + "."
+	tampered := parts[0] + "." + base64.RawURLEncoding.EncodeToString([]byte(`{"sub":"root"}`)) + "." + parts[2]
+
+	var tests = []struct {
+		name          string
+		authenticator JWTAuthenticator
+		token         string
+		valid         bool
+	}{
+		{"HMAC", JWTAuthenticator{Key: secret}, valid, true},
+		{"RSA", JWTAuthenticator{Key: &rsaKey.PublicKey}, sign(map[string]any{"sub": "ada"}, rsaKey), true},
+		{"wrong secret", JWTAuthenticator{Key: []byte("other")}, valid, false},
+		{"HMAC token for an RSA key", JWTAuthenticator{Key: &rsaKey.PublicKey}, valid, false},
+		{"unsigned", JWTAuthenticator{Key: secret}, unsigned, false},
+		{"tampered", JWTAuthenticator{Key: secret}, tampered, false},
+		{"malformed", JWTAuthenticator{Key: secret}, "not.a-token", false},
+		{"expired", JWTAuthenticator{Key: secret}, sign(map[string]any{"exp": now.Add(-time.Minute).Unix()}, secret), false},
+		{"expired within leeway", JWTAuthenticator{Key: secret, Leeway: 2 * time.Minute}, sign(map[string]any{"exp": now.Add(-time.Minute).Unix()}, secret), true},
+		{"not valid yet", JWTAuthenticator{Key: secret}, sign(map[string]any{"nbf": now.Add(time.Hour).Unix()}, secret), false},
+		{"issuer", JWTAuthenticator{Key: secret, Issuer: "grf"}, sign(map[string]any{"iss": "grf"}, secret), true},
+		{"other issuer", JWTAuthenticator{Key: secret, Issuer: "grf"}, sign(map[string]any{"iss": "evil"}, secret), false},
+		{"audience in a list", JWTAuthenticator{Key: secret, Audience: "api"}, sign(map[string]any{"aud": []string{"web", "api"}}, secret), true},
+		{"other audience", JWTAuthenticator{Key: secret, Audience: "api"}, sign(map[string]any{"aud": "web"}, secret), false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := tt.authenticator.verify(tt.token, now)
+			if (err == nil) != tt.valid {
+				t.Errorf("got error %v, want valid %v", err, tt.valid)
+			}
+		})
+	}
+}
@@ -0,0 +1,79 @@
+package grf
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"path"
+	"reflect"
+	"sort"
+)
+
+// Lookup identifies a single object by the values of some of its fields, keyed by their json names.
+// The values are strings, as they come from the path of a request.
+type Lookup map[string]string
+
+// Returns the lookup for the object a request is about, from its path variables.
+func requestLookup(r *http.Request) Lookup {
+	names := routeConfigOf(r).lookup
+	if len(names) == 0 {
+		names = []string{"id"}
+	}
+	lookup := Lookup{}
+	for _, name := range names {
+		lookup[name] = PathParam(r, name)
+	}
+	return lookup
+}
+
+// Returns the filter matching the object of the model K with the lookup values.
+// "id" stands for the id field of the model, whatever its json name is.
+func lookupFilter[K any](lookup Lookup) (Filter, error) {
+	model := getModel[K]()
+	names := make([]string, 0, len(lookup))
+	for name := range lookup {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var filter Filter
+	for _, name := range names {
+		value := lookup[name]
+		field := model.FieldByJSON(name)
+		if field == nil && name == "id" {
+			field = model.IDField()
+		}
+		if field == nil {
+			return nil, fmt.Errorf("%s has no field %q to look objects up by", model.Name, name)
+		}
+		if field.BSONName == "_id" {
+			idFilter, err := idFilter[K](value)
+			if err != nil {
+				return nil, err
+			}
+			filter = append(filter, idFilter...)
+			continue
+		}
+		parsed, err := parseFieldValue(field.Type, value)
+		if err != nil {
+			return nil, newError(ErrInvalidID, fmt.Sprintf("%q is not a valid %s", value, name), err)
+		}
+		filter = append(filter, Condition{Field: field.BSONName, Op: OpEq, Value: parsed})
+	}
+	return filter, nil
+}
+
+// Returns the path of the object under the collection path, following the lookup of the request's route.
+func objectLocation(r *http.Request, object any) string {
+	names := routeConfigOf(r).lookup
+	if len(names) == 0 {
+		return path.Join(r.URL.Path, url.PathEscape(formatID(getID(object))))
+	}
+	model := modelOf(reflect.TypeOf(object))
+	location := r.URL.Path
+	for _, name := range names {
+		value := reflect.ValueOf(object).Elem().FieldByIndex(model.FieldByJSON(name).Index).Interface()
+		location = path.Join(location, url.PathEscape(formatID(value)))
+	}
+	return location
+}
@@ -0,0 +1,147 @@
+package grf
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type Repo struct {
+	Id   primitive.ObjectID `json:"id,omitempty" bson:"_id,omitempty"`
+	Org  string             `json:"org" bson:"org"`
+	Name string             `json:"name" bson:"name"`
+	Slug string             `json:"slug" bson:"slug"`
+	Year int                `json:"year" bson:"year"`
+}
+
+func TestLookupRoutes(t *testing.T) {
+	var tests = []struct {
+		name     string
+		lookup   []string
+		location string
+		other    string
+	}{
+		{"id", nil, "", "/repos/" + primitive.NewObjectID().Hex()},
+		{"slug", []string{"slug"}, "/repos/go-rest", "/repos/go-mux"},
+		{"composite", []string{"org", "name"}, "/repos/acme/go%20rest", "/repos/other/go%20rest"},
+		{"typed", []string{"year"}, "/repos/2024", "/repos/2023"},
+	}
+	for name, appCtx := range backendContexts(t) {
+		for _, tt := range tests {
+			t.Run(name+"/"+tt.name, func(t *testing.T) {
+				mux := http.NewServeMux()
+				RegisterCRUDRoutes[Repo]("/repos", ServeMux(mux), appCtx, WithLookup(tt.lookup...))
+
+				res := httptest.NewRecorder()
+				body := `{"org": "acme", "name": "go rest", "slug": "go-rest", "year": 2024}`
+				mux.ServeHTTP(res, httptest.NewRequest(http.MethodPost, "/repos/", strings.NewReader(body)))
+				if res.Code != http.StatusCreated {
+					t.Fatalf("create: status %d, body %s", res.Code, res.Body.String())
+				}
+				var created Repo
+				json.Unmarshal(res.Body.Bytes(), &created)
+				location := res.Header().Get("Location")
+				if tt.location == "" {
+					tt.location = "/repos/" + created.Id.Hex()
+				}
+				if location != tt.location {
+					t.Fatalf("Location is %s, want %s", location, tt.location)
+				}
+
+				res = httptest.NewRecorder()
+				mux.ServeHTTP(res, httptest.NewRequest(http.MethodGet, tt.other, nil))
+				if res.Code != http.StatusNotFound {
+					t.Errorf("GET %s: status %d, want %d", tt.other, res.Code, http.StatusNotFound)
+				}
+
+				res = httptest.NewRecorder()
+				replacement := `{"org": "acme", "name": "go rest", "slug": "go-rest", "year": 2024}`
+				mux.ServeHTTP(res, httptest.NewRequest(http.MethodPut, location, strings.NewReader(replacement)))
+				if res.Code != http.StatusOK {
+					t.Fatalf("PUT: status %d, body %s", res.Code, res.Body.String())
+				}
+				var replaced Repo
+				json.Unmarshal(res.Body.Bytes(), &replaced)
+				if replaced.Id != created.Id {
+					t.Errorf("replace changed the id from %s to %s", created.Id.Hex(), replaced.Id.Hex())
+				}
+
+				res = httptest.NewRecorder()
+				mux.ServeHTTP(res, httptest.NewRequest(http.MethodPatch, location, strings.NewReader(`{"org": "acme"}`)))
+				if res.Code != http.StatusOK {
+					t.Fatalf("PATCH: status %d, body %s", res.Code, res.Body.String())
+				}
+
+				for _, want := range []int{http.StatusNoContent, http.StatusNotFound} {
+					res = httptest.NewRecorder()
+					mux.ServeHTTP(res, httptest.NewRequest(http.MethodDelete, location, nil))
+					if res.Code != want {
+						t.Errorf("DELETE: status %d, want %d", res.Code, want)
+					}
+				}
+			})
+		}
+	}
+}
+
+func TestInvalidLookupValue(t *testing.T) {
+	mux := http.NewServeMux()
+	RegisterCRUDRoutes[Repo]("/repos", ServeMux(mux), &Ctx{Backend: NewMemoryBackend()}, WithLookup("year"))
+	res := httptest.NewRecorder()
+	mux.ServeHTTP(res, httptest.NewRequest(http.MethodGet, "/repos/last-year", nil))
+	if res.Code != http.StatusBadRequest {
+		t.Errorf("status %d, want %d", res.Code, http.StatusBadRequest)
+	}
+}
+
+func TestUnknownLookupField(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Error("registering a lookup on an unknown field did not panic")
+		}
+	}()
+	RegisterCRUDRoutes[Repo]("/repos", ServeMux(http.NewServeMux()), &Ctx{Backend: NewMemoryBackend()}, WithLookup("owner"))
+}
+
+type Rack struct {
+	Id   primitive.ObjectID `json:"id,omitempty" bson:"_id,omitempty"`
+	Slug string             `json:"slug" bson:"slug"`
+}
+
+type Book struct {
+	Id     primitive.ObjectID `json:"id,omitempty" bson:"_id,omitempty"`
+	RackID primitive.ObjectID `json:"rackId" bson:"rackId" grf:"ref=Rack,onDelete=cascade"`
+}
+
+func TestLookupDeleteCascadesOnce(t *testing.T) {
+	RegisterModel[Book]()
+	for name, appCtx := range backendContexts(t) {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			mux := http.NewServeMux()
+			RegisterCRUDRoutes[Rack]("/racks", ServeMux(mux), appCtx, WithLookup("slug"))
+			// The slug isn't unique, only the first match is deleted and only its books go with it.
+			first, second := Rack{Slug: "fiction"}, Rack{Slug: "fiction"}
+			Create(ctx, appCtx, &first)
+			Create(ctx, appCtx, &second)
+			Create(ctx, appCtx, &Book{RackID: first.Id})
+			Create(ctx, appCtx, &Book{RackID: second.Id})
+
+			res := httptest.NewRecorder()
+			mux.ServeHTTP(res, httptest.NewRequest(http.MethodDelete, "/racks/fiction", nil))
+			if res.Code != http.StatusNoContent {
+				t.Fatalf("delete: status %d, body %s", res.Code, res.Body.String())
+			}
+			racks, _ := RepositoryFor[Rack](appCtx).Count(ctx, nil)
+			books, _ := RepositoryFor[Book](appCtx).Count(ctx, nil)
+			if racks != 1 || books != 1 {
+				t.Errorf("%d racks and %d books left, want one of each", racks, books)
+			}
+		})
+	}
+}
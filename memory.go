@@ -0,0 +1,631 @@
+package grf
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// MemoryBackend keeps every model in memory. Useful for tests and local development, nothing survives a restart.
+// Objects are stored as bson documents, so filters, sorting and patches behave like they do on mongodb.
+// Transactions are serialised and roll back everything they changed when fn fails.
+type MemoryBackend struct {
+	mu          sync.Mutex
+	collections map[string][]bson.Raw
+}
+
+// Returns an empty MemoryBackend.
+func NewMemoryBackend() *MemoryBackend {
+	return &MemoryBackend{collections: map[string][]bson.Raw{}}
+}
+
+type memoryTransactionKey struct{}
+
+// Locks the backend unless ctx belongs to a transaction of it, which already holds the lock.
+func (b *MemoryBackend) lock(ctx context.Context) func() {
+	if ctx.Value(memoryTransactionKey{}) == b {
+		return func() {}
+	}
+	b.mu.Lock()
+	return b.mu.Unlock
+}
+
+func (b *MemoryBackend) Insert(ctx context.Context, c Collection, object any) (any, error) {
+	doc, err := toDocument(object)
+	if err != nil {
+		return nil, err
+	}
+	// Generating missing ids the way the mongo driver does.
+	if id, ok := doc["_id"]; !ok || id == nil || id == primitive.NilObjectID {
+		doc["_id"] = primitive.NewObjectID()
+	}
+
+	defer b.lock(ctx)()
+	name := c.Name
+	for _, raw := range b.collections[name] {
+		if equal(raw.Lookup("_id"), doc["_id"]) {
+			return nil, newError(ErrConflict, fmt.Sprintf("an object with the id %v already exists", doc["_id"]), nil)
+		}
+	}
+	raw, err := bson.Marshal(doc)
+	if err != nil {
+		return nil, err
+	}
+	b.collections[name] = append(b.collections[name], raw)
+	return doc["_id"], nil
+}
+
+func (b *MemoryBackend) InsertMany(ctx context.Context, c Collection, objects []any) ([]any, error) {
+	return insertEach(ctx, b, c, objects)
+}
+
+func (b *MemoryBackend) FindOne(ctx context.Context, c Collection, filter Filter, object any) error {
+	defer b.lock(ctx)()
+	i, err := b.first(c, filter)
+	if err != nil {
+		return err
+	}
+	return bson.Unmarshal(b.collections[c.Name][i], object)
+}
+
+func (b *MemoryBackend) Find(ctx context.Context, c Collection, query Query, objects any) error {
+	defer b.lock(ctx)()
+	docs, err := b.matching(c, query.Filter)
+	if err != nil {
+		return err
+	}
+	if len(query.Sort) > 0 {
+		sort.SliceStable(docs, func(i, j int) bool {
+			for _, s := range query.Sort {
+				c := compareValues(docs[i].Lookup(strings.Split(s.Field, ".")...), docs[j].Lookup(strings.Split(s.Field, ".")...))
+				if c != 0 {
+					return (c < 0) != s.Desc
+				}
+			}
+			return false
+		})
+	}
+	if query.Skip > 0 {
+		docs = docs[min(query.Skip, int64(len(docs))):]
+	}
+	if query.Limit > 0 && query.Limit < int64(len(docs)) {
+		docs = docs[:query.Limit]
+	}
+
+	slice := reflect.ValueOf(objects).Elem()
+	result := reflect.MakeSlice(slice.Type(), 0, len(docs))
+	for _, raw := range docs {
+		object := reflect.New(slice.Type().Elem())
+		if err := bson.Unmarshal(raw, object.Interface()); err != nil {
+			return err
+		}
+		result = reflect.Append(result, object.Elem())
+	}
+	slice.Set(result)
+	return nil
+}
+
+func (b *MemoryBackend) Count(ctx context.Context, c Collection, filter Filter) (int64, error) {
+	defer b.lock(ctx)()
+	docs, err := b.matching(c, filter)
+	return int64(len(docs)), err
+}
+
+func (b *MemoryBackend) ReplaceOne(ctx context.Context, c Collection, filter Filter, object any) error {
+	doc, err := toDocument(object)
+	if err != nil {
+		return err
+	}
+
+	defer b.lock(ctx)()
+	i, err := b.first(c, filter)
+	if err != nil {
+		return err
+	}
+	collection := b.collections[c.Name]
+	doc["_id"] = collection[i].Lookup("_id")
+	raw, err := bson.Marshal(doc)
+	if err != nil {
+		return err
+	}
+	collection[i] = raw
+	return nil
+}
+
+func (b *MemoryBackend) UpdateOne(ctx context.Context, c Collection, filter Filter, patch Patch, object any) error {
+	defer b.lock(ctx)()
+	i, err := b.first(c, filter)
+	if err != nil {
+		return err
+	}
+	collection := b.collections[c.Name]
+	raw, err := applyPatch(collection[i], patch)
+	if err != nil {
+		return err
+	}
+	collection[i] = raw
+	if object == nil {
+		return nil
+	}
+	return bson.Unmarshal(raw, object)
+}
+
+func (b *MemoryBackend) UpdateMany(ctx context.Context, c Collection, filter Filter, patch Patch) (int64, error) {
+	defer b.lock(ctx)()
+	collection := b.collections[c.Name]
+	var modified int64
+	for i, raw := range collection {
+		ok, err := matches(raw, filter)
+		if err != nil {
+			return modified, err
+		}
+		if !ok {
+			continue
+		}
+		if collection[i], err = applyPatch(raw, patch); err != nil {
+			return modified, err
+		}
+		modified++
+	}
+	return modified, nil
+}
+
+func (b *MemoryBackend) BulkWrite(ctx context.Context, c Collection, updates []BulkWriteModel) (int64, error) {
+	return updateEach(ctx, b, c, updates)
+}
+
+func (b *MemoryBackend) DeleteOne(ctx context.Context, c Collection, filter Filter) (int64, error) {
+	defer b.lock(ctx)()
+	i, err := b.first(c, filter)
+	if err != nil {
+		if errors.Is(err, ErrNotFound) {
+			return 0, nil
+		}
+		return 0, err
+	}
+	name := c.Name
+	b.collections[name] = append(b.collections[name][:i:i], b.collections[name][i+1:]...)
+	return 1, nil
+}
+
+func (b *MemoryBackend) DeleteMany(ctx context.Context, c Collection, filter Filter) (int64, error) {
+	defer b.lock(ctx)()
+	name := c.Name
+	var kept []bson.Raw
+	for _, raw := range b.collections[name] {
+		ok, err := matches(raw, filter)
+		if err != nil {
+			return 0, err
+		}
+		if !ok {
+			kept = append(kept, raw)
+		}
+	}
+	deleted := int64(len(b.collections[name]) - len(kept))
+	b.collections[name] = kept
+	return deleted, nil
+}
+
+// Runs fn holding the backend, nothing else gets in until it returns.
+// If fn fails, the collections are restored to what they were before it ran.
+func (b *MemoryBackend) WithTransaction(ctx context.Context, fn func(ctx context.Context) error) error {
+	if ctx.Value(memoryTransactionKey{}) == b {
+		return fn(ctx)
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	// Stored documents are never modified in place, copying the slices is enough for a snapshot.
+	snapshot := make(map[string][]bson.Raw, len(b.collections))
+	for name, collection := range b.collections {
+		snapshot[name] = append([]bson.Raw(nil), collection...)
+	}
+	if err := fn(context.WithValue(ctx, memoryTransactionKey{}, b)); err != nil {
+		b.collections = snapshot
+		return err
+	}
+	return nil
+}
+
+// Returns the index of the first document of the model matching the filter.
+func (b *MemoryBackend) first(c Collection, filter Filter) (int, error) {
+	for i, raw := range b.collections[c.Name] {
+		ok, err := matches(raw, filter)
+		if err != nil {
+			return 0, err
+		}
+		if ok {
+			return i, nil
+		}
+	}
+	return 0, newError(ErrNotFound, "", nil)
+}
+
+// Returns the documents of the model matching the filter.
+func (b *MemoryBackend) matching(c Collection, filter Filter) ([]bson.Raw, error) {
+	var docs []bson.Raw
+	for _, raw := range b.collections[c.Name] {
+		ok, err := matches(raw, filter)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			docs = append(docs, raw)
+		}
+	}
+	return docs, nil
+}
+
+// Marshals the object the way the mongo driver would store it.
+func toDocument(object any) (bson.M, error) {
+	raw, err := bson.Marshal(object)
+	if err != nil {
+		return nil, err
+	}
+	doc := bson.M{}
+	err = bson.Unmarshal(raw, &doc)
+	return doc, err
+}
+
+// Converts a go value into the value it would be stored as, so it can be compared with stored values.
+func normalize(value any) bson.RawValue {
+	raw, err := bson.Marshal(bson.M{"v": value})
+	if err != nil {
+		return bson.RawValue{Type: bson.TypeNull}
+	}
+	return bson.Raw(raw).Lookup("v")
+}
+
+// Reports whether the document satisfies every condition of the filter.
+func matches(doc bson.Raw, filter Filter) (bool, error) {
+	for _, c := range filter {
+		stored, err := doc.LookupErr(strings.Split(c.Field, ".")...)
+		var value any
+		if err == nil {
+			value = stored
+		}
+		ok, err := matchCondition(value, c.Op, normalize(c.Value))
+		if err != nil || !ok {
+			return false, err
+		}
+	}
+	return true, nil
+}
+
+// Matches a stored value against a condition. Conditions on arrays hold when any element satisfies them,
+// like they do on mongodb.
+func matchCondition(stored any, op string, value bson.RawValue) (bool, error) {
+	switch op {
+	case OpNe:
+		ok, err := matchCondition(stored, OpEq, value)
+		return !ok, err
+	case OpEq, "":
+		return anyElement(stored, func(v any) bool { return equal(v, value) }), nil
+	case OpExists:
+		want, _ := value.BooleanOK()
+		return (stored != nil) == want, nil
+	case OpIn:
+		values, ok := value.ArrayOK()
+		if !ok {
+			return false, fmt.Errorf("the value of an in condition must be a list")
+		}
+		elements, _ := values.Values()
+		return anyElement(stored, func(v any) bool {
+			for _, element := range elements {
+				if equal(v, element) {
+					return true
+				}
+			}
+			return false
+		}), nil
+	case OpGt, OpGte, OpLt, OpLte:
+		return anyElement(stored, func(v any) bool {
+			if !orderable(v, value) {
+				return false
+			}
+			c := compareValues(v, value)
+			switch op {
+			case OpGt:
+				return c > 0
+			case OpGte:
+				return c >= 0
+			case OpLt:
+				return c < 0
+			}
+			return c <= 0
+		}), nil
+	case OpContains, OpIContains, OpStartsWith:
+		pattern, _ := value.StringValueOK()
+		return anyElement(stored, func(v any) bool {
+			s, ok := rawValue(v).StringValueOK()
+			switch {
+			case !ok:
+				return false
+			case op == OpContains:
+				return strings.Contains(s, pattern)
+			case op == OpIContains:
+				return strings.Contains(strings.ToLower(s), strings.ToLower(pattern))
+			}
+			return strings.HasPrefix(s, pattern)
+		}), nil
+	}
+	return false, fmt.Errorf("unknown filter operator %q", op)
+}
+
+// Calls match with the value itself and, if it is an array, with each of its elements.
+func anyElement(value any, match func(v any) bool) bool {
+	if match(value) {
+		return true
+	}
+	if value == nil {
+		return false
+	}
+	if array, ok := rawValue(value).ArrayOK(); ok {
+		elements, _ := array.Values()
+		for _, element := range elements {
+			if match(element) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Converts a stored or normalized value into a bson.RawValue. Missing values become null.
+func rawValue(value any) bson.RawValue {
+	switch v := value.(type) {
+	case bson.RawValue:
+		return v
+	case nil:
+		return bson.RawValue{Type: bson.TypeNull}
+	}
+	return normalize(value)
+}
+
+// Reports whether two values are equal as bson values. Numbers of different types are compared by value.
+func equal(a, b any) bool {
+	x, y := rawValue(a), rawValue(b)
+	if isNumeric(x) && isNumeric(y) {
+		return compareValues(x, y) == 0
+	}
+	if x.Type == bson.TypeUndefined {
+		x.Type = bson.TypeNull
+	}
+	return x.Equal(y)
+}
+
+func isNumeric(v bson.RawValue) bool {
+	return v.Type == bson.TypeInt32 || v.Type == bson.TypeInt64 || v.Type == bson.TypeDouble
+}
+
+// Reports whether the values can be ordered against each other.
+func orderable(a, b any) bool {
+	x, y := rawValue(a), rawValue(b)
+	return x.Type == y.Type || isNumeric(x) && isNumeric(y)
+}
+
+// Orders two bson values. Missing values and null come first, values of different types are ordered by type.
+func compareValues(a, b any) int {
+	x, y := rawValue(a), rawValue(b)
+	if x.Type == bson.TypeUndefined || len(x.Value) == 0 && x.Type != bson.TypeNull {
+		x = bson.RawValue{Type: bson.TypeNull}
+	}
+	if y.Type == bson.TypeUndefined || len(y.Value) == 0 && y.Type != bson.TypeNull {
+		y = bson.RawValue{Type: bson.TypeNull}
+	}
+	if isNumeric(x) && isNumeric(y) {
+		return compareFloats(asFloat(x), asFloat(y))
+	}
+	if x.Type != y.Type {
+		return int(x.Type) - int(y.Type)
+	}
+	switch x.Type {
+	case bson.TypeString:
+		return strings.Compare(x.StringValue(), y.StringValue())
+	case bson.TypeBoolean:
+		return compareFloats(boolToFloat(x.Boolean()), boolToFloat(y.Boolean()))
+	case bson.TypeDateTime:
+		return compareFloats(float64(x.DateTime()), float64(y.DateTime()))
+	case bson.TypeObjectID:
+		return strings.Compare(x.ObjectID().Hex(), y.ObjectID().Hex())
+	}
+	return strings.Compare(x.String(), y.String())
+}
+
+func asFloat(v bson.RawValue) float64 {
+	switch v.Type {
+	case bson.TypeInt32:
+		return float64(v.Int32())
+	case bson.TypeInt64:
+		return float64(v.Int64())
+	case bson.TypeDouble:
+		return v.Double()
+	}
+	return 0
+}
+
+func compareFloats(a, b float64) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
+
+func boolToFloat(b bool) float64 {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+// Applies the patch to a stored document and returns the updated document.
+func applyPatch(raw bson.Raw, patch Patch) (bson.Raw, error) {
+	doc := bson.M{}
+	if err := bson.Unmarshal(raw, &doc); err != nil {
+		return nil, err
+	}
+	for path, value := range patch.Set {
+		if err := setPath(doc, path, value); err != nil {
+			return nil, err
+		}
+	}
+	for _, path := range patch.Unset {
+		unsetPath(doc, path)
+	}
+	for path, values := range patch.Push {
+		array, _ := getPath(doc, path).(bson.A)
+		if current := getPath(doc, path); current != nil && array == nil {
+			return nil, newError(ErrConflict, fmt.Sprintf("%q is not an array", path), nil)
+		}
+		if err := setPath(doc, path, append(array, values...)); err != nil {
+			return nil, err
+		}
+	}
+	for path, values := range patch.Pull {
+		array, ok := getPath(doc, path).(bson.A)
+		if !ok {
+			continue
+		}
+		kept := bson.A{}
+		for _, element := range array {
+			pulled := false
+			for _, value := range values {
+				if equal(element, value) {
+					pulled = true
+					break
+				}
+			}
+			if !pulled {
+				kept = append(kept, element)
+			}
+		}
+		if err := setPath(doc, path, kept); err != nil {
+			return nil, err
+		}
+	}
+	for path, amount := range patch.Inc {
+		current, by := rawValue(getPath(doc, path)), normalize(amount)
+		if !isNumeric(by) || current.Type != bson.TypeNull && !isNumeric(current) {
+			return nil, newError(ErrConflict, fmt.Sprintf("%q can not be incremented", path), nil)
+		}
+		var sum any = asFloat(current) + asFloat(by)
+		if current.Type != bson.TypeDouble && by.Type != bson.TypeDouble {
+			sum = int64(asFloat(current)) + by.AsInt64()
+		}
+		if err := setPath(doc, path, sum); err != nil {
+			return nil, err
+		}
+	}
+	for from, to := range patch.Rename {
+		value := getPath(doc, from)
+		if value == nil {
+			continue
+		}
+		unsetPath(doc, from)
+		if err := setPath(doc, to, value); err != nil {
+			return nil, err
+		}
+	}
+	return bson.Marshal(doc)
+}
+
+// Returns the value at a dotted path of the document, nil if there is none.
+func getPath(doc bson.M, path string) any {
+	var current any = doc
+	for _, segment := range strings.Split(path, ".") {
+		switch v := current.(type) {
+		case bson.M:
+			current = v[segment]
+		case bson.D:
+			current = v.Map()[segment]
+		case bson.A:
+			i, err := strconv.Atoi(segment)
+			if err != nil || i < 0 || i >= len(v) {
+				return nil
+			}
+			current = v[i]
+		default:
+			return nil
+		}
+	}
+	return current
+}
+
+// Sets the value at a dotted path of the document, creating the embedded documents on the way.
+func setPath(doc bson.M, path string, value any) error {
+	segments := strings.Split(path, ".")
+	var current any = doc
+	for i, segment := range segments {
+		last := i == len(segments)-1
+		switch v := current.(type) {
+		case bson.M:
+			if last {
+				v[segment] = value
+				return nil
+			}
+			next := v[segment]
+			if d, ok := next.(bson.D); ok {
+				next = toM(d)
+				v[segment] = next
+			}
+			if next == nil {
+				next = bson.M{}
+				v[segment] = next
+			}
+			current = next
+		case bson.A:
+			index, err := strconv.Atoi(segment)
+			if err != nil || index < 0 || index >= len(v) {
+				return newError(ErrConflict, fmt.Sprintf("%q is not in the array", path), nil)
+			}
+			if last {
+				v[index] = value
+				return nil
+			}
+			if d, ok := v[index].(bson.D); ok {
+				v[index] = toM(d)
+			}
+			current = v[index]
+		default:
+			return newError(ErrConflict, fmt.Sprintf("%q goes past a value that is not a document", path), nil)
+		}
+	}
+	return nil
+}
+
+// Removes the value at a dotted path of the document.
+func unsetPath(doc bson.M, path string) {
+	i := strings.LastIndex(path, ".")
+	if i < 0 {
+		delete(doc, path)
+		return
+	}
+	switch parent := getPath(doc, path[:i]).(type) {
+	case bson.M:
+		delete(parent, path[i+1:])
+	case bson.D:
+		// Embedded documents decoded as bson.D are replaced by a copy without the field.
+		m := toM(parent)
+		delete(m, path[i+1:])
+		setPath(doc, path[:i], m)
+	}
+}
+
+func toM(d bson.D) bson.M {
+	m := make(bson.M, len(d))
+	for _, e := range d {
+		m[e.Key] = e.Value
+	}
+	return m
+}
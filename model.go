@@ -0,0 +1,196 @@
+package grf
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Model holds the metadata grf needs about a model type.
+// It is derived from the json, bson and grf struct tags once per type and cached.
+type Model struct {
+	Type   reflect.Type
+	Name   string
+	Fields []*Field
+}
+
+// Field describes a single exported field of a model.
+type Field struct {
+	Name     string
+	Index    []int
+	Type     reflect.Type
+	JSONName string
+	BSONName string
+	Options  TagOptions
+}
+
+// TagOptions are the parsed options of a grf struct tag.
+// `grf:"filter,sort,max=200"` becomes {"filter": "", "sort": "", "max": "200"}.
+type TagOptions map[string]string
+
+// Has reports whether the option is present in the tag.
+func (o TagOptions) Has(key string) bool {
+	_, ok := o[key]
+	return ok
+}
+
+// Get returns the value of a key=value option.
+func (o TagOptions) Get(key string) (string, bool) {
+	v, ok := o[key]
+	return v, ok
+}
+
+var modelCache sync.Map // reflect.Type -> *Model
+
+// Returns the cached metadata for the model type K.
+func getModel[K any]() *Model {
+	return modelOf(reflect.TypeOf((*K)(nil)).Elem())
+}
+
+// Returns the cached metadata for the given type.
+// Pointers and slices are unwrapped so *[]models.Todo resolves to models.Todo.
+func modelOf(t reflect.Type) *Model {
+	for t.Kind() == reflect.Pointer || t.Kind() == reflect.Slice {
+		t = t.Elem()
+	}
+	if m, ok := modelCache.Load(t); ok {
+		return m.(*Model)
+	}
+	m := &Model{Type: t, Name: t.Name()}
+	if t.Kind() == reflect.Struct {
+		for i := 0; i < t.NumField(); i++ {
+			sf := t.Field(i)
+			if !sf.IsExported() {
+				continue
+			}
+			jsonName := tagName(sf.Tag.Get("json"), sf.Name)
+			bsonName := tagName(sf.Tag.Get("bson"), strings.ToLower(sf.Name))
+			if jsonName == "-" && bsonName == "-" {
+				continue
+			}
+			m.Fields = append(m.Fields, &Field{
+				Name:     sf.Name,
+				Index:    sf.Index,
+				Type:     sf.Type,
+				JSONName: jsonName,
+				BSONName: bsonName,
+				Options:  parseTagOptions(sf.Tag.Get("grf")),
+			})
+		}
+	}
+	actual, _ := modelCache.LoadOrStore(t, m)
+	return actual.(*Model)
+}
+
+// Returns the field with the given json name.
+func (m *Model) FieldByJSON(name string) *Field {
+	for _, f := range m.Fields {
+		if f.JSONName == name {
+			return f
+		}
+	}
+	return nil
+}
+
+// Returns the field with the given bson name.
+func (m *Model) FieldByBSON(name string) *Field {
+	for _, f := range m.Fields {
+		if f.BSONName == name {
+			return f
+		}
+	}
+	return nil
+}
+
+// Returns the first field carrying the given grf tag option.
+func (m *Model) FieldWithOption(option string) *Field {
+	for _, f := range m.Fields {
+		if f.Options.Has(option) {
+			return f
+		}
+	}
+	return nil
+}
+
+// Returns the field stored as _id, if the model has one.
+func (m *Model) IDField() *Field {
+	return m.FieldByBSON("_id")
+}
+
+// Returns the value of the id field of object, a pointer to the model.
+func getID(object any) any {
+	field := modelOf(reflect.TypeOf(object)).IDField()
+	if field == nil {
+		return nil
+	}
+	return reflect.ValueOf(object).Elem().FieldByIndex(field.Index).Interface()
+}
+
+// Sets the id field of object, a pointer to the model, if the id fits its type.
+func setID(object any, id any) {
+	field := modelOf(reflect.TypeOf(object)).IDField()
+	if field == nil || id == nil {
+		return
+	}
+	value := reflect.ValueOf(id)
+	target := reflect.ValueOf(object).Elem().FieldByIndex(field.Index)
+	switch {
+	case value.Type().AssignableTo(target.Type()):
+		target.Set(value)
+	case value.Kind() == target.Kind() || isNumber(value.Kind()) && isNumber(target.Kind()):
+		if value.CanConvert(target.Type()) {
+			target.Set(value.Convert(target.Type()))
+		}
+	}
+}
+
+// Reports whether the field holds integer ids.
+func isIntegerID(field *Field) bool {
+	kind := indirect(field.Type).Kind()
+	return kind >= reflect.Int && kind <= reflect.Uint64
+}
+
+func isNumber(kind reflect.Kind) bool {
+	return kind >= reflect.Int && kind <= reflect.Float64
+}
+
+// Formats an id for use in URLs.
+func formatID(id any) string {
+	if objectID, ok := id.(primitive.ObjectID); ok {
+		return objectID.Hex()
+	}
+	return fmt.Sprint(id)
+}
+
+// Extracts the name part of a json or bson struct tag, falling back to the given default.
+func tagName(tag, fallback string) string {
+	name, _, _ := strings.Cut(tag, ",")
+	if name == "" {
+		return fallback
+	}
+	return name
+}
+
+// Parses a grf struct tag into its options.
+// Options are comma separated. A regex option swallows the rest of the tag so patterns may contain commas.
+func parseTagOptions(tag string) TagOptions {
+	options := TagOptions{}
+	for tag != "" {
+		var part string
+		if strings.HasPrefix(tag, "regex=") {
+			part, tag = tag, ""
+		} else {
+			part, tag, _ = strings.Cut(tag, ",")
+		}
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		key, value, _ := strings.Cut(part, "=")
+		options[key] = value
+	}
+	return options
+}
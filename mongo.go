@@ -0,0 +1,202 @@
+package grf
+
+import (
+	"context"
+	"errors"
+	"log"
+
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// MongoBackend stores every model in a collection of a mongodb database.
+// It is the Backend used when Ctx.Backend is not set.
+type MongoBackend struct {
+	DB *mongo.Database
+}
+
+func (b *MongoBackend) collection(c Collection) *mongo.Collection {
+	return b.DB.Collection(c.Name)
+}
+
+func (b *MongoBackend) Insert(ctx context.Context, c Collection, object any) (any, error) {
+	collection := b.collection(c)
+	res, err := collection.InsertOne(ctx, object)
+	if err != nil {
+		log.Println("Error adding object to database.", err)
+		return nil, mongoError(err)
+	}
+	log.Println("Inserted record to " + collection.Name() + " collection.")
+	return res.InsertedID, nil
+}
+
+func (b *MongoBackend) InsertMany(ctx context.Context, c Collection, objects []any) ([]any, error) {
+	collection := b.collection(c)
+	res, err := collection.InsertMany(ctx, objects, options.InsertMany().SetOrdered(false))
+	if err != nil {
+		log.Println("Error adding objects to database.", err)
+		if err = bulkWriteErrors(err); res == nil {
+			return nil, err
+		}
+		return res.InsertedIDs, err
+	}
+	log.Println("Inserted records to "+collection.Name()+" collection.", len(res.InsertedIDs))
+	return res.InsertedIDs, nil
+}
+
+func (b *MongoBackend) FindOne(ctx context.Context, c Collection, filter Filter, object any) error {
+	err := b.collection(c).FindOne(ctx, filter.bson()).Decode(object)
+	if err != nil {
+		log.Println("Error finding the one", err)
+		return mongoError(err)
+	}
+	return nil
+}
+
+func (b *MongoBackend) Find(ctx context.Context, c Collection, query Query, objects any) error {
+	collection := b.collection(c)
+	cur, err := collection.Find(ctx, query.Filter.bson(), query.findOptions())
+	if err != nil {
+		log.Println("error retrieving all objects of "+collection.Name(), err)
+		return mongoError(err)
+	}
+	err = cur.All(ctx, objects)
+	if err != nil {
+		log.Println("error getting data from cursor "+collection.Name(), err)
+		return mongoError(err)
+	}
+	return nil
+}
+
+func (b *MongoBackend) Count(ctx context.Context, c Collection, filter Filter) (int64, error) {
+	count, err := b.collection(c).CountDocuments(ctx, filter.bson())
+	return count, mongoError(err)
+}
+
+func (b *MongoBackend) ReplaceOne(ctx context.Context, c Collection, filter Filter, object any) error {
+	res, err := b.collection(c).ReplaceOne(ctx, filter.bson(), object)
+	if err != nil {
+		log.Println("Error replacing object:", err)
+		return mongoError(err)
+	}
+	if res.MatchedCount == 0 {
+		return newError(ErrNotFound, "", nil)
+	}
+	log.Println("Replaced object.", res.ModifiedCount)
+	return nil
+}
+
+func (b *MongoBackend) UpdateOne(ctx context.Context, c Collection, filter Filter, patch Patch, object any) error {
+	collection := b.collection(c)
+	if object == nil {
+		res, err := collection.UpdateOne(ctx, filter.bson(), patch.bson())
+		if err != nil {
+			return mongoError(err)
+		}
+		if res.MatchedCount == 0 {
+			return newError(ErrNotFound, "", nil)
+		}
+		return nil
+	}
+	opts := options.FindOneAndUpdate().SetReturnDocument(options.After)
+	err := collection.FindOneAndUpdate(ctx, filter.bson(), patch.bson(), opts).Decode(object)
+	if err != nil {
+		log.Println("Error updating object:", err)
+		return mongoError(err)
+	}
+	return nil
+}
+
+func (b *MongoBackend) UpdateMany(ctx context.Context, c Collection, filter Filter, patch Patch) (int64, error) {
+	res, err := b.collection(c).UpdateMany(ctx, filter.bson(), patch.bson())
+	if err != nil {
+		return 0, mongoError(err)
+	}
+	return res.ModifiedCount, nil
+}
+
+func (b *MongoBackend) BulkWrite(ctx context.Context, c Collection, updates []BulkWriteModel) (int64, error) {
+	models := make([]mongo.WriteModel, len(updates))
+	for i, update := range updates {
+		models[i] = mongo.NewUpdateOneModel().SetFilter(update.Filter.bson()).SetUpdate(update.Patch.bson())
+	}
+	res, err := b.collection(c).BulkWrite(ctx, models, options.BulkWrite().SetOrdered(false))
+	if err != nil {
+		log.Println("Error updating objects:", err)
+		if err = bulkWriteErrors(err); res == nil {
+			return 0, err
+		}
+		return res.MatchedCount, err
+	}
+	return res.MatchedCount, nil
+}
+
+// Translates the errors of single writes of a bulk write into BulkWriteErrors, by the index of the write.
+func bulkWriteErrors(err error) error {
+	var exception mongo.BulkWriteException
+	if !errors.As(err, &exception) || len(exception.WriteErrors) == 0 {
+		return mongoError(err)
+	}
+	errs := BulkWriteErrors{}
+	for _, writeError := range exception.WriteErrors {
+		errs[writeError.Index] = mongoError(writeError.WriteError)
+	}
+	return errs
+}
+
+func (b *MongoBackend) DeleteOne(ctx context.Context, c Collection, filter Filter) (int64, error) {
+	res, err := b.collection(c).DeleteOne(ctx, filter.bson())
+	if err != nil {
+		log.Println("Error deleting object:", err)
+		return 0, mongoError(err)
+	}
+	return res.DeletedCount, nil
+}
+
+func (b *MongoBackend) DeleteMany(ctx context.Context, c Collection, filter Filter) (int64, error) {
+	res, err := b.collection(c).DeleteMany(ctx, filter.bson())
+	if err != nil {
+		log.Println("Error deleting objects:", err)
+		return 0, mongoError(err)
+	}
+	return res.DeletedCount, nil
+}
+
+// Runs fn in a mongodb transaction. Needs a replica set.
+// If ctx is already part of a transaction, fn joins it.
+// The transaction is attempted once, retrying transient failures is left to WithTransaction. Only a commit with an
+// unknown result is tried again, running fn again could apply its changes twice.
+func (b *MongoBackend) WithTransaction(ctx context.Context, fn func(ctx context.Context) error) error {
+	if mongo.SessionFromContext(ctx) != nil {
+		return fn(ctx)
+	}
+	session, err := b.DB.Client().StartSession()
+	if err != nil {
+		return mongoError(err)
+	}
+	defer session.EndSession(ctx)
+
+	if err := session.StartTransaction(); err != nil {
+		return mongoError(err)
+	}
+	sessCtx := mongo.NewSessionContext(ctx, session)
+	if err := fn(sessCtx); err != nil {
+		if abortErr := session.AbortTransaction(sessCtx); abortErr != nil {
+			log.Println("Error aborting transaction:", abortErr)
+		}
+		return err
+	}
+	for attempt := 1; ; attempt++ {
+		err = session.CommitTransaction(sessCtx)
+		var labeled mongo.LabeledError
+		if err == nil || !errors.As(err, &labeled) || !labeled.HasErrorLabel("UnknownTransactionCommitResult") || attempt >= TransactionAttempts || ctx.Err() != nil {
+			break
+		}
+		log.Println("Retrying the commit after an unknown result.", err)
+	}
+	if err != nil {
+		log.Println("Error in transaction:", err)
+		return mongoError(err)
+	}
+	return nil
+}
@@ -0,0 +1,169 @@
+package grf
+
+import (
+	"reflect"
+	"strings"
+	"sync"
+	"unicode"
+)
+
+// Collection is where the objects of a model are stored: a mongodb collection, a SQL table.
+type Collection struct {
+	Name  string
+	Model *Model
+}
+
+// CollectionNamer names the collections of models. Set one on Ctx to change how every collection is named.
+// A model can still pick its own name, see NamedCollection.
+type CollectionNamer interface {
+	CollectionName(model *Model) string
+}
+
+// NamedCollection can be implemented by models to pick the name of their collection.
+// Alternatively, tag a blank field: `_ struct{} grf:"collection=people"`.
+type NamedCollection interface {
+	CollectionName() string
+}
+
+// PluralNamer names collections with the lowercase plural of the model name.
+// The words of the name are joined with Separator: Person is stored in people and OrderItem in orderitems,
+// or in order_items with "_" as separator. Type arguments of generic models are left out.
+// It is the default CollectionNamer.
+type PluralNamer struct {
+	Separator string
+}
+
+func (n PluralNamer) CollectionName(model *Model) string {
+	name := model.Type.Name()
+	if i := strings.Index(name, "["); i >= 0 {
+		name = name[:i]
+	}
+	words := splitWords(name)
+	if len(words) == 0 {
+		return ""
+	}
+	for i := range words {
+		words[i] = strings.ToLower(words[i])
+	}
+	words[len(words)-1] = Pluralize(words[len(words)-1])
+	return strings.Join(words, n.Separator)
+}
+
+// Splits a CamelCase name into its words. Runs of capitals are kept together: HTTPRequest is HTTP and Request.
+func splitWords(name string) []string {
+	runes := []rune(name)
+	var words []string
+	start := 0
+	for i := 1; i < len(runes); i++ {
+		lowerToUpper := unicode.IsLower(runes[i-1]) && unicode.IsUpper(runes[i])
+		acronymEnd := i+1 < len(runes) && unicode.IsUpper(runes[i-1]) && unicode.IsUpper(runes[i]) && unicode.IsLower(runes[i+1])
+		if lowerToUpper || acronymEnd || runes[i] == '_' {
+			words = append(words, string(runes[start:i]))
+			start = i
+		}
+		if runes[i] == '_' {
+			start = i + 1
+		}
+	}
+	if start < len(runes) {
+		words = append(words, string(runes[start:]))
+	}
+	return words
+}
+
+var (
+	irregularPlurals = map[string]string{
+		"person": "people", "man": "men", "woman": "women", "child": "children", "tooth": "teeth",
+		"foot": "feet", "mouse": "mice", "goose": "geese", "ox": "oxen", "louse": "lice",
+		"datum": "data", "medium": "media", "criterion": "criteria", "phenomenon": "phenomena",
+		"cactus": "cacti", "fungus": "fungi", "alumnus": "alumni", "quiz": "quizzes",
+		"index": "indices", "matrix": "matrices", "vertex": "vertices", "appendix": "appendices",
+	}
+	uncountables = map[string]bool{
+		"sheep": true, "fish": true, "deer": true, "series": true, "species": true, "news": true,
+		"information": true, "equipment": true, "data": true, "metadata": true, "money": true, "rice": true,
+		"software": true, "feedback": true, "staff": true, "aircraft": true,
+	}
+	// Words ending in f or fe that take ves.
+	vesPlurals = map[string]bool{
+		"leaf": true, "loaf": true, "thief": true, "sheaf": true, "wolf": true, "half": true, "calf": true,
+		"shelf": true, "self": true, "elf": true, "knife": true, "wife": true, "life": true, "midwife": true,
+	}
+	// Words ending in a consonant and o that take es.
+	oesPlurals = map[string]bool{"hero": true, "potato": true, "tomato": true, "echo": true, "veto": true, "torpedo": true}
+)
+
+// Returns the plural of an English noun, keeping its case.
+// Knows the common irregular and uncountable nouns, and the y, f, fe, is, o and sibilant endings.
+func Pluralize(word string) string {
+	lower := strings.ToLower(word)
+	switch {
+	case lower == "":
+		return word
+	case uncountables[lower]:
+		return word
+	case irregularPlurals[lower] != "":
+		plural := irregularPlurals[lower]
+		// Keeping a capital first letter.
+		if unicode.IsUpper([]rune(word)[0]) {
+			return strings.ToUpper(plural[:1]) + plural[1:]
+		}
+		return plural
+	case vesPlurals[lower]:
+		return strings.TrimSuffix(strings.TrimSuffix(word, "e"), "f") + "ves"
+	case strings.HasSuffix(lower, "y") && len(lower) > 1 && !strings.ContainsRune("aeiou", rune(lower[len(lower)-2])):
+		return word[:len(word)-1] + "ies"
+	case strings.HasSuffix(lower, "is") && len(lower) > 2:
+		return word[:len(word)-2] + "es"
+	case oesPlurals[lower]:
+		return word + "es"
+	}
+	for _, end := range []string{"s", "sh", "ch", "x", "z"} {
+		if strings.HasSuffix(lower, end) {
+			return word + "es"
+		}
+	}
+	return word + "s"
+}
+
+type collectionKey struct {
+	namer CollectionNamer
+	t     reflect.Type
+}
+
+// Resolved collection names, by namer and model type.
+var collectionNames sync.Map
+
+// Returns the collection of the model, named by the model itself or by the namer. A nil namer is a PluralNamer.
+func collectionOf(namer CollectionNamer, model *Model) Collection {
+	if namer == nil {
+		namer = PluralNamer{}
+	}
+	// Namers that can't be map keys, like funcs, are asked every time.
+	cacheable := reflect.TypeOf(namer).Comparable()
+	key := collectionKey{namer: namer, t: model.Type}
+	if cacheable {
+		if name, ok := collectionNames.Load(key); ok {
+			return Collection{Name: name.(string), Model: model}
+		}
+	}
+
+	name := ""
+	if named, ok := reflect.New(model.Type).Interface().(NamedCollection); ok {
+		name = named.CollectionName()
+	}
+	if name == "" && model.Type.Kind() == reflect.Struct {
+		for i := 0; i < model.Type.NumField(); i++ {
+			if field := model.Type.Field(i); field.Name == "_" {
+				name, _ = parseTagOptions(field.Tag.Get("grf")).Get("collection")
+			}
+		}
+	}
+	if name == "" {
+		name = namer.CollectionName(model)
+	}
+	if cacheable {
+		collectionNames.Store(key, name)
+	}
+	return Collection{Name: name, Model: model}
+}
@@ -0,0 +1,105 @@
+package grf
+
+import (
+	"context"
+	"reflect"
+	"testing"
+)
+
+func TestPluralize(t *testing.T) {
+	var tests = []struct {
+		input string
+		want  string
+	}{
+		{"todo", "todos"},
+		{"box", "boxes"},
+		{"person", "people"},
+		{"Person", "People"},
+		{"child", "children"},
+		{"category", "categories"},
+		{"day", "days"},
+		{"leaf", "leaves"},
+		{"knife", "knives"},
+		{"roof", "roofs"},
+		{"analysis", "analyses"},
+		{"hero", "heroes"},
+		{"photo", "photos"},
+		{"status", "statuses"},
+		{"church", "churches"},
+		{"sheep", "sheep"},
+		{"quiz", "quizzes"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			if got := Pluralize(tt.input); got != tt.want {
+				t.Errorf("got %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+type OrderItem struct{}
+
+type HTTPRequest struct{}
+
+type Page[T any] struct {
+	Items []T
+}
+
+type Shelf struct {
+	_ struct{} `grf:"collection=bookcases"`
+}
+
+type Mouse struct{}
+
+func (m Mouse) CollectionName() string {
+	return "rodents"
+}
+
+// Names every collection after the model, as it is.
+type exactNamer struct{}
+
+func (exactNamer) CollectionName(model *Model) string {
+	return model.Name
+}
+
+func TestCollectionNames(t *testing.T) {
+	var tests = []struct {
+		name  string
+		namer CollectionNamer
+		model *Model
+		want  string
+	}{
+		{"default", nil, getModel[Memo](), "memos"},
+		{"irregular", nil, getModel[Mouse](), "rodents"},
+		{"compound", nil, getModel[OrderItem](), "orderitems"},
+		{"snake case", PluralNamer{Separator: "_"}, getModel[OrderItem](), "order_items"},
+		{"acronym", PluralNamer{Separator: "_"}, getModel[HTTPRequest](), "http_requests"},
+		{"generic", nil, getModel[Page[Memo]](), "pages"},
+		{"struct tag", nil, getModel[Shelf](), "bookcases"},
+		{"method", exactNamer{}, getModel[Mouse](), "rodents"},
+		{"custom namer", exactNamer{}, getModel[OrderItem](), "OrderItem"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := (&Ctx{CollectionNamer: tt.namer}).collection(tt.model).Name; got != tt.want {
+				t.Errorf("got %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCollectionNamerOnCtx(t *testing.T) {
+	backend := NewMemoryBackend()
+	appCtx := &Ctx{Backend: backend, CollectionNamer: exactNamer{}}
+	if err := Create(context.Background(), appCtx, &Memo{Title: "walk the dog"}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	var names []string
+	for name := range backend.collections {
+		names = append(names, name)
+	}
+	if !reflect.DeepEqual(names, []string{"Memo"}) {
+		t.Errorf("got collections %v, want [Memo]", names)
+	}
+}
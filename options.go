@@ -0,0 +1,90 @@
+package grf
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// RouteOption configures the routes registered by RegisterCRUDRoutes and the Add*Route functions.
+type RouteOption func(*routeConfig)
+
+// The configuration of a resource's routes. The handlers find it in the request context.
+type routeConfig struct {
+	// The name of the model of the resource.
+	resource string
+	// Path variables identifying a single object, the json names of the lookup fields.
+	lookup []string
+	// Cache-Control header of the read routes.
+	cacheControl string
+	// Whether the write routes run in a transaction.
+	transactional bool
+	// Whether the routes need an authenticated principal.
+	authentication authentication
+	// Permissions of every route and of the routes of single actions.
+	permissions       []Permission
+	actionPermissions map[Action][]Permission
+	// Throttles of every route and of the routes of single actions.
+	throttle        *Throttle
+	actionThrottles map[Action]*Throttle
+}
+
+// Looks objects up by other fields than the id, like Django REST Framework's lookup_field.
+// The fields are given by their json names and become the path variables of the object routes:
+// WithLookup("slug") serves /{slug}, WithLookup("org", "name") serves /{org}/{name} for compound keys.
+// The fields should be unique together, only the first match is used.
+func WithLookup(fields ...string) RouteOption {
+	return func(c *routeConfig) {
+		c.lookup = fields
+	}
+}
+
+// Builds the route configuration of the model T from the options.
+func newRouteConfig[T any](opts []RouteOption) *routeConfig {
+	model := getModel[T]()
+	config := &routeConfig{resource: model.Name}
+	for _, opt := range opts {
+		opt(config)
+	}
+	for _, name := range config.lookup {
+		if model.FieldByJSON(name) == nil {
+			panic(fmt.Sprintf("grf: %s has no field %q to look objects up by", model.Name, name))
+		}
+	}
+	return config
+}
+
+// The path of a single object under the resource, "/{id}" unless the lookup was changed.
+func (c *routeConfig) objectPath() string {
+	if len(c.lookup) == 0 {
+		return "/{id}"
+	}
+	return "/{" + strings.Join(c.lookup, "}/{") + "}"
+}
+
+// Registers fn with the app context as the handler of a route for the action, wrapped as the options ask for.
+func (c *routeConfig) handle(r Router, method, path string, action Action, ctx *Ctx, fn func(*Ctx, http.ResponseWriter, *http.Request)) {
+	if c.transactional && method != http.MethodGet && method != http.MethodHead {
+		fn = transactional(fn)
+	}
+	fn = c.authorize(action, c.throttled(action, fn))
+	r.Handle(method, path, withRouteConfig(c, H{Ctx: ctx, Fn: fn}))
+}
+
+type routeConfigKey struct{}
+
+// Makes the route configuration available to the handler.
+func withRouteConfig(config *routeConfig, handler http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		handler.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), routeConfigKey{}, config)))
+	})
+}
+
+// Returns the route configuration of the request. Handlers registered directly get the defaults.
+func routeConfigOf(r *http.Request) *routeConfig {
+	if config, ok := r.Context().Value(routeConfigKey{}).(*routeConfig); ok {
+		return config
+	}
+	return &routeConfig{}
+}
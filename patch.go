@@ -0,0 +1,343 @@
+package grf
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// Media types accepted for partial updates.
+const (
+	MergePatchMediaType = "application/merge-patch+json"
+	JSONPatchMediaType  = "application/json-patch+json"
+)
+
+// Patch is a set of field level changes to a stored object.
+// Keys are bson paths of the fields, nested fields are joined with dots ("address.city").
+type Patch struct {
+	Set    map[string]any
+	Unset  []string
+	Push   map[string][]any
+	Pull   map[string][]any
+	Rename map[string]string
+	// Amounts to add to numeric fields.
+	Inc map[string]any
+	// Conditions the stored object must satisfy for the patch to apply. Filled by JSON Patch "test" operations.
+	Test Filter
+}
+
+// Reports whether the patch changes nothing.
+func (p Patch) IsEmpty() bool {
+	return len(p.Set) == 0 && len(p.Unset) == 0 && len(p.Push) == 0 && len(p.Pull) == 0 && len(p.Rename) == 0 && len(p.Inc) == 0
+}
+
+// Parses a JSON Merge Patch (RFC 7396) for the model K.
+// Members set to null are removed, nested objects are merged and everything else is set.
+func ParseMergePatch[K any](data []byte) (Patch, error) {
+	patch := newPatch()
+	var doc map[string]json.RawMessage
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return Patch{}, fmt.Errorf("merge patch must be a JSON object: %w", err)
+	}
+	if err := patch.merge(getModel[K](), "", doc); err != nil {
+		return Patch{}, err
+	}
+	return patch, nil
+}
+
+func (p *Patch) merge(model *Model, prefix string, doc map[string]json.RawMessage) error {
+	for name, raw := range doc {
+		field := model.FieldByJSON(name)
+		if field == nil {
+			return fmt.Errorf("unknown field %q", prefix+name)
+		}
+		if field.BSONName == "_id" {
+			return fmt.Errorf("field %q cannot be patched", prefix+name)
+		}
+		path := prefix + field.BSONName
+
+		if isNull(raw) {
+			p.Unset = append(p.Unset, path)
+			continue
+		}
+		if isNestedStruct(field.Type) && bytes.HasPrefix(bytes.TrimSpace(raw), []byte("{")) {
+			var nested map[string]json.RawMessage
+			if err := json.Unmarshal(raw, &nested); err != nil {
+				return fmt.Errorf("invalid value for field %q: %w", prefix+name, err)
+			}
+			if err := p.merge(modelOf(field.Type), path+".", nested); err != nil {
+				return err
+			}
+			continue
+		}
+		value, err := decodeAs(field.Type, raw)
+		if err != nil {
+			return fmt.Errorf("invalid value for field %q: %w", prefix+name, err)
+		}
+		p.Set[path] = value
+	}
+	return nil
+}
+
+type jsonPatchOperation struct {
+	Op    string          `json:"op"`
+	Path  string          `json:"path"`
+	From  string          `json:"from"`
+	Value json.RawMessage `json:"value"`
+}
+
+// Parses a JSON Patch (RFC 6902) for the model K.
+// add, replace, remove, move and test are supported. Appending to arrays works through the "-" index,
+// other array positions can only be replaced. copy is not supported as it can not be applied atomically.
+// The operations are applied at once rather than one after the other, so a patch may change a field only once
+// and may only test a field before changing it. Other patches fail with ErrValidation.
+// Like tests, the array elements replace operations change and the members remove operations remove have to exist,
+// the update fails with ErrConflict otherwise.
+func ParseJSONPatch[K any](data []byte) (Patch, error) {
+	var operations []jsonPatchOperation
+	if err := json.Unmarshal(data, &operations); err != nil {
+		return Patch{}, fmt.Errorf("json patch must be an array of operations: %w", err)
+	}
+
+	model := getModel[K]()
+	patch := newPatch()
+	changed := patchPaths{}
+	for i, operation := range operations {
+		target, err := resolvePointer(model, operation.Path)
+		if err != nil {
+			return Patch{}, fmt.Errorf("operation %d: %w", i, err)
+		}
+		switch operation.Op {
+		case "add", "replace":
+			if target.index && operation.Op == "add" {
+				return Patch{}, fmt.Errorf("operation %d: inserting into an array is only supported at the end (\"-\")", i)
+			}
+			value, err := decodeAs(target.typ, operation.Value)
+			if err != nil {
+				return Patch{}, fmt.Errorf("operation %d: invalid value for %q: %w", i, operation.Path, err)
+			}
+			if err := changed.check(i, operation, target.append, target.path); err != nil {
+				return Patch{}, err
+			}
+			if target.append {
+				patch.Push[target.path] = append(patch.Push[target.path], value)
+			} else {
+				patch.Set[target.path] = value
+			}
+			if target.index {
+				// Setting an element past the end would pad the array with nulls.
+				patch.Test = append(patch.Test, Condition{Field: target.path, Op: OpExists, Value: true})
+			}
+		case "remove":
+			if target.index || target.append {
+				return Patch{}, fmt.Errorf("operation %d: removing array elements is not supported", i)
+			}
+			if err := changed.check(i, operation, false, target.path); err != nil {
+				return Patch{}, err
+			}
+			patch.Unset = append(patch.Unset, target.path)
+			patch.Test = append(patch.Test, Condition{Field: target.path, Op: OpExists, Value: true})
+		case "move":
+			from, err := resolvePointer(model, operation.From)
+			if err != nil {
+				return Patch{}, fmt.Errorf("operation %d: %w", i, err)
+			}
+			if from.index || from.append || target.index || target.append {
+				return Patch{}, fmt.Errorf("operation %d: moving array elements is not supported", i)
+			}
+			if from.typ != target.typ {
+				return Patch{}, fmt.Errorf("operation %d: cannot move %q to %q, the fields have different types", i, operation.From, operation.Path)
+			}
+			if err := changed.check(i, operation, false, from.path, target.path); err != nil {
+				return Patch{}, err
+			}
+			patch.Rename[from.path] = target.path
+		case "test":
+			value, err := decodeAs(target.typ, operation.Value)
+			if err != nil {
+				return Patch{}, fmt.Errorf("operation %d: invalid value for %q: %w", i, operation.Path, err)
+			}
+			if err := changed.check(i, operation, false, target.path); err != nil {
+				return Patch{}, err
+			}
+			patch.Test = append(patch.Test, Condition{Field: target.path, Op: OpEq, Value: value})
+		case "copy":
+			return Patch{}, fmt.Errorf("operation %d: copy is not supported", i)
+		default:
+			return Patch{}, fmt.Errorf("operation %d: unknown op %q", i, operation.Op)
+		}
+	}
+	return patch, nil
+}
+
+// The paths changed by the operations of a JSON Patch so far, with whether they were appended to.
+type patchPaths map[string]bool
+
+// Records the paths the operation changes. Returns an ErrValidation error when it touches a path an earlier
+// operation changed, as applying them at once would not give the result of applying them in order.
+// Appending to an array more than once is fine.
+func (p patchPaths) check(i int, operation jsonPatchOperation, appending bool, paths ...string) error {
+	if operation.Op == "test" {
+		if p.overlaps(paths[0], false) {
+			return newError(ErrValidation, fmt.Sprintf("operation %d: %q is tested after it is changed", i, operation.Path), nil)
+		}
+		return nil
+	}
+	for _, path := range paths {
+		if p.overlaps(path, appending) {
+			return newError(ErrValidation, fmt.Sprintf("operation %d: changes a field an earlier operation changed", i), nil)
+		}
+	}
+	for _, path := range paths {
+		p[path] = appending
+	}
+	return nil
+}
+
+// Reports whether the path, or a field in or around it, was changed. Appends to the same array don't count when appending.
+func (p patchPaths) overlaps(path string, appending bool) bool {
+	for changed, appended := range p {
+		if changed == path && appending && appended {
+			continue
+		}
+		if changed == path || strings.HasPrefix(changed, path+".") || strings.HasPrefix(path, changed+".") {
+			return true
+		}
+	}
+	return false
+}
+
+// The field a JSON pointer resolves to.
+type patchTarget struct {
+	path   string
+	typ    reflect.Type
+	index  bool // The last segment is an array index.
+	append bool // The last segment is "-", the end of an array.
+}
+
+// Resolves a JSON pointer ("/address/city", "/tags/-") against the json tags of the model.
+func resolvePointer(model *Model, pointer string) (patchTarget, error) {
+	if !strings.HasPrefix(pointer, "/") {
+		return patchTarget{}, fmt.Errorf("invalid path %q", pointer)
+	}
+	segments := strings.Split(pointer[1:], "/")
+	var target patchTarget
+	var t reflect.Type
+	var path []string
+	for i, segment := range segments {
+		segment = strings.NewReplacer("~1", "/", "~0", "~").Replace(segment)
+		last := i == len(segments)-1
+		switch {
+		case t == nil || indirect(t).Kind() == reflect.Struct:
+			if t != nil {
+				model = modelOf(t)
+			}
+			field := model.FieldByJSON(segment)
+			if field == nil {
+				return patchTarget{}, fmt.Errorf("unknown field in path %q", pointer)
+			}
+			if field.BSONName == "_id" {
+				return patchTarget{}, fmt.Errorf("path %q cannot be patched", pointer)
+			}
+			t = field.Type
+			path = append(path, field.BSONName)
+		case indirect(t).Kind() == reflect.Slice || indirect(t).Kind() == reflect.Array:
+			t = indirect(t).Elem()
+			if segment == "-" && last {
+				target.append = true
+				break
+			}
+			if _, err := strconv.Atoi(segment); err != nil {
+				return patchTarget{}, fmt.Errorf("invalid array index in path %q", pointer)
+			}
+			target.index = last
+			path = append(path, segment)
+		default:
+			return patchTarget{}, fmt.Errorf("path %q goes past a field that is not an object or an array", pointer)
+		}
+	}
+	target.path = strings.Join(path, ".")
+	target.typ = t
+	return target, nil
+}
+
+func newPatch() Patch {
+	return Patch{Set: map[string]any{}, Push: map[string][]any{}, Pull: map[string][]any{}, Rename: map[string]string{}}
+}
+
+// Decodes a raw json value into a new value of type t. Unknown fields of nested objects are rejected.
+func decodeAs(t reflect.Type, raw json.RawMessage) (any, error) {
+	if len(raw) == 0 {
+		return nil, fmt.Errorf("value is missing")
+	}
+	value := reflect.New(t)
+	decoder := json.NewDecoder(bytes.NewReader(raw))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(value.Interface()); err != nil {
+		return nil, err
+	}
+	return value.Elem().Interface(), nil
+}
+
+func isNull(raw json.RawMessage) bool {
+	return bytes.Equal(bytes.TrimSpace(raw), []byte("null"))
+}
+
+// Reports whether the type is a struct that is stored as an embedded document.
+func isNestedStruct(t reflect.Type) bool {
+	t = indirect(t)
+	return t.Kind() == reflect.Struct && t != timeType && t != objectIDType
+}
+
+// Translates the patch into a mongodb update document.
+func (p Patch) bson() bson.D {
+	update := bson.D{}
+	if len(p.Set) > 0 {
+		set := bson.D{}
+		for path, value := range p.Set {
+			set = append(set, bson.E{Key: path, Value: value})
+		}
+		update = append(update, bson.E{Key: "$set", Value: set})
+	}
+	if len(p.Unset) > 0 {
+		unset := bson.D{}
+		for _, path := range p.Unset {
+			unset = append(unset, bson.E{Key: path, Value: ""})
+		}
+		update = append(update, bson.E{Key: "$unset", Value: unset})
+	}
+	if len(p.Push) > 0 {
+		push := bson.D{}
+		for path, values := range p.Push {
+			push = append(push, bson.E{Key: path, Value: bson.D{{Key: "$each", Value: values}}})
+		}
+		update = append(update, bson.E{Key: "$push", Value: push})
+	}
+	if len(p.Pull) > 0 {
+		pull := bson.D{}
+		for path, values := range p.Pull {
+			pull = append(pull, bson.E{Key: path, Value: bson.D{{Key: "$in", Value: values}}})
+		}
+		update = append(update, bson.E{Key: "$pull", Value: pull})
+	}
+	if len(p.Inc) > 0 {
+		inc := bson.D{}
+		for path, amount := range p.Inc {
+			inc = append(inc, bson.E{Key: path, Value: amount})
+		}
+		update = append(update, bson.E{Key: "$inc", Value: inc})
+	}
+	if len(p.Rename) > 0 {
+		rename := bson.D{}
+		for from, to := range p.Rename {
+			rename = append(rename, bson.E{Key: from, Value: to})
+		}
+		update = append(update, bson.E{Key: "$rename", Value: rename})
+	}
+	return update
+}
@@ -0,0 +1,157 @@
+package grf
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type Address struct {
+	City string `json:"city" bson:"city"`
+	Zip  string `json:"zip" bson:"zip"`
+}
+
+type Contact struct {
+	Name    string   `json:"name" bson:"name"`
+	Nick    string   `json:"nick" bson:"nickname"`
+	Tags    []string `json:"tags" bson:"tags"`
+	Address Address  `json:"address" bson:"address"`
+	Age     int      `json:"age" bson:"age"`
+}
+
+func TestParseMergePatch(t *testing.T) {
+	patch, err := ParseMergePatch[Contact]([]byte(`{"name": "Ann", "nick": null, "address": {"city": "Kochi"}}`))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	wantSet := map[string]any{"name": "Ann", "address.city": "Kochi"}
+	if !reflect.DeepEqual(patch.Set, wantSet) {
+		t.Errorf("set: got %v, want %v", patch.Set, wantSet)
+	}
+	if !reflect.DeepEqual(patch.Unset, []string{"nickname"}) {
+		t.Errorf("unset: got %v, want [nickname]", patch.Unset)
+	}
+}
+
+func TestParseJSONPatch(t *testing.T) {
+	patch, err := ParseJSONPatch[Contact]([]byte(`[
+		{"op": "test", "path": "/age", "value": 30},
+		{"op": "replace", "path": "/address/zip", "value": "682001"},
+		{"op": "add", "path": "/tags/-", "value": "friend"},
+		{"op": "remove", "path": "/address/city"},
+		{"op": "move", "from": "/name", "path": "/nick"}
+	]`))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !reflect.DeepEqual(patch.Set, map[string]any{"address.zip": "682001"}) {
+		t.Errorf("set: got %v", patch.Set)
+	}
+	if !reflect.DeepEqual(patch.Push, map[string][]any{"tags": {"friend"}}) {
+		t.Errorf("push: got %v", patch.Push)
+	}
+	if !reflect.DeepEqual(patch.Unset, []string{"address.city"}) {
+		t.Errorf("unset: got %v", patch.Unset)
+	}
+	if !reflect.DeepEqual(patch.Rename, map[string]string{"name": "nickname"}) {
+		t.Errorf("rename: got %v", patch.Rename)
+	}
+	if !reflect.DeepEqual(patch.Test, Filter{{Field: "age", Op: OpEq, Value: 30}, {Field: "address.city", Op: OpExists, Value: true}}) {
+		t.Errorf("test: got %v", patch.Test)
+	}
+}
+
+func TestPatchRejects(t *testing.T) {
+	var tests = []struct {
+		name  string
+		parse func([]byte) (Patch, error)
+		input string
+	}{
+		{"merge unknown field", ParseMergePatch[Contact], `{"colour": "red"}`},
+		{"merge wrong type", ParseMergePatch[Contact], `{"age": "old"}`},
+		{"merge unknown nested field", ParseMergePatch[Contact], `{"address": {"street": "x"}}`},
+		{"json patch unknown path", ParseJSONPatch[Contact], `[{"op": "replace", "path": "/colour", "value": "red"}]`},
+		{"json patch copy", ParseJSONPatch[Contact], `[{"op": "copy", "from": "/name", "path": "/nick"}]`},
+		{"json patch insert into array", ParseJSONPatch[Contact], `[{"op": "add", "path": "/tags/0", "value": "x"}]`},
+		{"json patch not an array", ParseJSONPatch[Contact], `{"op": "remove"}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := tt.parse([]byte(tt.input)); err == nil {
+				t.Errorf("expected an error for %s", tt.input)
+			}
+		})
+	}
+}
+
+func TestJSONPatchOrder(t *testing.T) {
+	var tests = []struct {
+		name  string
+		input string
+		valid bool
+	}{
+		{"add then remove", `[{"op": "add", "path": "/name", "value": "Ann"}, {"op": "remove", "path": "/name"}]`, false},
+		{"test after replace", `[{"op": "replace", "path": "/age", "value": 31}, {"op": "test", "path": "/age", "value": 31}]`, false},
+		{"test after nested replace", `[{"op": "replace", "path": "/address/city", "value": "Kochi"}, {"op": "test", "path": "/address", "value": {"city": "Kochi"}}]`, false},
+		{"replace inside replaced", `[{"op": "replace", "path": "/address", "value": {}}, {"op": "replace", "path": "/address/zip", "value": "1"}]`, false},
+		{"move onto replaced", `[{"op": "replace", "path": "/nick", "value": "A"}, {"op": "move", "from": "/name", "path": "/nick"}]`, false},
+		{"test before replace", `[{"op": "test", "path": "/age", "value": 30}, {"op": "replace", "path": "/age", "value": 31}]`, true},
+		{"appends", `[{"op": "add", "path": "/tags/-", "value": "a"}, {"op": "add", "path": "/tags/-", "value": "b"}]`, true},
+		{"append then replace", `[{"op": "add", "path": "/tags/-", "value": "a"}, {"op": "replace", "path": "/tags", "value": []}]`, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := ParseJSONPatch[Contact]([]byte(tt.input))
+			if tt.valid && err != nil {
+				t.Errorf("unexpected error: %v", err)
+			}
+			if !tt.valid && !errors.Is(err, ErrValidation) {
+				t.Errorf("got %v, want a validation error", err)
+			}
+		})
+	}
+}
+
+type Card struct {
+	Id   primitive.ObjectID `json:"id,omitempty" bson:"_id,omitempty"`
+	Tags []string           `json:"tags" bson:"tags"`
+	Note string             `json:"note" bson:"note,omitempty"`
+}
+
+func TestJSONPatchMissingPaths(t *testing.T) {
+	for name, appCtx := range backendContexts(t) {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			card := Card{Tags: []string{"a"}}
+			if err := Create(ctx, appCtx, &card); err != nil {
+				t.Fatal(err)
+			}
+			var tests = []struct {
+				name  string
+				patch string
+				want  error
+			}{
+				{"replace past the end", `[{"op": "replace", "path": "/tags/3", "value": "b"}]`, ErrConflict},
+				{"remove a missing member", `[{"op": "remove", "path": "/note"}]`, ErrConflict},
+				{"replace an element", `[{"op": "replace", "path": "/tags/0", "value": "b"}]`, nil},
+			}
+			for _, tt := range tests {
+				patch, err := ParseJSONPatch[Card]([]byte(tt.patch))
+				if err != nil {
+					t.Fatal(err)
+				}
+				var updated Card
+				if err := UpdateOne(ctx, appCtx, &updated, card.Id.Hex(), patch); !errors.Is(err, tt.want) {
+					t.Errorf("%s: got %v, want %v", tt.name, err, tt.want)
+				}
+			}
+			var stored Card
+			if err := ReadOne(ctx, appCtx, &stored, card.Id.Hex()); err != nil || !reflect.DeepEqual(stored.Tags, []string{"b"}) {
+				t.Errorf("got %+v, %v", stored, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,183 @@
+package grf
+
+import (
+	"context"
+	"net/http"
+	"reflect"
+)
+
+// Permission decides who may do what on the routes of a resource, like the permission classes of Django REST Framework.
+// HasPermission is asked before the handler runs. HasObjectPermission is asked about the object a request reads,
+// replaces, updates or deletes once it is loaded, the object is a pointer to the model.
+// Lists are not checked object by object.
+//
+// The route actions are ActionList and ActionRead for GET, ActionCreate for POST, ActionReplace for PUT,
+// ActionUpdate for PATCH and ActionDelete for DELETE. Bulk routes are checked as the action of their items,
+// the trash as ActionList, restoring as ActionUpdate and purging as ActionDelete.
+type Permission interface {
+	HasPermission(r *http.Request, action Action) bool
+	HasObjectPermission(r *http.Request, action Action, object any) bool
+}
+
+// Sets the permissions of every route of the resource. All of them have to grant a request, see AnyOf otherwise.
+func WithPermissions(permissions ...Permission) RouteOption {
+	return func(c *routeConfig) {
+		c.permissions = permissions
+	}
+}
+
+// Sets the permissions of the routes of one action, instead of the ones of WithPermissions.
+func WithActionPermissions(action Action, permissions ...Permission) RouteOption {
+	return func(c *routeConfig) {
+		if c.actionPermissions == nil {
+			c.actionPermissions = map[Action][]Permission{}
+		}
+		c.actionPermissions[action] = permissions
+	}
+}
+
+// Returns the permissions of the routes of the action.
+func (c *routeConfig) permissionsFor(action Action) []Permission {
+	if permissions, ok := c.actionPermissions[action]; ok {
+		return permissions
+	}
+	return c.permissions
+}
+
+// Returns fn checking the permissions of the action first.
+func (c *routeConfig) authorize(action Action, fn func(*Ctx, http.ResponseWriter, *http.Request)) func(*Ctx, http.ResponseWriter, *http.Request) {
+	return func(ctx *Ctx, w http.ResponseWriter, r *http.Request) {
+		for _, permission := range c.permissionsFor(action) {
+			if !permission.HasPermission(r, action) {
+				WriteError(w, r, denied(r))
+				return
+			}
+		}
+		fn(ctx, w, r)
+	}
+}
+
+// Checks the object permissions of the route for the object.
+func checkObjectPermissions(r *http.Request, action Action, object any) error {
+	for _, permission := range routeConfigOf(r).permissionsFor(action) {
+		if !permission.HasObjectPermission(r, action, object) {
+			return denied(r)
+		}
+	}
+	return nil
+}
+
+// Loads the stored object matching the filter and checks the object permissions of the route for it,
+// before the object is changed. Nothing is loaded when the action has no permissions.
+func authorizeObject[K any](ctx context.Context, appCtx *Ctx, r *http.Request, action Action, filter Filter) error {
+	if len(routeConfigOf(r).permissionsFor(action)) == 0 {
+		return nil
+	}
+	ctx, cancel := operationContext[K](ctx, appCtx, ActionRead)
+	defer cancel()
+
+	filter, err := scoped[K](ctx, filter)
+	if err != nil {
+		return err
+	}
+	var object K
+	if err := RepositoryFor[K](appCtx).Get(ctx, filter, &object); err != nil {
+		return err
+	}
+	return checkObjectPermissions(r, action, &object)
+}
+
+// Returns the error for a request that was denied, a 401 for anonymous requests and a 403 for the others.
+func denied(r *http.Request) error {
+	if PrincipalFrom(r.Context()) == nil {
+		return newError(ErrUnauthorized, "authentication required", nil)
+	}
+	return newError(ErrForbidden, "you are not allowed to do this", nil)
+}
+
+// IsAuthenticated grants requests with a principal.
+type IsAuthenticated struct{}
+
+func (IsAuthenticated) HasPermission(r *http.Request, action Action) bool {
+	return PrincipalFrom(r.Context()) != nil
+}
+
+func (IsAuthenticated) HasObjectPermission(r *http.Request, action Action, object any) bool {
+	return true
+}
+
+// IsAdmin grants requests of principals with the admin role.
+type IsAdmin struct{}
+
+func (IsAdmin) HasPermission(r *http.Request, action Action) bool {
+	return PrincipalFrom(r.Context()).HasRole("admin")
+}
+
+func (IsAdmin) HasObjectPermission(r *http.Request, action Action, object any) bool {
+	return PrincipalFrom(r.Context()).HasRole("admin")
+}
+
+// IsOwner grants requests of principals to their own objects.
+// The owner of an object is in the field with the json name Field, its createdBy field when Field is empty.
+type IsOwner struct {
+	Field string
+}
+
+func (IsOwner) HasPermission(r *http.Request, action Action) bool {
+	return PrincipalFrom(r.Context()) != nil
+}
+
+func (o IsOwner) HasObjectPermission(r *http.Request, action Action, object any) bool {
+	principal := PrincipalFrom(r.Context())
+	if principal == nil {
+		return false
+	}
+	model := modelOf(reflect.TypeOf(object))
+	field := model.FieldWithOption(AuditCreatedBy)
+	if o.Field != "" {
+		field = model.FieldByJSON(o.Field)
+	}
+	if field == nil {
+		return false
+	}
+	owner := reflect.Indirect(reflect.ValueOf(object).Elem().FieldByIndex(field.Index))
+	return owner.IsValid() && formatID(owner.Interface()) == principal.ID
+}
+
+// ReadOnly grants listing and reading.
+type ReadOnly struct{}
+
+func (ReadOnly) HasPermission(r *http.Request, action Action) bool {
+	return action == ActionList || action == ActionRead
+}
+
+func (ReadOnly) HasObjectPermission(r *http.Request, action Action, object any) bool {
+	return action == ActionList || action == ActionRead
+}
+
+// Returns a permission granting what any of the permissions grants.
+// AnyOf(ReadOnly{}, IsOwner{}) lets anyone read and owners change their objects.
+func AnyOf(permissions ...Permission) Permission {
+	return anyOf(permissions)
+}
+
+type anyOf []Permission
+
+func (a anyOf) HasPermission(r *http.Request, action Action) bool {
+	for _, permission := range a {
+		if permission.HasPermission(r, action) {
+			return true
+		}
+	}
+	return false
+}
+
+// Only permissions that also grant the request itself count for the object.
+func (a anyOf) HasObjectPermission(r *http.Request, action Action, object any) bool {
+	for _, permission := range a {
+		if permission.HasPermission(r, action) && permission.HasObjectPermission(r, action, object) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,87 @@
+package grf
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type Recipe struct {
+	Id        primitive.ObjectID `json:"id,omitempty" bson:"_id,omitempty"`
+	Title     string             `json:"title" bson:"title"`
+	CreatedBy string             `json:"createdBy" bson:"createdBy" grf:"createdBy"`
+}
+
+func TestPermissions(t *testing.T) {
+	secret := []byte("secret")
+	tokens := map[string]string{}
+	for _, user := range []string{"ada", "grace", "admin"} {
+		claims := map[string]any{"sub": user}
+		if user == "admin" {
+			claims["roles"] = []string{"admin"}
+		}
+		tokens[user], _ = SignJWT(claims, secret)
+	}
+	for name, appCtx := range backendContexts(t) {
+		t.Run(name, func(t *testing.T) {
+			appCtx.Authenticators = []Authenticator{JWTAuthenticator{Key: secret}}
+			mux := http.NewServeMux()
+			RegisterCRUDRoutes[Recipe]("/recipes", ServeMux(mux), appCtx, Public(),
+				WithPermissions(AnyOf(ReadOnly{}, IsOwner{})),
+				WithActionPermissions(ActionDelete, IsAdmin{}))
+			send := func(user, method, path, body string) *httptest.ResponseRecorder {
+				req := httptest.NewRequest(method, path, strings.NewReader(body))
+				if user != "" {
+					req.Header.Set("Authorization", "Bearer "+tokens[user])
+				}
+				res := httptest.NewRecorder()
+				mux.ServeHTTP(res, req)
+				return res
+			}
+
+			res := send("ada", http.MethodPost, "/recipes/", `{"title": "pancakes"}`)
+			if res.Code != http.StatusCreated {
+				t.Fatalf("create: status %d, body %s", res.Code, res.Body.String())
+			}
+			location := res.Header().Get("Location")
+			id := location[strings.LastIndex(location, "/")+1:]
+
+			var tests = []struct {
+				user   string
+				method string
+				path   string
+				body   string
+				status int
+			}{
+				{"", http.MethodGet, "/recipes/", "", http.StatusOK},
+				{"", http.MethodGet, location, "", http.StatusOK},
+				{"", http.MethodPost, "/recipes/", `{"title": "waffles"}`, http.StatusUnauthorized},
+				{"grace", http.MethodPost, "/recipes/", `{"title": "waffles"}`, http.StatusCreated},
+				{"grace", http.MethodPut, location, `{"title": "crepes"}`, http.StatusForbidden},
+				{"grace", http.MethodPatch, location, `{"title": "crepes"}`, http.StatusForbidden},
+				{"grace", http.MethodPatch, "/recipes/bulk", `[{"id": "` + id + `", "patch": {"title": "crepes"}}]`, http.StatusMultiStatus},
+				{"ada", http.MethodPut, location, `{"title": "crepes"}`, http.StatusOK},
+				{"ada", http.MethodPatch, location, `{"title": "blinis"}`, http.StatusOK},
+				{"ada", http.MethodDelete, location, "", http.StatusForbidden},
+				{"admin", http.MethodDelete, location, "", http.StatusNoContent},
+			}
+			for _, tt := range tests {
+				res := send(tt.user, tt.method, tt.path, tt.body)
+				if res.Code != tt.status {
+					t.Fatalf("%s %s %s: status %d, want %d: %s", tt.user, tt.method, tt.path, res.Code, tt.status, res.Body.String())
+				}
+				if res.Code == http.StatusMultiStatus {
+					var results []BulkResult
+					json.Unmarshal(res.Body.Bytes(), &results)
+					if len(results) != 1 || results[0].Status != http.StatusForbidden {
+						t.Errorf("bulk results %+v, want a 403", results)
+					}
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,37 @@
+package grf
+
+import (
+	"context"
+	"slices"
+)
+
+// Principal is the authenticated user or client a request is made on behalf of.
+type Principal struct {
+	// Identifies the user or client. It is what createdBy fields are filled with.
+	ID string
+	// The tenant the principal belongs to, what the tenant fields of scoped models hold.
+	Tenant string
+	// Roles granted to the principal, like "admin".
+	Roles []string
+	// Anything else known about the principal, like the claims of a JWT.
+	Claims map[string]any
+}
+
+// Reports whether the principal has the role. A nil principal has none.
+func (p *Principal) HasRole(role string) bool {
+	return p != nil && slices.Contains(p.Roles, role)
+}
+
+type principalKey struct{}
+
+// Returns a copy of the context carrying the principal.
+// The services find the principal of the operation in their context, so callers outside of a request can act for someone too.
+func ContextWithPrincipal(ctx context.Context, principal *Principal) context.Context {
+	return context.WithValue(ctx, principalKey{}, principal)
+}
+
+// Returns the principal of the context, nil when the operation is anonymous.
+func PrincipalFrom(ctx context.Context) *Principal {
+	principal, _ := ctx.Value(principalKey{}).(*Principal)
+	return principal
+}
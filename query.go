@@ -0,0 +1,267 @@
+package grf
+
+import (
+	"fmt"
+	"net/url"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Operators supported in query string filters. `title__contains=dog` uses OpContains.
+const (
+	OpEq         = "eq"
+	OpNe         = "ne"
+	OpGt         = "gt"
+	OpGte        = "gte"
+	OpLt         = "lt"
+	OpLte        = "lte"
+	OpIn         = "in"
+	OpContains   = "contains"
+	OpIContains  = "icontains"
+	OpStartsWith = "startswith"
+)
+
+// Holds when the field is stored, or when it isn't for the value false. Patches use it, query strings can't.
+const OpExists = "exists"
+
+var filterOperators = []string{OpEq, OpNe, OpGt, OpGte, OpLt, OpLte, OpIn, OpContains, OpIContains, OpStartsWith}
+
+// Condition is a single filter on a field. Field is the bson name of the field.
+type Condition struct {
+	Field string
+	Op    string
+	Value any
+}
+
+// Filter is a list of conditions that must all hold.
+type Filter []Condition
+
+// SortField orders results by a field. Field is the bson name of the field.
+type SortField struct {
+	Field string
+	Desc  bool
+}
+
+// Query describes which objects to read and in what order.
+// The zero value reads everything.
+type Query struct {
+	Filter Filter
+	Sort   []SortField
+	Limit  int64
+	Skip   int64
+}
+
+// How many objects a list request returns when it doesn't give a limit. 0 returns every object.
+var DefaultPageSize int64 = 100
+
+// The largest limit a list request may give, larger ones are lowered to it. 0 allows any limit.
+var MaxPageSize int64 = 1000
+
+// Parses the query string of a list request for the model K.
+//
+//	?limit=10&page=2&sort=-title,completed&completed=true&title__contains=dog
+//
+// Only fields tagged with `grf:"filter"` can be filtered on and only fields tagged with `grf:"sort"` can be sorted on.
+// Filters use the json names of the fields. The limit defaults to DefaultPageSize and is at most MaxPageSize.
+func ParseQuery[K any](values url.Values) (Query, error) {
+	model := getModel[K]()
+	var query Query
+	var page int64
+
+	for key, vals := range values {
+		for _, val := range vals {
+			var err error
+			switch key {
+			case "limit":
+				query.Limit, err = parseCount(key, val)
+			case "offset":
+				query.Skip, err = parseCount(key, val)
+			case "page":
+				page, err = parseCount(key, val)
+				if err == nil && page < 1 {
+					err = fmt.Errorf("page must be 1 or greater")
+				}
+			case "sort":
+				var sort []SortField
+				sort, err = parseSort(model, val)
+				query.Sort = append(query.Sort, sort...)
+			default:
+				var condition Condition
+				condition, err = parseCondition(model, key, val)
+				query.Filter = append(query.Filter, condition)
+			}
+			if err != nil {
+				return Query{}, err
+			}
+		}
+	}
+
+	if query.Limit == 0 {
+		query.Limit = DefaultPageSize
+	}
+	if MaxPageSize > 0 && (query.Limit == 0 || query.Limit > MaxPageSize) {
+		query.Limit = MaxPageSize
+	}
+	if page > 0 {
+		if query.Limit == 0 {
+			return Query{}, fmt.Errorf("page requires a limit")
+		}
+		query.Skip = (page - 1) * query.Limit
+	}
+	return query, nil
+}
+
+func parseCount(key, val string) (int64, error) {
+	n, err := strconv.ParseInt(val, 10, 64)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("%s must be a non-negative integer", key)
+	}
+	return n, nil
+}
+
+func parseSort(model *Model, val string) ([]SortField, error) {
+	var sort []SortField
+	for _, name := range strings.Split(val, ",") {
+		name = strings.TrimSpace(name)
+		desc := strings.HasPrefix(name, "-")
+		name = strings.TrimPrefix(name, "-")
+		field := model.FieldByJSON(name)
+		if field == nil || !field.Options.Has("sort") {
+			return nil, fmt.Errorf("cannot sort on field %q", name)
+		}
+		sort = append(sort, SortField{Field: field.BSONName, Desc: desc})
+	}
+	return sort, nil
+}
+
+func parseCondition(model *Model, key, val string) (Condition, error) {
+	name, op, found := strings.Cut(key, "__")
+	if !found {
+		op = OpEq
+	}
+	field := model.FieldByJSON(name)
+	if field == nil || !field.Options.Has("filter") {
+		return Condition{}, fmt.Errorf("cannot filter on field %q", name)
+	}
+
+	condition := Condition{Field: field.BSONName, Op: op}
+	var err error
+	switch op {
+	case OpEq, OpNe, OpGt, OpGte, OpLt, OpLte:
+		condition.Value, err = parseFieldValue(field.Type, val)
+	case OpIn:
+		parts := strings.Split(val, ",")
+		values := make([]any, len(parts))
+		for i, part := range parts {
+			values[i], err = parseFieldValue(field.Type, part)
+			if err != nil {
+				break
+			}
+		}
+		condition.Value = values
+	case OpContains, OpIContains, OpStartsWith:
+		if indirect(field.Type).Kind() != reflect.String {
+			return Condition{}, fmt.Errorf("operator %q needs a string field, %q is not one", op, name)
+		}
+		condition.Value = val
+	default:
+		return Condition{}, fmt.Errorf("unknown filter operator %q, expected one of %s", op, strings.Join(filterOperators, ", "))
+	}
+	if err != nil {
+		return Condition{}, fmt.Errorf("invalid value %q for field %q: %w", val, name, err)
+	}
+	return condition, nil
+}
+
+var objectIDType = reflect.TypeOf(primitive.ObjectID{})
+var timeType = reflect.TypeOf(time.Time{})
+
+// Converts a query string value to the type of the field.
+func parseFieldValue(t reflect.Type, val string) (any, error) {
+	t = indirect(t)
+	switch t {
+	case objectIDType:
+		return primitive.ObjectIDFromHex(val)
+	case timeType:
+		return time.Parse(time.RFC3339, val)
+	}
+	switch t.Kind() {
+	case reflect.String:
+		return val, nil
+	case reflect.Bool:
+		return strconv.ParseBool(val)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return strconv.ParseInt(val, 10, 64)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return strconv.ParseUint(val, 10, 64)
+	case reflect.Float32, reflect.Float64:
+		return strconv.ParseFloat(val, 64)
+	}
+	return nil, fmt.Errorf("unsupported field type %s", t)
+}
+
+func indirect(t reflect.Type) reflect.Type {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	return t
+}
+
+// Translates the filter into a mongodb filter document.
+func (f Filter) bson() bson.D {
+	conditions := bson.A{}
+	for _, c := range f {
+		var value any
+		switch c.Op {
+		case OpEq, "":
+			value = c.Value
+		case OpContains:
+			value = primitive.Regex{Pattern: regexp.QuoteMeta(fmt.Sprint(c.Value))}
+		case OpIContains:
+			value = primitive.Regex{Pattern: regexp.QuoteMeta(fmt.Sprint(c.Value)), Options: "i"}
+		case OpStartsWith:
+			value = primitive.Regex{Pattern: "^" + regexp.QuoteMeta(fmt.Sprint(c.Value))}
+		default:
+			value = bson.D{{Key: "$" + c.Op, Value: c.Value}}
+		}
+		conditions = append(conditions, bson.D{{Key: c.Field, Value: value}})
+	}
+	switch len(conditions) {
+	case 0:
+		return bson.D{}
+	case 1:
+		return conditions[0].(bson.D)
+	}
+	// $and keeps several conditions on the same field from overwriting each other.
+	return bson.D{{Key: "$and", Value: conditions}}
+}
+
+// Translates the sort, limit and skip of the query into mongodb find options.
+func (q Query) findOptions() *options.FindOptions {
+	opts := options.Find()
+	if len(q.Sort) > 0 {
+		sort := bson.D{}
+		for _, s := range q.Sort {
+			direction := 1
+			if s.Desc {
+				direction = -1
+			}
+			sort = append(sort, bson.E{Key: s.Field, Value: direction})
+		}
+		opts.SetSort(sort)
+	}
+	if q.Limit > 0 {
+		opts.SetLimit(q.Limit)
+	}
+	if q.Skip > 0 {
+		opts.SetSkip(q.Skip)
+	}
+	return opts
+}
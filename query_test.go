@@ -0,0 +1,67 @@
+package grf
+
+import (
+	"net/url"
+	"reflect"
+	"testing"
+)
+
+type Note struct {
+	Title    string `json:"title" bson:"title" grf:"filter,sort"`
+	Priority int    `json:"priority" bson:"priority" grf:"filter,sort"`
+	Done     bool   `json:"done" bson:"is_done" grf:"filter"`
+	Secret   string `json:"secret" bson:"secret"`
+}
+
+func TestParseQueryTableDriven(t *testing.T) {
+	var tests = []struct {
+		name  string
+		input string
+		want  Query
+	}{
+		{"empty query", "", Query{Limit: DefaultPageSize}},
+		{"limit and offset", "limit=5&offset=10", Query{Limit: 5, Skip: 10}},
+		{"page", "limit=5&page=3", Query{Limit: 5, Skip: 10}},
+		{"page without limit", "page=2", Query{Limit: DefaultPageSize, Skip: DefaultPageSize}},
+		{"limit over the max", "limit=5000", Query{Limit: MaxPageSize}},
+		{"sort", "sort=-priority,title", Query{Sort: []SortField{{Field: "priority", Desc: true}, {Field: "title"}}, Limit: DefaultPageSize}},
+		{"bool filter uses bson name", "done=true", Query{Filter: Filter{{Field: "is_done", Op: OpEq, Value: true}}, Limit: DefaultPageSize}},
+		{"contains filter", "title__contains=dog", Query{Filter: Filter{{Field: "title", Op: OpContains, Value: "dog"}}, Limit: DefaultPageSize}},
+		{"in filter", "priority__in=1,2", Query{Filter: Filter{{Field: "priority", Op: OpIn, Value: []any{int64(1), int64(2)}}}, Limit: DefaultPageSize}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			values, _ := url.ParseQuery(tt.input)
+			got, err := ParseQuery[Note](values)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseQueryRejects(t *testing.T) {
+	var tests = []struct {
+		name  string
+		input string
+	}{
+		{"field not whitelisted", "secret=x"},
+		{"sort not whitelisted", "sort=done"},
+		{"unknown field", "colour=red"},
+		{"unknown operator", "title__like=dog"},
+		{"bad value", "priority=high"},
+		{"contains on non string", "priority__contains=1"},
+		{"negative limit", "limit=-1"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			values, _ := url.ParseQuery(tt.input)
+			if _, err := ParseQuery[Note](values); err == nil {
+				t.Errorf("expected an error for %q", tt.input)
+			}
+		})
+	}
+}
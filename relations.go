@@ -0,0 +1,176 @@
+package grf
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"reflect"
+	"strings"
+	"sync"
+	"time"
+)
+
+// What happens to referencing objects when the object they reference is deleted.
+// Declared on the referencing field: `grf:"ref=Project,onDelete=cascade"`.
+const (
+	// The referencing objects are deleted too.
+	OnDeleteCascade = "cascade"
+	// The delete fails with ErrConflict while referencing objects exist. This is the default.
+	OnDeleteRestrict = "restrict"
+	// The reference is cleared. References held in slices are pulled from the slice.
+	OnDeleteSetNull = "setNull"
+)
+
+var (
+	registryMutex sync.RWMutex
+	registry      = map[string]*Model{}
+)
+
+// Registers a model so grf knows about the references it declares.
+// RegisterCRUDRoutes registers its model, other models referencing something need to be registered with this.
+func RegisterModel[T any]() {
+	registerModel(getModel[T]())
+}
+
+func registerModel(model *Model) {
+	registryMutex.Lock()
+	defer registryMutex.Unlock()
+	registry[model.Name] = model
+}
+
+// A field of a registered model that references another model.
+type relation struct {
+	model    *Model
+	field    *Field
+	onDelete string
+}
+
+// Returns the fields of registered models that reference the named model.
+func referencesTo(name string) ([]relation, error) {
+	registryMutex.RLock()
+	defer registryMutex.RUnlock()
+
+	var relations []relation
+	for _, model := range registry {
+		for _, field := range model.Fields {
+			if ref, _ := field.Options.Get("ref"); ref != name {
+				continue
+			}
+			onDelete, ok := field.Options.Get("onDelete")
+			if !ok {
+				onDelete = OnDeleteRestrict
+			}
+			switch strings.ToLower(strings.ReplaceAll(onDelete, "-", "")) {
+			case "cascade":
+				onDelete = OnDeleteCascade
+			case "restrict":
+				onDelete = OnDeleteRestrict
+			case "setnull":
+				onDelete = OnDeleteSetNull
+			default:
+				return nil, fmt.Errorf("%s.%s has an unknown onDelete action %q", model.Name, field.Name, onDelete)
+			}
+			relations = append(relations, relation{model: model, field: field, onDelete: onDelete})
+		}
+	}
+	return relations, nil
+}
+
+// Deletes the objects of the model matching the filter and enforces the onDelete actions of everything referencing them.
+// Should run inside a transaction so a restrict further down the chain rolls back the cascades before it.
+// Returns the number of objects of the model that were deleted.
+func deleteWithRelations(ctx context.Context, appCtx *Ctx, model *Model, filter Filter, visited map[string]map[any]bool) (int64, error) {
+	backend := appCtx.backend()
+	idField := model.IDField()
+	if idField == nil {
+		return 0, fmt.Errorf("%s has no _id field to be referenced by", model.Name)
+	}
+
+	// Collecting the ids first, references point at them.
+	objects := reflect.New(reflect.SliceOf(model.Type))
+	if err := backend.Find(ctx, appCtx.collection(model), Query{Filter: filter}, objects.Interface()); err != nil {
+		return 0, err
+	}
+	if visited[model.Name] == nil {
+		visited[model.Name] = map[any]bool{}
+	}
+	var ids []any
+	for i := 0; i < objects.Elem().Len(); i++ {
+		id := objects.Elem().Index(i).FieldByIndex(idField.Index).Interface()
+		// Objects already being deleted further up the chain are skipped, so cyclic references end.
+		if !visited[model.Name][id] {
+			visited[model.Name][id] = true
+			ids = append(ids, id)
+		}
+	}
+	if len(ids) == 0 {
+		return 0, nil
+	}
+
+	relations, err := referencesTo(model.Name)
+	if err != nil {
+		return 0, err
+	}
+	for _, rel := range relations {
+		refFilter := Filter{{Field: rel.field.BSONName, Op: OpIn, Value: ids}}
+		switch rel.onDelete {
+		case OnDeleteRestrict:
+			count, err := backend.Count(ctx, appCtx.collection(rel.model), refFilter)
+			if err != nil {
+				return 0, err
+			}
+			if count > 0 {
+				return 0, newError(ErrConflict, fmt.Sprintf("%d %s objects still reference it", count, rel.model.Name), nil)
+			}
+		case OnDeleteCascade:
+			if field := softDeleteField(rel.model); field != nil {
+				// Soft deleted objects move to the trash like they do when deleted directly, so they can be restored.
+				refFilter = append(refFilter, Condition{Field: field.BSONName, Op: OpEq, Value: nil})
+				patch := touch(rel.model, Patch{Set: map[string]any{field.BSONName: time.Now().UTC()}})
+				trashed, err := backend.UpdateMany(ctx, appCtx.collection(rel.model), refFilter, patch)
+				if err != nil {
+					return 0, err
+				}
+				log.Println("Moved "+rel.model.Name+" objects to the trash.", trashed)
+				continue
+			}
+			if _, err := deleteWithRelations(ctx, appCtx, rel.model, refFilter, visited); err != nil {
+				return 0, err
+			}
+		case OnDeleteSetNull:
+			patch := Patch{Set: map[string]any{rel.field.BSONName: nil}}
+			if indirect(rel.field.Type).Kind() == reflect.Slice {
+				patch = Patch{Pull: map[string][]any{rel.field.BSONName: ids}}
+			}
+			modified, err := backend.UpdateMany(ctx, appCtx.collection(rel.model), refFilter, patch)
+			if err != nil {
+				return 0, err
+			}
+			log.Println("Cleared references in "+rel.model.Name+".", modified)
+		}
+	}
+
+	deleted, err := backend.DeleteMany(ctx, appCtx.collection(model), Filter{{Field: "_id", Op: OpIn, Value: ids}})
+	if err != nil {
+		return 0, err
+	}
+	log.Println("Deleted "+model.Name+" objects.", deleted)
+	return deleted, nil
+}
+
+// Reports whether any registered model references the model.
+func isReferenced(model *Model) bool {
+	relations, err := referencesTo(model.Name)
+	return err != nil || len(relations) > 0
+}
+
+// Deletes the objects matching the filter together with the references to them inside a transaction.
+func deleteInTransaction(ctx context.Context, appCtx *Ctx, model *Model, filter Filter) error {
+	return WithTransaction(ctx, appCtx, func(ctx context.Context) error {
+		deleted, err := deleteWithRelations(ctx, appCtx, model, filter, map[string]map[any]bool{})
+		if err == nil && deleted == 0 {
+			return newError(ErrNotFound, "", nil)
+		}
+		return err
+	})
+}
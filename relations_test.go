@@ -0,0 +1,45 @@
+package grf
+
+import (
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type Project struct {
+	Id primitive.ObjectID `json:"id,omitempty" bson:"_id,omitempty"`
+}
+
+type Task struct {
+	Id        primitive.ObjectID   `json:"id,omitempty" bson:"_id,omitempty"`
+	ProjectID primitive.ObjectID   `json:"projectId" bson:"projectId" grf:"ref=Project,onDelete=cascade"`
+	Watchers  []primitive.ObjectID `json:"watchers" bson:"watchers" grf:"ref=Project,onDelete=set-null"`
+	Parent    primitive.ObjectID   `json:"parent" bson:"parent" grf:"ref=Task"`
+}
+
+func TestReferencesTo(t *testing.T) {
+	RegisterModel[Project]()
+	RegisterModel[Task]()
+
+	relations, err := referencesTo("Project")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := map[string]string{"projectId": OnDeleteCascade, "watchers": OnDeleteSetNull}
+	if len(relations) != len(want) {
+		t.Fatalf("got %d relations, want %d", len(relations), len(want))
+	}
+	for _, rel := range relations {
+		if want[rel.field.BSONName] != rel.onDelete {
+			t.Errorf("%s: got onDelete %s, want %s", rel.field.BSONName, rel.onDelete, want[rel.field.BSONName])
+		}
+	}
+
+	relations, _ = referencesTo("Task")
+	if len(relations) != 1 || relations[0].onDelete != OnDeleteRestrict {
+		t.Errorf("expected the self reference to default to restrict, got %+v", relations)
+	}
+	if isReferenced(getModel[Note]()) {
+		t.Errorf("Note is not referenced by anything")
+	}
+}
@@ -0,0 +1,205 @@
+package grf
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+)
+
+// Backend is a storage the generic services can run against.
+// It handles any model through its metadata, Repository puts a typed face on it.
+// MongoBackend is the default. MemoryBackend keeps everything in memory for tests and local development.
+//
+// object arguments are pointers to a model and objects arguments are pointers to slices of it.
+// FindOne, ReplaceOne and UpdateOne return ErrNotFound when nothing matches, Insert returns ErrConflict on duplicate ids.
+// InsertMany and BulkWrite write many objects in one round trip. Objects that fail are reported with BulkWriteErrors,
+// the others are written anyway unless the operation runs in a transaction that is then rolled back.
+type Backend interface {
+	// Stores the object and returns its id. Missing ObjectIDs are generated.
+	Insert(ctx context.Context, c Collection, object any) (any, error)
+	// Stores the objects and returns their ids, in the order of the objects. Missing ObjectIDs are generated.
+	InsertMany(ctx context.Context, c Collection, objects []any) ([]any, error)
+	FindOne(ctx context.Context, c Collection, filter Filter, object any) error
+	Find(ctx context.Context, c Collection, query Query, objects any) error
+	Count(ctx context.Context, c Collection, filter Filter) (int64, error)
+	ReplaceOne(ctx context.Context, c Collection, filter Filter, object any) error
+	// Applies the patch to the first match and decodes the updated object into object, if it is not nil.
+	UpdateOne(ctx context.Context, c Collection, filter Filter, patch Patch, object any) error
+	UpdateMany(ctx context.Context, c Collection, filter Filter, patch Patch) (int64, error)
+	// Applies each patch to the first object matching its filter. Returns how many of them matched an object.
+	BulkWrite(ctx context.Context, c Collection, updates []BulkWriteModel) (int64, error)
+	DeleteOne(ctx context.Context, c Collection, filter Filter) (int64, error)
+	DeleteMany(ctx context.Context, c Collection, filter Filter) (int64, error)
+	// Runs fn in a transaction. Operations using the context passed to fn are part of it.
+	WithTransaction(ctx context.Context, fn func(ctx context.Context) error) error
+}
+
+// BulkWriteModel is an update of Backend.BulkWrite, the patch for the first object matching the filter.
+type BulkWriteModel struct {
+	Filter Filter
+	Patch  Patch
+}
+
+// BulkWriteErrors are the failures of single objects of InsertMany or updates of BulkWrite, by their index.
+type BulkWriteErrors map[int]error
+
+func (e BulkWriteErrors) Error() string {
+	indexes := make([]int, 0, len(e))
+	for i := range e {
+		indexes = append(indexes, i)
+	}
+	sort.Ints(indexes)
+	return fmt.Sprintf("%d of the writes failed, the first at %d: %v", len(e), indexes[0], e[indexes[0]])
+}
+
+// Repository stores the objects of the model T.
+// The generic services and handlers reach the storage through it.
+type Repository[T any] interface {
+	// Stores the object. Objects without an id get one following the id strategy of the model.
+	Create(ctx context.Context, object *T) error
+	// Stores the objects in one go, like Create. Objects that fail are reported with BulkWriteErrors.
+	CreateMany(ctx context.Context, objects []T) error
+	Get(ctx context.Context, filter Filter, object *T) error
+	List(ctx context.Context, query Query, objects *[]T) error
+	Count(ctx context.Context, filter Filter) (int64, error)
+	Replace(ctx context.Context, filter Filter, object *T) error
+	// Applies the patch and decodes the updated object into object.
+	Update(ctx context.Context, filter Filter, patch Patch, object *T) error
+	// Applies the updates in one go and returns how many of them matched an object.
+	// Updates that fail are reported with BulkWriteErrors.
+	BulkWrite(ctx context.Context, updates []BulkWriteModel) (int64, error)
+	// Deletes the first object matching the filter.
+	Delete(ctx context.Context, filter Filter) error
+}
+
+// Returns the repository for the model T backed by the Backend of the app context.
+func RepositoryFor[T any](appCtx *Ctx) Repository[T] {
+	return backendRepository[T]{backend: appCtx.backend(), collection: appCtx.collection(getModel[T]())}
+}
+
+// Repository over a Backend.
+type backendRepository[T any] struct {
+	backend    Backend
+	collection Collection
+}
+
+func (r backendRepository[T]) Create(ctx context.Context, object *T) error {
+	if err := generateID(ctx, r.backend, r.collection, object); err != nil {
+		return err
+	}
+	id, err := r.backend.Insert(ctx, r.collection, object)
+	if err != nil {
+		return err
+	}
+	setID(object, id)
+	return nil
+}
+
+func (r backendRepository[T]) CreateMany(ctx context.Context, objects []T) error {
+	errs := BulkWriteErrors{}
+	// The objects that got an id, and where they are in objects.
+	var documents []any
+	var indexes []int
+	for i := range objects {
+		if err := generateID(ctx, r.backend, r.collection, &objects[i]); err != nil {
+			errs[i] = err
+			continue
+		}
+		documents = append(documents, &objects[i])
+		indexes = append(indexes, i)
+	}
+	if len(documents) > 0 {
+		ids, err := r.backend.InsertMany(ctx, r.collection, documents)
+		var insertErrs BulkWriteErrors
+		if err != nil && !errors.As(err, &insertErrs) {
+			return err
+		}
+		for j, i := range indexes {
+			if err, failed := insertErrs[j]; failed {
+				errs[i] = err
+				continue
+			}
+			setID(&objects[i], ids[j])
+		}
+	}
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
+
+func (r backendRepository[T]) Get(ctx context.Context, filter Filter, object *T) error {
+	return r.backend.FindOne(ctx, r.collection, filter, object)
+}
+
+func (r backendRepository[T]) List(ctx context.Context, query Query, objects *[]T) error {
+	return r.backend.Find(ctx, r.collection, query, objects)
+}
+
+func (r backendRepository[T]) Count(ctx context.Context, filter Filter) (int64, error) {
+	return r.backend.Count(ctx, r.collection, filter)
+}
+
+func (r backendRepository[T]) Replace(ctx context.Context, filter Filter, object *T) error {
+	return r.backend.ReplaceOne(ctx, r.collection, filter, object)
+}
+
+func (r backendRepository[T]) Update(ctx context.Context, filter Filter, patch Patch, object *T) error {
+	return r.backend.UpdateOne(ctx, r.collection, filter, patch, object)
+}
+
+func (r backendRepository[T]) BulkWrite(ctx context.Context, updates []BulkWriteModel) (int64, error) {
+	if len(updates) == 0 {
+		return 0, nil
+	}
+	return r.backend.BulkWrite(ctx, r.collection, updates)
+}
+
+func (r backendRepository[T]) Delete(ctx context.Context, filter Filter) error {
+	deleted, err := r.backend.DeleteOne(ctx, r.collection, filter)
+	if err != nil {
+		return err
+	}
+	if deleted == 0 {
+		return newError(ErrNotFound, "", nil)
+	}
+	return nil
+}
+
+// Inserts the objects one by one, for backends without a cheaper way to write many at once.
+func insertEach(ctx context.Context, backend Backend, c Collection, objects []any) ([]any, error) {
+	ids := make([]any, len(objects))
+	errs := BulkWriteErrors{}
+	for i, object := range objects {
+		id, err := backend.Insert(ctx, c, object)
+		if err != nil {
+			errs[i] = err
+			continue
+		}
+		ids[i] = id
+	}
+	if len(errs) > 0 {
+		return ids, errs
+	}
+	return ids, nil
+}
+
+// Applies the updates one by one, see insertEach.
+func updateEach(ctx context.Context, backend Backend, c Collection, updates []BulkWriteModel) (int64, error) {
+	var matched int64
+	errs := BulkWriteErrors{}
+	for i, update := range updates {
+		err := backend.UpdateOne(ctx, c, update.Filter, update.Patch, nil)
+		switch {
+		case err == nil:
+			matched++
+		case !errors.Is(err, ErrNotFound):
+			errs[i] = err
+		}
+	}
+	if len(errs) > 0 {
+		return matched, errs
+	}
+	return matched, nil
+}
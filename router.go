@@ -0,0 +1,67 @@
+package grf
+
+import (
+	"context"
+	"net/http"
+	"strings"
+)
+
+// Router is what grf needs from a router to register its routes.
+// Use ServeMux for the standard library's http.ServeMux and gorilla.Mux, in the gorilla package, for a gorilla/mux router.
+type Router interface {
+	// Registers the handler for requests with the method and path. Path variables are written as {name}.
+	Handle(method, path string, handler http.Handler)
+	// Returns a router for the paths under the prefix.
+	Group(prefix string) Router
+	// Returns the value of a path variable of a request routed by this router.
+	PathValue(r *http.Request, name string) string
+}
+
+type routerKey struct{}
+
+// Makes the router available to the handler, so PathParam reads the path variables through it.
+// Routers wrap the handlers they register with it.
+func WithRouter(router Router, handler http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		handler.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), routerKey{}, router)))
+	})
+}
+
+// Returns the value of a path variable of the request, whichever router it came through.
+// Requests that did not come through a Router are checked for http.ServeMux path values.
+func PathParam(r *http.Request, name string) string {
+	if router, ok := r.Context().Value(routerKey{}).(Router); ok {
+		return router.PathValue(r, name)
+	}
+	return r.PathValue(name)
+}
+
+// Adapts a http.ServeMux. Routes are registered as Go 1.22 patterns, "GET /todo/{id}".
+func ServeMux(m *http.ServeMux) Router {
+	return serveMuxRouter{mux: m}
+}
+
+type serveMuxRouter struct {
+	mux    *http.ServeMux
+	prefix string
+}
+
+func (s serveMuxRouter) Handle(method, path string, handler http.Handler) {
+	pattern := s.prefix + path
+	// A trailing slash would match the whole subtree, {$} keeps it to the path itself.
+	if strings.HasSuffix(pattern, "/") {
+		pattern += "{$}"
+	}
+	if method != "" {
+		pattern = method + " " + pattern
+	}
+	s.mux.Handle(pattern, WithRouter(s, handler))
+}
+
+func (s serveMuxRouter) Group(prefix string) Router {
+	return serveMuxRouter{mux: s.mux, prefix: s.prefix + strings.TrimSuffix(prefix, "/")}
+}
+
+func (s serveMuxRouter) PathValue(r *http.Request, name string) string {
+	return r.PathValue(name)
+}
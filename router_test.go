@@ -0,0 +1,72 @@
+package grf
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestRouters(t *testing.T) {
+	serveMux := http.NewServeMux()
+	var tests = []struct {
+		name    string
+		router  Router
+		handler http.Handler
+	}{
+		{"http.ServeMux", ServeMux(serveMux), serveMux},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			appCtx := &Ctx{Backend: NewMemoryBackend()}
+			memos := RegisterCRUDRoutes[Memo]("/memo", tt.router, appCtx)
+			memos.Handle(http.MethodGet, "/{id}/title", H{Ctx: appCtx, Fn: func(ctx *Ctx, w http.ResponseWriter, r *http.Request) {
+				var memo Memo
+				if err := ReadOne(r.Context(), ctx, &memo, PathParam(r, "id")); err != nil {
+					WriteError(w, r, err)
+					return
+				}
+				w.Write([]byte(memo.Title))
+			}})
+
+			res := httptest.NewRecorder()
+			tt.handler.ServeHTTP(res, httptest.NewRequest(http.MethodPost, "/memo/", strings.NewReader(`{"title": "walk the dog"}`)))
+			if res.Code != http.StatusCreated {
+				t.Fatalf("create: status %d, body %s", res.Code, res.Body.String())
+			}
+			location := res.Header().Get("Location")
+
+			var tests = []struct {
+				method string
+				path   string
+				status int
+				body   string
+			}{
+				{http.MethodGet, location, http.StatusOK, `"title":"walk the dog"`},
+				{http.MethodGet, location + "/title", http.StatusOK, "walk the dog"},
+				{http.MethodGet, "/memo/", http.StatusOK, `[{"id":`},
+				{http.MethodPut, location, http.StatusOK, `"title":"feed the cat"`},
+				{http.MethodDelete, location, http.StatusNoContent, ""},
+				{http.MethodGet, location, http.StatusNotFound, ""},
+			}
+			for _, step := range tests {
+				res := httptest.NewRecorder()
+				tt.handler.ServeHTTP(res, httptest.NewRequest(step.method, step.path, strings.NewReader(`{"title": "feed the cat"}`)))
+				if res.Code != step.status {
+					t.Fatalf("%s %s: status %d, want %d", step.method, step.path, res.Code, step.status)
+				}
+				if !strings.Contains(res.Body.String(), step.body) {
+					t.Fatalf("%s %s: body %s, want %s in it", step.method, step.path, res.Body.String(), step.body)
+				}
+			}
+		})
+	}
+}
+
+func TestPathParamWithoutRouter(t *testing.T) {
+	r := httptest.NewRequest(http.MethodGet, "/memo/1", nil)
+	r.SetPathValue("id", "1")
+	if id := PathParam(r, "id"); id != "1" {
+		t.Errorf("got %q from the ServeMux path value, want 1", id)
+	}
+}
@@ -0,0 +1,97 @@
+package grf
+
+import (
+	"context"
+	"reflect"
+)
+
+// Scoped models keep the objects of every tenant or owner apart. Tag a string field with what it holds:
+//
+//	TenantID string `json:"tenantId" bson:"tenantId" grf:"tenant"`
+//	OwnerID  string `json:"ownerId" bson:"ownerId" grf:"owner"`
+//
+// tenant fields hold the Tenant of the principal and owner fields its ID. The services only ever see the objects
+// of the principal in their context: every filter is narrowed down to them, Create and ReplaceOne set the fields
+// and patches can't change them. Whatever clients send for them is ignored.
+// Scoped models can't be reached without a principal, Unscoped lets code outside of requests reach all of them.
+const (
+	ScopeTenant = "tenant"
+	ScopeOwner  = "owner"
+)
+
+type unscopedKey struct{}
+
+// Returns a copy of the context in which the services reach the objects of every tenant and owner,
+// for jobs and administration. Never use it with the context of a request.
+func Unscoped(ctx context.Context) context.Context {
+	return context.WithValue(ctx, unscopedKey{}, true)
+}
+
+// Returns the tenant and owner fields of the model.
+func scopeFields(model *Model) []*Field {
+	var fields []*Field
+	for _, field := range model.Fields {
+		if field.Options.Has(ScopeTenant) || field.Options.Has(ScopeOwner) {
+			if indirect(field.Type).Kind() != reflect.String {
+				panic("grf: the scope field " + model.Name + "." + field.Name + " must be a string")
+			}
+			fields = append(fields, field)
+		}
+	}
+	return fields
+}
+
+// Returns the value the scope field has for the principal of the context.
+// Reports false when the context is unscoped, fails when there is no principal or it has no tenant.
+func scopeValue(ctx context.Context, field *Field) (string, bool, error) {
+	if ctx.Value(unscopedKey{}) != nil {
+		return "", false, nil
+	}
+	principal := PrincipalFrom(ctx)
+	if principal == nil {
+		return "", false, newError(ErrUnauthorized, "authentication required", nil)
+	}
+	if field.Options.Has(ScopeOwner) {
+		return principal.ID, true, nil
+	}
+	if principal.Tenant == "" {
+		return "", false, newError(ErrForbidden, "you don't belong to a tenant", nil)
+	}
+	return principal.Tenant, true, nil
+}
+
+// Narrows the filter down to the objects of the principal of the context, for scoped models.
+func scoped[K any](ctx context.Context, filter Filter) (Filter, error) {
+	for _, field := range scopeFields(getModel[K]()) {
+		value, ok, err := scopeValue(ctx, field)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			filter = append(filter[:len(filter):len(filter)], Condition{Field: field.BSONName, Op: OpEq, Value: value})
+		}
+	}
+	return filter, nil
+}
+
+// Sets the scope fields of object, a pointer to a model, to the ones of the principal of the context.
+// Unscoped contexts leave them as they are.
+func stampScope(ctx context.Context, object any) error {
+	value := reflect.ValueOf(object).Elem()
+	for _, field := range scopeFields(modelOf(reflect.TypeOf(object))) {
+		scope, ok, err := scopeValue(ctx, field)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			continue
+		}
+		target := value.FieldByIndex(field.Index)
+		if target.Kind() == reflect.Pointer {
+			target.Set(reflect.New(target.Type().Elem()))
+			target = target.Elem()
+		}
+		target.SetString(scope)
+	}
+	return nil
+}
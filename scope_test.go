@@ -0,0 +1,120 @@
+package grf
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type Expense struct {
+	Id       primitive.ObjectID `json:"id,omitempty" bson:"_id,omitempty"`
+	Title    string             `json:"title" bson:"title"`
+	TenantID string             `json:"tenantId" bson:"tenantId" grf:"tenant,filter"`
+}
+
+func TestTenantScope(t *testing.T) {
+	acme := ContextWithPrincipal(context.Background(), &Principal{ID: "ada", Tenant: "acme"})
+	globex := ContextWithPrincipal(context.Background(), &Principal{ID: "bob", Tenant: "globex"})
+	for name, appCtx := range backendContexts(t) {
+		t.Run(name, func(t *testing.T) {
+			expense := Expense{Title: "rockets", TenantID: "globex"}
+			if err := Create(acme, appCtx, &expense); err != nil {
+				t.Fatal(err)
+			}
+			if expense.TenantID != "acme" {
+				t.Fatalf("created for tenant %q, want acme", expense.TenantID)
+			}
+			id := expense.Id.Hex()
+
+			var tests = []struct {
+				name string
+				ctx  context.Context
+				run  func(ctx context.Context) error
+				want error
+			}{
+				{"read own", acme, func(ctx context.Context) error {
+					return ReadOne(ctx, appCtx, &Expense{}, id)
+				}, nil},
+				{"read other", globex, func(ctx context.Context) error {
+					return ReadOne(ctx, appCtx, &Expense{}, id)
+				}, ErrNotFound},
+				{"replace other", globex, func(ctx context.Context) error {
+					return ReplaceOne(ctx, appCtx, &Expense{Title: "stolen"}, id)
+				}, ErrNotFound},
+				{"update other", globex, func(ctx context.Context) error {
+					return UpdateOne(ctx, appCtx, &Expense{}, id, Patch{Set: map[string]any{"title": "stolen"}})
+				}, ErrNotFound},
+				{"delete other", globex, func(ctx context.Context) error {
+					return Delete[Expense](ctx, appCtx, id)
+				}, ErrNotFound},
+				{"move with a patch", acme, func(ctx context.Context) error {
+					return UpdateOne(ctx, appCtx, &Expense{}, id, Patch{Set: map[string]any{"tenantId": "globex"}})
+				}, ErrValidation},
+				{"move with a replace", acme, func(ctx context.Context) error {
+					return ReplaceOne(ctx, appCtx, &Expense{Title: "rockets", TenantID: "globex"}, id)
+				}, nil},
+				{"anonymous", context.Background(), func(ctx context.Context) error {
+					return Read(ctx, appCtx, &[]Expense{})
+				}, ErrUnauthorized},
+				{"no tenant", ContextWithPrincipal(context.Background(), &Principal{ID: "eve"}), func(ctx context.Context) error {
+					return Read(ctx, appCtx, &[]Expense{})
+				}, ErrForbidden},
+				{"unscoped", Unscoped(context.Background()), func(ctx context.Context) error {
+					return ReadOne(ctx, appCtx, &Expense{}, id)
+				}, nil},
+			}
+			for _, tt := range tests {
+				t.Run(tt.name, func(t *testing.T) {
+					err := tt.run(tt.ctx)
+					if tt.want == nil && err != nil || !errors.Is(err, tt.want) {
+						t.Errorf("got %v, want %v", err, tt.want)
+					}
+				})
+			}
+
+			var stored Expense
+			if err := ReadOne(acme, appCtx, &stored, id); err != nil || stored.Title != "rockets" || stored.TenantID != "acme" {
+				t.Errorf("got %+v, %v, want the rockets of acme", stored, err)
+			}
+		})
+	}
+}
+
+func TestTenantScopeRoutes(t *testing.T) {
+	secret := []byte("secret")
+	appCtx := &Ctx{Backend: NewMemoryBackend(), Authenticators: []Authenticator{JWTAuthenticator{Key: secret}}}
+	mux := http.NewServeMux()
+	RegisterCRUDRoutes[Expense]("/expenses", ServeMux(mux), appCtx)
+	send := func(tenant, method, path, body string) *httptest.ResponseRecorder {
+		token, _ := SignJWT(map[string]any{"sub": "someone", "tenant": tenant}, secret)
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("Authorization", "Bearer "+token)
+		res := httptest.NewRecorder()
+		mux.ServeHTTP(res, req)
+		return res
+	}
+
+	if res := send("acme", http.MethodPost, "/expenses/", `{"title": "rockets", "tenantId": "globex"}`); res.Code != http.StatusCreated {
+		t.Fatalf("create: status %d, body %s", res.Code, res.Body.String())
+	}
+	var tests = []struct {
+		tenant string
+		path   string
+		body   string
+	}{
+		{"acme", "/expenses/", `"tenantId":"acme"`},
+		{"globex", "/expenses/", `[]`},
+		{"globex", "/expenses/?tenantId=acme", `[]`},
+	}
+	for _, tt := range tests {
+		res := send(tt.tenant, http.MethodGet, tt.path, "")
+		if res.Code != http.StatusOK || !strings.Contains(res.Body.String(), tt.body) {
+			t.Errorf("%s GET %s: status %d, body %s, want %s", tt.tenant, tt.path, res.Code, res.Body.String(), tt.body)
+		}
+	}
+}
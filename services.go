@@ -2,137 +2,345 @@ package grf
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"log"
-	"strings"
-	"time"
 
-	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
-	"go.mongodb.org/mongo-driver/mongo"
 )
 
+// The generic services. They run the validation and hooks around the Repository of the model,
+// so they work the same against any Backend.
+// Every operation runs with the context of the caller, limited by the timeout for the model and action, see Timeouter.
+
 // Generic function to add objects to the database.
 // models.Object is stored in the objects collection.
 // Automatically adds the record to the collection with a plural, lowercase name.
-func Create[K interface{}](database *mongo.Database, object K) (*mongo.InsertOneResult, error) {
-	collection, ctx, cancel := getCollectionAndContext(database, object)
+// The object is validated after its BeforeCreate hook, see Validate. The generated id is set on the object.
+// Audit fields are filled in, the principal of the context is the creator.
+func Create[K interface{}](ctx context.Context, appCtx *Ctx, object *K) error {
+	ctx, cancel := operationContext[K](ctx, appCtx, ActionCreate)
 	defer cancel()
-	res, err := collection.InsertOne(ctx, object)
-	if err != nil {
-		log.Println("Error adding object to database.", err)
-		return nil, err
+
+	if err := beforeCreate(ctx, appCtx, object); err != nil {
+		return err
+	}
+	auditCreate(ctx, object)
+	if err := stampScope(ctx, object); err != nil {
+		return err
+	}
+	if err := Validate(object); err != nil {
+		return err
+	}
+	if err := RepositoryFor[K](appCtx).Create(ctx, object); err != nil {
+		return err
 	}
-	log.Println("Inserted record to " + collection.Name() + " collection.")
-	return res, err
+	return afterCreate(ctx, appCtx, object)
 }
 
 // Reads all the objects of the given type.
-func Read[K any](database *mongo.Database, objects *[]K) error {
-	collection, ctx, cancel := getCollectionAndContext(database, objects)
+func Read[K any](ctx context.Context, appCtx *Ctx, objects *[]K) error {
+	return ReadQuery(ctx, appCtx, objects, Query{})
+}
+
+// Reads the objects of the given type that match the query.
+// Use ParseQuery to build the query from a request's query string.
+// Soft deleted objects are left out, see ReadTrash.
+func ReadQuery[K any](ctx context.Context, appCtx *Ctx, objects *[]K, query Query) error {
+	ctx, cancel := operationContext[K](ctx, appCtx, ActionList)
 	defer cancel()
 
-	cur, err := collection.Find(ctx, bson.D{})
+	filter, err := scoped[K](ctx, query.Filter)
 	if err != nil {
-		log.Println("error retrieving all objects of "+collection.Name(), err)
 		return err
 	}
-	err = cur.All(ctx, objects)
-	if err != nil {
-		log.Println("error getting data from cursor "+collection.Name(), err)
+	query.Filter = withoutDeleted[K](filter)
+	if err := RepositoryFor[K](appCtx).List(ctx, query, objects); err != nil {
 		return err
 	}
+	for i := range *objects {
+		if err := afterRead(ctx, appCtx, &(*objects)[i]); err != nil {
+			return err
+		}
+	}
 	return nil
 }
 
-func ReadOne[K any](database *mongo.Database, object *K, id string) error {
-	collection, ctx, cancel := getCollectionAndContext(database, object)
+// Reads the object with the given id.
+func ReadOne[K any](ctx context.Context, appCtx *Ctx, object *K, id string) error {
+	filter, err := idFilter[K](id)
+	if err != nil {
+		return err
+	}
+	return readOne(ctx, appCtx, object, filter)
+}
+
+// Reads the object matching the lookup, see WithLookup.
+func ReadOneBy[K any](ctx context.Context, appCtx *Ctx, object *K, lookup Lookup) error {
+	filter, err := lookupFilter[K](lookup)
+	if err != nil {
+		return err
+	}
+	return readOne(ctx, appCtx, object, filter)
+}
+
+func readOne[K any](ctx context.Context, appCtx *Ctx, object *K, filter Filter) error {
+	ctx, cancel := operationContext[K](ctx, appCtx, ActionRead)
 	defer cancel()
 
-	// Converting the id from the hex string to the ObjectID format that mongo use
-	objectID, err := primitive.ObjectIDFromHex(id)
+	filter, err := scoped[K](ctx, filter)
 	if err != nil {
-		log.Println("Error converting id to ObjectId:", err)
 		return err
 	}
-	filter := bson.D{{Key: "_id", Value: objectID}}
-	log.Println("Filter: ", filter)
-	err = collection.FindOne(ctx, filter).Decode(&object)
-	log.Println("Object: ", object)
+	if err := RepositoryFor[K](appCtx).Get(ctx, withoutDeleted[K](filter), object); err != nil {
+		return err
+	}
+	return afterRead(ctx, appCtx, object)
+}
+
+// Replaces the object with the given id. The object is validated after its BeforeReplace hook, see Validate.
+// Models with a version field fail with ErrConflict when the object changed while it was being replaced.
+func ReplaceOne[K any](ctx context.Context, appCtx *Ctx, object *K, id string) error {
+	filter, err := idFilter[K](id)
 	if err != nil {
-		log.Println("Error finding the one", err)
 		return err
 	}
-	return nil
+	return replaceOne(ctx, appCtx, object, filter, "")
+}
+
+// Replaces the object matching the lookup, see WithLookup. The replacement keeps the id of the stored object.
+func ReplaceOneBy[K any](ctx context.Context, appCtx *Ctx, object *K, lookup Lookup) error {
+	filter, err := lookupFilter[K](lookup)
+	if err != nil {
+		return err
+	}
+	return replaceOne(ctx, appCtx, object, filter, "")
 }
 
-func ReplaceOne[K any](database *mongo.Database, object *K, id string) error {
-	collection, ctx, cancel := getCollectionAndContext(database, object)
+func replaceOne[K any](ctx context.Context, appCtx *Ctx, object *K, filter Filter, ifMatch string) error {
+	ctx, cancel := operationContext[K](ctx, appCtx, ActionReplace)
 	defer cancel()
 
-	// Converting the id from the hex string to the ObjectID format that mongo use
-	objectID, err := primitive.ObjectIDFromHex(id)
+	filter, err := scoped[K](ctx, filter)
 	if err != nil {
-		log.Println("Error converting id to ObjectId:", err)
 		return err
 	}
-	filter := bson.D{{Key: "_id", Value: objectID}}
-	res, err := collection.ReplaceOne(ctx, filter, *object)
+	if ifMatch != "" && versionField(getModel[K]()) == nil {
+		// Without a version to replace on, the stored object is checked and replaced in one transaction.
+		return WithTransaction(ctx, appCtx, func(ctx context.Context) error {
+			return replaceStored(ctx, appCtx, object, filter, ifMatch)
+		})
+	}
+	return replaceStored(ctx, appCtx, object, filter, ifMatch)
+}
+
+func replaceStored[K any](ctx context.Context, appCtx *Ctx, object *K, filter Filter, ifMatch string) error {
+	model := getModel[K]()
+	version := versionField(model)
+	repository := RepositoryFor[K](appCtx)
+	stored := new(K)
+	if len(filter) != 1 || filter[0].Field != "_id" || hasCreationFields(model) || version != nil || ifMatch != "" {
+		// The stored object tells which id to keep when looked up by other fields, when it was created
+		// and which version is replaced.
+		if err := repository.Get(ctx, withoutDeleted[K](filter), stored); err != nil {
+			return err
+		}
+		if err := checkIfMatch(ctx, appCtx, stored, ifMatch); err != nil {
+			return err
+		}
+		filter = Filter{{Field: "_id", Op: OpEq, Value: getID(stored)}}
+		if version != nil {
+			filter = append(filter, versionCondition(version, stored))
+		}
+	}
+	// The id in the path wins over whatever id came along with the object.
+	setID(object, filter[0].Value)
+	if err := beforeReplace(ctx, appCtx, object); err != nil {
+		return err
+	}
+	auditReplace(object, stored)
+	if err := stampScope(ctx, object); err != nil {
+		return err
+	}
+	if err := Validate(object); err != nil {
+		return err
+	}
+	err := repository.Replace(ctx, withoutDeleted[K](filter), object)
+	if errors.Is(err, ErrNotFound) && version != nil {
+		return changedConcurrently(ifMatch)
+	}
 	if err != nil {
-		log.Println("Error replacing object:", err)
 		return err
 	}
-	log.Println("Replaced object.", res.ModifiedCount)
-	return nil
+	return afterReplace(ctx, appCtx, object)
+}
+
+// Applies the patch to the object with the given id in a single atomic update.
+// The updated object is decoded into object.
+func UpdateOne[K any](ctx context.Context, appCtx *Ctx, object *K, id string, patch Patch) error {
+	filter, err := idFilter[K](id)
+	if err != nil {
+		return err
+	}
+	return updateOne(ctx, appCtx, object, filter, patch)
+}
+
+// Applies the patch to the object matching the lookup, see WithLookup.
+func UpdateOneBy[K any](ctx context.Context, appCtx *Ctx, object *K, lookup Lookup, patch Patch) error {
+	filter, err := lookupFilter[K](lookup)
+	if err != nil {
+		return err
+	}
+	return updateOne(ctx, appCtx, object, filter, patch)
 }
 
-// about as dumb as it gets. Works for atomics. Wouldn't recommend for anything with dependencies.
-func Delete[K any](database *mongo.Database, id string) error {
-	collection, ctx, cancel := getCollectionAndContext(database, *new(K))
+func updateOne[K any](ctx context.Context, appCtx *Ctx, object *K, filter Filter, patch Patch) error {
+	ctx, cancel := operationContext[K](ctx, appCtx, ActionUpdate)
 	defer cancel()
 
-	// Converting the group id from the hex string to the ObjectID format that mongo use
-	objectID, err := primitive.ObjectIDFromHex(id)
+	filter, err := scoped[K](ctx, filter)
 	if err != nil {
-		log.Println("Error converting id to ObjectId:", err)
 		return err
 	}
-	filter := bson.D{{Key: "_id", Value: objectID}}
-	res, err := collection.DeleteOne(ctx, filter)
+	filter = withoutDeleted[K](filter)
+	patch = auditPatch(getModel[K](), patch)
+	if patch.IsEmpty() {
+		return newError(ErrValidation, "patch does not change anything", nil)
+	}
+	if err := validatePatch(getModel[K](), patch); err != nil {
+		return err
+	}
+
+	repository := RepositoryFor[K](appCtx)
+	err = repository.Update(ctx, append(filter, patch.Test...), patch, object)
+	if errors.Is(err, ErrNotFound) && len(patch.Test) > 0 {
+		// Telling a failed test operation apart from a missing object.
+		count, countErr := repository.Count(ctx, filter)
+		if countErr == nil && count > 0 {
+			return newError(ErrConflict, "a test operation of the patch failed or a path it replaces or removes does not exist", nil)
+		}
+	}
 	if err != nil {
-		log.Println("Error deleting object:", err)
 		return err
 	}
-	log.Println("Deleted object.", res.DeletedCount)
+	log.Println("Updated object.")
 	return nil
 }
 
-func getPlural(noun string) string {
-	// Model type name could be a variation of the following.
-	// package.model, *package.model, []package.model, *[]package.model
-	// We're extracting the model name and returning its plural.
-	// "*models.Todo" becomes "todos" || "*[]models.Box" becomes "boxes"
-	splits := strings.Split(strings.TrimPrefix(strings.TrimPrefix(noun, "*"), "[]"), ".")
-	noun = strings.ToLower(splits[len(splits)-1])
-	ends := []string{"s", "sh", "ch", "x", "z"}
-	for _, end := range ends {
-		if strings.HasSuffix(noun, end) {
-			return noun + "es"
+// Deletes the object with the given id.
+// References to it declared by registered models (`grf:"ref=Model,onDelete=cascade"`) are enforced in a transaction,
+// see RegisterModel. Without any, this is a plain delete.
+// Soft deleted models are moved to the trash instead, their references are enforced when they are purged.
+// Models implementing BeforeDeleter or AfterDeleter are loaded first so the hooks can run on them.
+func Delete[K any](ctx context.Context, appCtx *Ctx, id string) error {
+	filter, err := idFilter[K](id)
+	if err != nil {
+		return err
+	}
+	return deleteOne[K](ctx, appCtx, filter, "")
+}
+
+// Deletes the object matching the lookup, see WithLookup.
+func DeleteBy[K any](ctx context.Context, appCtx *Ctx, lookup Lookup) error {
+	filter, err := lookupFilter[K](lookup)
+	if err != nil {
+		return err
+	}
+	return deleteOne[K](ctx, appCtx, filter, "")
+}
+
+func deleteOne[K any](ctx context.Context, appCtx *Ctx, filter Filter, ifMatch string) error {
+	ctx, cancel := operationContext[K](ctx, appCtx, ActionDelete)
+	defer cancel()
+
+	filter, err := scoped[K](ctx, filter)
+	if err != nil {
+		return err
+	}
+	if ifMatch != "" && versionField(getModel[K]()) == nil {
+		// Without a version to delete on, the stored object is checked and deleted in one transaction.
+		return WithTransaction(ctx, appCtx, func(ctx context.Context) error {
+			return deleteStored[K](ctx, appCtx, filter, ifMatch)
+		})
+	}
+	return deleteStored[K](ctx, appCtx, filter, ifMatch)
+}
+
+func deleteStored[K any](ctx context.Context, appCtx *Ctx, filter Filter, ifMatch string) error {
+	filter = withoutDeleted[K](filter)
+	model := getModel[K]()
+	repository := RepositoryFor[K](appCtx)
+
+	var object *K
+	versioned := false
+	if hasDeleteHooks[K]() || ifMatch != "" {
+		object = new(K)
+		if err := repository.Get(ctx, filter, object); err != nil {
+			return err
+		}
+		if err := checkIfMatch(ctx, appCtx, object, ifMatch); err != nil {
+			return err
+		}
+		if version := versionField(model); version != nil && ifMatch != "" {
+			filter = append(filter, versionCondition(version, object))
+			versioned = true
+		}
+		if err := beforeDelete(ctx, appCtx, object); err != nil {
+			return err
 		}
 	}
-	return noun + "s"
+
+	var err error
+	if isSoftDeleted[K]() {
+		if object == nil {
+			object = new(K)
+		}
+		err = softDelete(ctx, appCtx, filter, object)
+	} else if isReferenced(model) {
+		// Other models point at this one, their onDelete actions run in the same transaction.
+		// Like a plain delete it deletes only the first match, lookups aren't necessarily unique.
+		if object == nil {
+			object = new(K)
+			if err := repository.Get(ctx, filter, object); err != nil {
+				return err
+			}
+		}
+		err = deleteInTransaction(ctx, appCtx, model, append(filter, Condition{Field: "_id", Op: OpEq, Value: getID(object)}))
+	} else {
+		err = repository.Delete(ctx, filter)
+	}
+	if errors.Is(err, ErrNotFound) && versioned {
+		return changedConcurrently(ifMatch)
+	}
+	if err != nil {
+		return err
+	}
+	log.Println("Deleted object.")
+	if object != nil {
+		return afterDelete(ctx, appCtx, object)
+	}
+	return nil
 }
 
-func getCollection[K any](database *mongo.Database) *mongo.Collection {
-	object := new(K)
-	collectionName := getPlural(fmt.Sprintf("%T", object))
-	collection := database.Collection(collectionName)
-	return collection
+// Returns the filter matching the object of the model K with the given id.
+// The id is parsed following the id strategy of the model.
+func idFilter[K any](id string) (Filter, error) {
+	var value any = id
+	if field := getModel[K]().IDField(); field != nil {
+		var err error
+		if value, err = parseID(field, id); err != nil {
+			return nil, err
+		}
+	}
+	return Filter{{Field: "_id", Op: OpEq, Value: value}}, nil
 }
 
-func getCollectionAndContext[K any](database *mongo.Database, object K) (*mongo.Collection, context.Context, context.CancelFunc) {
-	collectionName := getPlural(fmt.Sprintf("%T", object))
-	collection := database.Collection(collectionName)
-	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
-	return collection, ctx, cancel
+// Converts the id from the hex string to the ObjectID format that mongo use.
+func parseObjectID(id string) (primitive.ObjectID, error) {
+	objectID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		log.Println("Error converting id to ObjectId:", err)
+		return objectID, newError(ErrInvalidID, fmt.Sprintf("%q is not a valid id", id), err)
+	}
+	return objectID, nil
 }
@@ -18,19 +18,16 @@ var db *mongo.Database
 func TestGetPluralTableDriven(t *testing.T) {
 	var tests = []struct {
 		name  string
-		input string
+		input *Model
 		want  string
 	}{
-		{"pointer plural test", "*models.Todo", "todos"},
-		{"pointer slice plural test", "*[]models.Todo", "todos"},
-		{"base plural test", "models.Todo", "todos"},
-		{"es plural test", "*models.Box", "boxes"},
-		{"package plural test", "main.Box", "boxes"},
+		{"base plural test", getModel[Todo](), "todos"},
+		{"es plural test", getModel[Box](), "boxes"},
 	}
 	// The execution loop
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			ans := getPlural(tt.input)
+			ans := PluralNamer{}.CollectionName(tt.input)
 			if ans != tt.want {
 				t.Errorf("got %s, want %s", ans, tt.want)
 			}
@@ -40,7 +37,7 @@ func TestGetPluralTableDriven(t *testing.T) {
 
 func TestReadTodo(t *testing.T) {
 	var result []Todo
-	err := Read(db, &result)
+	err := Read(context.Background(), &Ctx{DB: db}, &result)
 	if err != nil {
 		t.Fatalf("Failed to read from the database: %v", err)
 		return
@@ -69,7 +66,7 @@ func TestReadOneTodo(t *testing.T) {
 		expected := tt.(Todo)
 		t.Run("Todo: "+expected.Title, func(t *testing.T) {
 			var result Todo
-			err := ReadOne(db, &result, expected.Id.Hex())
+			err := ReadOne(context.Background(), &Ctx{DB: db}, &result, expected.Id.Hex())
 			if err != nil {
 				t.Fatalf("Failed to read from the database: %v", err)
 				return
@@ -168,10 +165,8 @@ func loremIpsumDb() error {
 		}
 	}
 
-	collection, ctx, cancel := getCollectionAndContext[Todo](db, todos[0].(Todo))
-	defer cancel()
-
-	_, err := collection.InsertMany(ctx, todos)
+	collection := db.Collection(collectionOf(nil, getModel[Todo]()).Name)
+	_, err := collection.InsertMany(context.Background(), todos)
 	if err != nil {
 		log.Fatalln("Error adding object to database.", err)
 		return err
@@ -182,7 +177,7 @@ func loremIpsumDb() error {
 func cleanUpDB() error {
 	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
 	defer cancel()
-	collection := getCollection[Todo](db)
+	collection := db.Collection(collectionOf(nil, getModel[Todo]()).Name)
 	err := cleanUpCollection(*collection, ctx)
 	return err
 }
@@ -0,0 +1,111 @@
+package grf
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"time"
+)
+
+// Session is a login stored in the sessions collection, see SessionAuthenticator.
+// Only a hash of the session cookie is stored.
+type Session struct {
+	// The SHA-256 hash of the cookie, hex encoded.
+	ID        string         `json:"id" bson:"_id" grf:"id=string"`
+	Principal string         `json:"principal" bson:"principal"`
+	Tenant    string         `json:"tenant" bson:"tenant"`
+	Roles     []string       `json:"roles" bson:"roles"`
+	Claims    map[string]any `json:"claims" bson:"claims"`
+	CreatedAt time.Time      `json:"createdAt" bson:"createdAt" grf:"createdAt"`
+	ExpiresAt time.Time      `json:"expiresAt" bson:"expiresAt"`
+}
+
+// SessionAuthenticator authenticates requests with a session cookie. Sessions are stored in the sessions collection
+// of the app context, Start logs a principal in and End logs it out.
+type SessionAuthenticator struct {
+	// The name of the cookie. Defaults to "session".
+	CookieName string
+	// How long a session lasts. Defaults to DefaultSessionTTL.
+	TTL time.Duration
+	// Sends the cookie over plain HTTP too, for local development.
+	InsecureCookie bool
+}
+
+// How long sessions last by default.
+var DefaultSessionTTL = 24 * time.Hour
+
+func (a SessionAuthenticator) Authenticate(ctx *Ctx, r *http.Request) (*Principal, error) {
+	cookie, err := r.Cookie(a.cookieName())
+	if err != nil {
+		return nil, nil
+	}
+	var session Session
+	if err := ReadOne(r.Context(), ctx, &session, hashSecret(cookie.Value)); err != nil {
+		if errors.Is(err, ErrNotFound) || errors.Is(err, ErrInvalidID) {
+			return nil, newError(ErrUnauthorized, "invalid session", nil)
+		}
+		return nil, err
+	}
+	if time.Now().After(session.ExpiresAt) {
+		return nil, newError(ErrUnauthorized, "the session expired", nil)
+	}
+	return &Principal{ID: session.Principal, Tenant: session.Tenant, Roles: session.Roles, Claims: session.Claims}, nil
+}
+
+// Starts a session for the principal and sets its cookie on the response.
+func (a SessionAuthenticator) Start(ctx context.Context, appCtx *Ctx, w http.ResponseWriter, principal *Principal) error {
+	secret, err := newSecret()
+	if err != nil {
+		return err
+	}
+	ttl := a.TTL
+	if ttl <= 0 {
+		ttl = DefaultSessionTTL
+	}
+	session := Session{
+		ID:        hashSecret(secret),
+		Principal: principal.ID,
+		Tenant:    principal.Tenant,
+		Roles:     principal.Roles,
+		Claims:    principal.Claims,
+		ExpiresAt: auditTime().Add(ttl),
+	}
+	if err := Create(ctx, appCtx, &session); err != nil {
+		return err
+	}
+	http.SetCookie(w, a.cookie(secret, session.ExpiresAt))
+	return nil
+}
+
+// Ends the session of the request, if there is one, and clears its cookie.
+func (a SessionAuthenticator) End(ctx context.Context, appCtx *Ctx, w http.ResponseWriter, r *http.Request) error {
+	cookie, err := r.Cookie(a.cookieName())
+	if err != nil {
+		return nil
+	}
+	http.SetCookie(w, a.cookie("", time.Unix(0, 0)))
+	if err := Delete[Session](ctx, appCtx, hashSecret(cookie.Value)); err != nil && !errors.Is(err, ErrNotFound) {
+		return err
+	}
+	return nil
+}
+
+func (a SessionAuthenticator) cookieName() string {
+	if a.CookieName == "" {
+		return "session"
+	}
+	return a.CookieName
+}
+
+// Returns the session cookie with the value. It is out of reach of scripts and not sent along with cross-site requests.
+func (a SessionAuthenticator) cookie(value string, expires time.Time) *http.Cookie {
+	return &http.Cookie{
+		Name:     a.cookieName(),
+		Value:    value,
+		Path:     "/",
+		Expires:  expires,
+		HttpOnly: true,
+		Secure:   !a.InsecureCookie,
+		SameSite: http.SameSiteLaxMode,
+	}
+}
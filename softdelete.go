@@ -0,0 +1,216 @@
+package grf
+
+import (
+	"context"
+	"log"
+	"reflect"
+	"time"
+)
+
+// Soft delete is opt-in per model: tag a *time.Time field with `grf:"softdelete"`.
+//
+//	DeletedAt *time.Time `json:"deletedAt,omitempty" bson:"deletedAt" grf:"softdelete"`
+//
+// Delete then only sets the field to the time of deletion, the object moves to the trash.
+// The other services don't see objects in the trash. ReadTrash lists them, Restore brings them back
+// and Purge or PurgeDeleted remove them for good.
+// The field is managed by grf like the audit fields, values sent by clients are ignored.
+
+// Returns the field holding the deletion time of soft deleted models, nil for models without soft delete.
+func softDeleteField(model *Model) *Field {
+	field := model.FieldWithOption("softdelete")
+	if field != nil && field.Type != reflect.TypeOf((*time.Time)(nil)) {
+		panic("grf: the softdelete field " + model.Name + "." + field.Name + " must be a *time.Time")
+	}
+	return field
+}
+
+// Reports whether the model K is soft deleted.
+func isSoftDeleted[K any]() bool {
+	return softDeleteField(getModel[K]()) != nil
+}
+
+// Narrows the filter down to the objects that are not in the trash.
+// The filter is returned as is for models without soft delete.
+func withoutDeleted[K any](filter Filter) Filter {
+	field := softDeleteField(getModel[K]())
+	if field == nil {
+		return filter
+	}
+	return append(filter[:len(filter):len(filter)], Condition{Field: field.BSONName, Op: OpEq, Value: nil})
+}
+
+// Narrows the filter down to the objects in the trash.
+func onlyDeleted[K any](filter Filter) Filter {
+	field := softDeleteField(getModel[K]())
+	if field == nil {
+		return filter
+	}
+	return append(filter[:len(filter):len(filter)], Condition{Field: field.BSONName, Op: OpNe, Value: nil})
+}
+
+// Moves the object matching the filter to the trash, the filter is already narrowed down with withoutDeleted.
+// The stored object is decoded into object.
+func softDelete[K any](ctx context.Context, appCtx *Ctx, filter Filter, object *K) error {
+	field := softDeleteField(getModel[K]())
+	patch := touch(getModel[K](), Patch{Set: map[string]any{field.BSONName: time.Now().UTC()}})
+	if err := RepositoryFor[K](appCtx).Update(ctx, filter, patch, object); err != nil {
+		return err
+	}
+	log.Println("Moved object to the trash.")
+	return nil
+}
+
+// Lists the objects of the model K in the trash that match the query.
+func ReadTrash[K any](ctx context.Context, appCtx *Ctx, objects *[]K, query Query) error {
+	ctx, cancel := operationContext[K](ctx, appCtx, ActionList)
+	defer cancel()
+
+	if !isSoftDeleted[K]() {
+		return newError(ErrNotFound, getModel[K]().Name+" is not soft deleted", nil)
+	}
+	filter, err := scoped[K](ctx, query.Filter)
+	if err != nil {
+		return err
+	}
+	query.Filter = onlyDeleted[K](filter)
+	if err := RepositoryFor[K](appCtx).List(ctx, query, objects); err != nil {
+		return err
+	}
+	for i := range *objects {
+		if err := afterRead(ctx, appCtx, &(*objects)[i]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Takes the object with the given id out of the trash. The restored object is decoded into object.
+func Restore[K any](ctx context.Context, appCtx *Ctx, object *K, id string) error {
+	filter, err := idFilter[K](id)
+	if err != nil {
+		return err
+	}
+	return restore(ctx, appCtx, object, filter)
+}
+
+// Takes the object matching the lookup out of the trash, see WithLookup.
+func RestoreBy[K any](ctx context.Context, appCtx *Ctx, object *K, lookup Lookup) error {
+	filter, err := lookupFilter[K](lookup)
+	if err != nil {
+		return err
+	}
+	return restore(ctx, appCtx, object, filter)
+}
+
+func restore[K any](ctx context.Context, appCtx *Ctx, object *K, filter Filter) error {
+	ctx, cancel := operationContext[K](ctx, appCtx, ActionUpdate)
+	defer cancel()
+
+	field := softDeleteField(getModel[K]())
+	if field == nil {
+		return newError(ErrNotFound, getModel[K]().Name+" is not soft deleted", nil)
+	}
+	filter, err := scoped[K](ctx, filter)
+	if err != nil {
+		return err
+	}
+	patch := touch(getModel[K](), Patch{Set: map[string]any{field.BSONName: nil}})
+	if err := RepositoryFor[K](appCtx).Update(ctx, onlyDeleted[K](filter), patch, object); err != nil {
+		return err
+	}
+	log.Println("Restored object from the trash.")
+	return nil
+}
+
+// Permanently deletes the object with the given id from the trash.
+// The onDelete actions of references to it are enforced now, see Delete.
+func Purge[K any](ctx context.Context, appCtx *Ctx, id string) error {
+	filter, err := idFilter[K](id)
+	if err != nil {
+		return err
+	}
+	return purge[K](ctx, appCtx, filter)
+}
+
+// Permanently deletes the object matching the lookup from the trash, see WithLookup.
+func PurgeBy[K any](ctx context.Context, appCtx *Ctx, lookup Lookup) error {
+	filter, err := lookupFilter[K](lookup)
+	if err != nil {
+		return err
+	}
+	return purge[K](ctx, appCtx, filter)
+}
+
+func purge[K any](ctx context.Context, appCtx *Ctx, filter Filter) error {
+	ctx, cancel := operationContext[K](ctx, appCtx, ActionDelete)
+	defer cancel()
+
+	if !isSoftDeleted[K]() {
+		return newError(ErrNotFound, getModel[K]().Name+" is not soft deleted", nil)
+	}
+	filter, err := scoped[K](ctx, filter)
+	if err != nil {
+		return err
+	}
+	filter = onlyDeleted[K](filter)
+	if model := getModel[K](); isReferenced(model) {
+		err = deleteInTransaction(ctx, appCtx, model, filter)
+	} else {
+		err = RepositoryFor[K](appCtx).Delete(ctx, filter)
+	}
+	if err != nil {
+		return err
+	}
+	log.Println("Purged object.")
+	return nil
+}
+
+// Permanently deletes the objects of the model K that have been in the trash for longer than the retention.
+// Returns how many were deleted. Scoped models are purged for every tenant and owner.
+func PurgeDeleted[K any](ctx context.Context, appCtx *Ctx, retention time.Duration) (int64, error) {
+	ctx, cancel := operationContext[K](ctx, appCtx, ActionDelete)
+	defer cancel()
+
+	model := getModel[K]()
+	field := softDeleteField(model)
+	if field == nil {
+		return 0, newError(ErrNotFound, model.Name+" is not soft deleted", nil)
+	}
+	filter := Filter{{Field: field.BSONName, Op: OpLt, Value: time.Now().UTC().Add(-retention)}}
+
+	var purged int64
+	var err error
+	if isReferenced(model) {
+		err = WithTransaction(ctx, appCtx, func(ctx context.Context) error {
+			purged, err = deleteWithRelations(ctx, appCtx, model, filter, map[string]map[any]bool{})
+			return err
+		})
+	} else {
+		purged, err = appCtx.backend().DeleteMany(ctx, appCtx.collection(model), filter)
+	}
+	if err != nil {
+		return 0, err
+	}
+	log.Println("Purged "+model.Name+" objects deleted before the retention.", purged)
+	return purged, nil
+}
+
+// Runs PurgeDeleted every interval until the context is done. Errors are logged and retried on the next run.
+// Start it in its own goroutine, next to the server:
+//
+//	go grf.PurgeDeletedEvery[Todo](ctx, appCtx, 30*24*time.Hour, time.Hour)
+func PurgeDeletedEvery[K any](ctx context.Context, appCtx *Ctx, retention, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		if _, err := PurgeDeleted[K](ctx, appCtx, retention); err != nil {
+			log.Println("Error purging the trash of "+getModel[K]().Name+".", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,161 @@
+package grf
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type Chore struct {
+	Id        primitive.ObjectID `json:"id,omitempty" bson:"_id,omitempty"`
+	Title     string             `json:"title" bson:"title"`
+	DeletedAt *time.Time         `json:"deletedAt,omitempty" bson:"deletedAt" grf:"softdelete"`
+}
+
+func TestSoftDeleteRoutes(t *testing.T) {
+	for name, appCtx := range backendContexts(t) {
+		t.Run(name, func(t *testing.T) {
+			mux := http.NewServeMux()
+			RegisterCRUDRoutes[Chore]("/chores", ServeMux(mux), appCtx)
+			request := func(method, target, body string) *httptest.ResponseRecorder {
+				res := httptest.NewRecorder()
+				mux.ServeHTTP(res, httptest.NewRequest(method, target, strings.NewReader(body)))
+				return res
+			}
+			count := func(target string) int {
+				var chores []Chore
+				json.Unmarshal(request(http.MethodGet, target, "").Body.Bytes(), &chores)
+				return len(chores)
+			}
+
+			res := request(http.MethodPost, "/chores/", `{"title": "milk", "deletedAt": "2020-01-01T00:00:00Z"}`)
+			if res.Code != http.StatusCreated {
+				t.Fatalf("create: status %d, body %s", res.Code, res.Body.String())
+			}
+			location := res.Header().Get("Location")
+			id := strings.TrimPrefix(location, "/chores/")
+			if count("/chores/") != 1 || count("/chores/trash") != 0 {
+				t.Fatalf("a created object with a deletedAt went to the trash")
+			}
+
+			var tests = []struct {
+				method string
+				target string
+				want   int
+				list   int
+				trash  int
+			}{
+				{http.MethodDelete, location, http.StatusNoContent, 0, 1},
+				{http.MethodGet, location, http.StatusNotFound, 0, 1},
+				{http.MethodDelete, location, http.StatusNotFound, 0, 1},
+				{http.MethodPatch, location, http.StatusNotFound, 0, 1},
+				{http.MethodPost, location + "/restore", http.StatusOK, 1, 0},
+				{http.MethodPost, location + "/restore", http.StatusNotFound, 1, 0},
+				{http.MethodGet, location, http.StatusOK, 1, 0},
+				{http.MethodDelete, "/chores/trash/" + id, http.StatusNotFound, 1, 0},
+				{http.MethodDelete, location, http.StatusNoContent, 0, 1},
+				{http.MethodDelete, "/chores/trash/" + id, http.StatusNoContent, 0, 0},
+				{http.MethodPost, location + "/restore", http.StatusNotFound, 0, 0},
+			}
+			for _, tt := range tests {
+				if res := request(tt.method, tt.target, `{"title": "eggs"}`); res.Code != tt.want {
+					t.Fatalf("%s %s: status %d, want %d, body %s", tt.method, tt.target, res.Code, tt.want, res.Body.String())
+				}
+				if list, trash := count("/chores/"), count("/chores/trash"); list != tt.list || trash != tt.trash {
+					t.Fatalf("after %s %s: %d listed and %d in the trash, want %d and %d", tt.method, tt.target, list, trash, tt.list, tt.trash)
+				}
+			}
+		})
+	}
+}
+
+func TestPurgeDeleted(t *testing.T) {
+	for name, appCtx := range backendContexts(t) {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			for _, title := range []string{"old", "recent", "kept"} {
+				chore := Chore{Title: title}
+				if err := Create(ctx, appCtx, &chore); err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				if title == "kept" {
+					continue
+				}
+				if err := Delete[Chore](ctx, appCtx, chore.Id.Hex()); err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+			}
+			// Moving the deletion of the old chore back in time.
+			longAgo := time.Now().UTC().Add(-48 * time.Hour)
+			_, err := appCtx.backend().UpdateMany(ctx, appCtx.collection(getModel[Chore]()),
+				Filter{{Field: "title", Op: OpEq, Value: "old"}}, Patch{Set: map[string]any{"deletedAt": longAgo}})
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			purged, err := PurgeDeleted[Chore](ctx, appCtx, 24*time.Hour)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if purged != 1 {
+				t.Errorf("purged %d chores, want 1", purged)
+			}
+			var trash []Chore
+			if err := ReadTrash(ctx, appCtx, &trash, Query{}); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if len(trash) != 1 || trash[0].Title != "recent" {
+				t.Errorf("got %v in the trash, want the recent chore", trash)
+			}
+		})
+	}
+}
+
+type Room struct {
+	Id primitive.ObjectID `json:"id,omitempty" bson:"_id,omitempty"`
+}
+
+type Errand struct {
+	Id        primitive.ObjectID `json:"id,omitempty" bson:"_id,omitempty"`
+	RoomID    primitive.ObjectID `json:"roomId" bson:"roomId" grf:"ref=Room,onDelete=cascade"`
+	DeletedAt *time.Time         `json:"deletedAt,omitempty" bson:"deletedAt" grf:"softdelete"`
+}
+
+func TestCascadeToSoftDeleted(t *testing.T) {
+	RegisterModel[Room]()
+	RegisterModel[Errand]()
+	for name, appCtx := range backendContexts(t) {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			kitchen, hall := Room{}, Room{}
+			Create(ctx, appCtx, &kitchen)
+			Create(ctx, appCtx, &hall)
+			dishes, sweep := Errand{RoomID: kitchen.Id}, Errand{RoomID: hall.Id}
+			Create(ctx, appCtx, &dishes)
+			Create(ctx, appCtx, &sweep)
+
+			if err := Delete[Room](ctx, appCtx, kitchen.Id.Hex()); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			var trash, errands []Errand
+			if err := ReadTrash(ctx, appCtx, &trash, Query{}); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if err := Read(ctx, appCtx, &errands); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if len(trash) != 1 || trash[0].Id != dishes.Id || len(errands) != 1 || errands[0].Id != sweep.Id {
+				t.Fatalf("got %v in the trash and %v left, want the errand of the kitchen in the trash", trash, errands)
+			}
+			if err := Restore(ctx, appCtx, &dishes, dishes.Id.Hex()); err != nil {
+				t.Errorf("the cascaded errand can't be restored: %v", err)
+			}
+		})
+	}
+}
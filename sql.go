@@ -0,0 +1,831 @@
+package grf
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// SQLDialect holds what differs between the databases SQLBackend runs on.
+type SQLDialect struct {
+	// Writes the nth (1 based) parameter of a statement.
+	Placeholder func(n int) string
+	// Column definition of integer ids generated by the database.
+	AutoIncrement string
+	// LIMIT that returns every row, needed before an OFFSET.
+	NoLimit string
+}
+
+// Dialects for SQLite and PostgreSQL.
+var (
+	SQLite = SQLDialect{
+		Placeholder:   func(int) string { return "?" },
+		AutoIncrement: "INTEGER PRIMARY KEY",
+		NoLimit:       "-1",
+	}
+	Postgres = SQLDialect{
+		Placeholder:   func(n int) string { return "$" + strconv.Itoa(n) },
+		AutoIncrement: "BIGSERIAL PRIMARY KEY",
+		NoLimit:       "ALL",
+	}
+)
+
+// SQLBackend stores every model in a table of a relational database, through database/sql.
+//
+// Tables are created on first use, named like the mongodb collections. Each field is a column named after its bson tag,
+// the _id field is the "id" primary key. Strings, numbers, booleans, times and ObjectIDs (as hex) get columns of their own type,
+// anything else (embedded structs, slices, maps) is stored as json text. Fields tagged `grf:"unique"` get a unique constraint.
+//
+// Filters and sorting on plain columns run in the database. Conditions on json columns or nested paths
+// are checked on the loaded objects, as are patches, so they behave the same as on mongodb.
+// Ids are normally set by the id strategy of the model before the insert. Integer ids still left at zero
+// are generated by the database.
+type SQLBackend struct {
+	DB      *sql.DB
+	Dialect SQLDialect
+	// Tables known to exist.
+	tables sync.Map
+}
+
+// Returns a SQLBackend over the database. The dialect defaults to SQLite.
+func NewSQLBackend(db *sql.DB, dialect SQLDialect) *SQLBackend {
+	if dialect.Placeholder == nil {
+		dialect = SQLite
+	}
+	return &SQLBackend{DB: db, Dialect: dialect}
+}
+
+// Runs statements on the transaction of the context, or on the database.
+type sqlConn interface {
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error)
+}
+
+type sqlTransactionKey struct{}
+
+type sqlTransaction struct {
+	backend *SQLBackend
+	tx      *sql.Tx
+}
+
+func (b *SQLBackend) conn(ctx context.Context) sqlConn {
+	if t, ok := ctx.Value(sqlTransactionKey{}).(sqlTransaction); ok && t.backend == b {
+		return t.tx
+	}
+	return b.DB
+}
+
+// Creates the table of the model if it does not exist yet.
+func (b *SQLBackend) ensureTable(ctx context.Context, c Collection) error {
+	table := c.Name
+	if _, ok := b.tables.Load(table); ok {
+		return nil
+	}
+	idField := c.Model.IDField()
+	if idField == nil {
+		return fmt.Errorf("%s has no _id field to use as primary key", c.Model.Name)
+	}
+
+	var columns []string
+	for _, field := range sqlFields(c.Model) {
+		definition := quoteIdent(sqlColumn(field)) + " " + sqlType(field.Type)
+		switch {
+		case field == idField && isIntegerID(field):
+			definition = quoteIdent(sqlColumn(field)) + " " + b.Dialect.AutoIncrement
+		case field == idField:
+			definition += " PRIMARY KEY"
+		case field.Options.Has("unique"):
+			definition += " UNIQUE"
+		}
+		columns = append(columns, definition)
+	}
+	statement := fmt.Sprintf("CREATE TABLE IF NOT EXISTS %s (%s)", quoteIdent(table), strings.Join(columns, ", "))
+	if _, err := b.conn(ctx).ExecContext(ctx, statement); err != nil {
+		log.Println("Error creating table "+table, err)
+		return sqlError(err)
+	}
+	// A table created inside a transaction is gone again if it rolls back, so it is only remembered outside of one.
+	if _, ok := ctx.Value(sqlTransactionKey{}).(sqlTransaction); !ok {
+		b.tables.Store(table, true)
+	}
+	return nil
+}
+
+func (b *SQLBackend) Insert(ctx context.Context, c Collection, object any) (any, error) {
+	if err := b.ensureTable(ctx, c); err != nil {
+		return nil, err
+	}
+	value := reflect.ValueOf(object).Elem()
+	idField := c.Model.IDField()
+	var id any
+	if idValue := value.FieldByIndex(idField.Index); !idValue.IsZero() {
+		id = idValue.Interface()
+	} else if !isIntegerID(idField) {
+		// Generating missing ids the way the mongo driver does.
+		id = primitive.NewObjectID()
+		if indirect(idField.Type).Kind() == reflect.String {
+			id = id.(primitive.ObjectID).Hex()
+		}
+	}
+
+	var columns, placeholders []string
+	var args []any
+	for _, field := range sqlFields(c.Model) {
+		fieldValue := value.FieldByIndex(field.Index).Interface()
+		if field == idField {
+			if id == nil {
+				// Left for the database to generate.
+				continue
+			}
+			fieldValue = id
+		}
+		arg, err := sqlValue(fieldValue)
+		if err != nil {
+			return nil, err
+		}
+		columns = append(columns, quoteIdent(sqlColumn(field)))
+		placeholders = append(placeholders, b.arg(&args, arg))
+	}
+	statement := fmt.Sprintf("INSERT INTO %s (%s) VALUES (%s)", quoteIdent(c.Name), strings.Join(columns, ", "), strings.Join(placeholders, ", "))
+	if id != nil {
+		if _, err := b.conn(ctx).ExecContext(ctx, statement, args...); err != nil {
+			log.Println("Error adding object to database.", err)
+			return nil, sqlError(err)
+		}
+		return id, nil
+	}
+
+	rows, err := b.conn(ctx).QueryContext(ctx, statement+" RETURNING "+quoteIdent(sqlColumn(idField)), args...)
+	if err != nil {
+		log.Println("Error adding object to database.", err)
+		return nil, sqlError(err)
+	}
+	defer rows.Close()
+	generated := reflect.New(idField.Type).Elem()
+	if !rows.Next() {
+		return nil, sqlError(rows.Err())
+	}
+	if err := rows.Scan(fieldScanner{generated}); err != nil {
+		return nil, sqlError(err)
+	}
+	return generated.Interface(), nil
+}
+
+// Inserts the objects one by one, databases report failing rows only for single statements.
+func (b *SQLBackend) InsertMany(ctx context.Context, c Collection, objects []any) ([]any, error) {
+	return insertEach(ctx, b, c, objects)
+}
+
+func (b *SQLBackend) FindOne(ctx context.Context, c Collection, filter Filter, object any) error {
+	objects, err := b.find(ctx, c, Query{Filter: filter, Limit: 1})
+	if err != nil {
+		return err
+	}
+	if len(objects) == 0 {
+		return newError(ErrNotFound, "", nil)
+	}
+	reflect.ValueOf(object).Elem().Set(objects[0].Elem())
+	return nil
+}
+
+func (b *SQLBackend) Find(ctx context.Context, c Collection, query Query, objects any) error {
+	found, err := b.find(ctx, c, query)
+	if err != nil {
+		return err
+	}
+	slice := reflect.ValueOf(objects).Elem()
+	result := reflect.MakeSlice(slice.Type(), 0, len(found))
+	for _, object := range found {
+		result = reflect.Append(result, object.Elem())
+	}
+	slice.Set(result)
+	return nil
+}
+
+func (b *SQLBackend) Count(ctx context.Context, c Collection, filter Filter) (int64, error) {
+	if err := b.ensureTable(ctx, c); err != nil {
+		return 0, err
+	}
+	var args []any
+	where, rest := b.where(c.Model, filter, &args)
+	if len(rest) > 0 {
+		objects, err := b.find(ctx, c, Query{Filter: filter})
+		return int64(len(objects)), err
+	}
+
+	rows, err := b.conn(ctx).QueryContext(ctx, "SELECT COUNT(*) FROM "+quoteIdent(c.Name)+where, args...)
+	if err != nil {
+		return 0, sqlError(err)
+	}
+	defer rows.Close()
+	var count int64
+	if rows.Next() {
+		err = rows.Scan(&count)
+	}
+	return count, sqlError(errors.Join(err, rows.Err()))
+}
+
+func (b *SQLBackend) ReplaceOne(ctx context.Context, c Collection, filter Filter, object any) error {
+	return b.WithTransaction(ctx, func(ctx context.Context) error {
+		objects, err := b.find(ctx, c, Query{Filter: filter, Limit: 1})
+		if err != nil {
+			return err
+		}
+		if len(objects) == 0 {
+			return newError(ErrNotFound, "", nil)
+		}
+		// The stored id stays.
+		idField := c.Model.IDField()
+		replacement := reflect.New(c.Model.Type)
+		replacement.Elem().Set(reflect.ValueOf(object).Elem())
+		replacement.Elem().FieldByIndex(idField.Index).Set(objects[0].Elem().FieldByIndex(idField.Index))
+		if err := b.update(ctx, c, replacement, filter); err != nil {
+			return err
+		}
+		log.Println("Replaced object.")
+		return nil
+	})
+}
+
+func (b *SQLBackend) UpdateOne(ctx context.Context, c Collection, filter Filter, patch Patch, object any) error {
+	return b.WithTransaction(ctx, func(ctx context.Context) error {
+		objects, err := b.find(ctx, c, Query{Filter: filter, Limit: 1})
+		if err != nil {
+			return err
+		}
+		if len(objects) == 0 {
+			return newError(ErrNotFound, "", nil)
+		}
+		updated, err := b.patch(ctx, c, objects[0], patch, filter)
+		if err != nil || object == nil {
+			return err
+		}
+		reflect.ValueOf(object).Elem().Set(updated.Elem())
+		return nil
+	})
+}
+
+func (b *SQLBackend) UpdateMany(ctx context.Context, c Collection, filter Filter, patch Patch) (int64, error) {
+	var modified int64
+	err := b.WithTransaction(ctx, func(ctx context.Context) error {
+		objects, err := b.find(ctx, c, Query{Filter: filter})
+		if err != nil {
+			return err
+		}
+		for _, object := range objects {
+			_, err := b.patch(ctx, c, object, patch, filter)
+			if errors.Is(err, ErrNotFound) {
+				// Changed by someone else since it was loaded, it no longer matches.
+				continue
+			}
+			if err != nil {
+				return err
+			}
+			modified++
+		}
+		return nil
+	})
+	return modified, err
+}
+
+// Applies the updates one by one, see InsertMany.
+func (b *SQLBackend) BulkWrite(ctx context.Context, c Collection, updates []BulkWriteModel) (int64, error) {
+	return updateEach(ctx, b, c, updates)
+}
+
+func (b *SQLBackend) DeleteOne(ctx context.Context, c Collection, filter Filter) (int64, error) {
+	objects, err := b.find(ctx, c, Query{Filter: filter, Limit: 1})
+	if err != nil || len(objects) == 0 {
+		return 0, err
+	}
+	// The row is only deleted if it still matches, it may have changed since it was loaded.
+	var args []any
+	where := b.rowWhere(c, objects[0], filter, &args)
+	res, err := b.conn(ctx).ExecContext(ctx, "DELETE FROM "+quoteIdent(c.Name)+where, args...)
+	if err != nil {
+		log.Println("Error deleting object:", err)
+		return 0, sqlError(err)
+	}
+	return res.RowsAffected()
+}
+
+func (b *SQLBackend) DeleteMany(ctx context.Context, c Collection, filter Filter) (int64, error) {
+	if err := b.ensureTable(ctx, c); err != nil {
+		return 0, err
+	}
+	var args []any
+	where, rest := b.where(c.Model, filter, &args)
+	if len(rest) > 0 {
+		// Some conditions can't be checked by the database, the matching ids are collected first.
+		objects, err := b.find(ctx, c, Query{Filter: filter})
+		if err != nil || len(objects) == 0 {
+			return 0, err
+		}
+		idField := c.Model.IDField()
+		ids := make([]any, len(objects))
+		for i, object := range objects {
+			ids[i] = object.Elem().FieldByIndex(idField.Index).Interface()
+		}
+		args = nil
+		where, _ = b.where(c.Model, Filter{{Field: "_id", Op: OpIn, Value: ids}}, &args)
+	}
+
+	res, err := b.conn(ctx).ExecContext(ctx, "DELETE FROM "+quoteIdent(c.Name)+where, args...)
+	if err != nil {
+		log.Println("Error deleting objects:", err)
+		return 0, sqlError(err)
+	}
+	return res.RowsAffected()
+}
+
+// Runs fn in a database transaction. If ctx is already part of a transaction, fn joins it.
+func (b *SQLBackend) WithTransaction(ctx context.Context, fn func(ctx context.Context) error) error {
+	if t, ok := ctx.Value(sqlTransactionKey{}).(sqlTransaction); ok && t.backend == b {
+		return fn(ctx)
+	}
+	tx, err := b.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return sqlError(err)
+	}
+	if err := fn(context.WithValue(ctx, sqlTransactionKey{}, sqlTransaction{backend: b, tx: tx})); err != nil {
+		if rollbackErr := tx.Rollback(); rollbackErr != nil {
+			log.Println("Error rolling back transaction:", rollbackErr)
+		}
+		return err
+	}
+	return sqlError(tx.Commit())
+}
+
+// Loads the objects matching the query, as pointers to new objects of the model.
+func (b *SQLBackend) find(ctx context.Context, c Collection, query Query) ([]reflect.Value, error) {
+	if err := b.ensureTable(ctx, c); err != nil {
+		return nil, err
+	}
+	fields := sqlFields(c.Model)
+	columns := make([]string, len(fields))
+	for i, field := range fields {
+		columns[i] = quoteIdent(sqlColumn(field))
+	}
+	var args []any
+	where, rest := b.where(c.Model, query.Filter, &args)
+	statement := fmt.Sprintf("SELECT %s FROM %s%s", strings.Join(columns, ", "), quoteIdent(c.Name), where)
+
+	// Sorting and paging run in the database unless some of it needs the loaded objects.
+	orderBy, sortable := sqlOrderBy(c.Model, query.Sort)
+	statement += orderBy
+	paged := len(rest) == 0 && sortable
+	if paged && query.Limit > 0 {
+		statement += " LIMIT " + strconv.FormatInt(query.Limit, 10)
+	}
+	if paged && query.Skip > 0 {
+		if query.Limit <= 0 {
+			statement += " LIMIT " + b.Dialect.NoLimit
+		}
+		statement += " OFFSET " + strconv.FormatInt(query.Skip, 10)
+	}
+
+	rows, err := b.conn(ctx).QueryContext(ctx, statement, args...)
+	if err != nil {
+		log.Println("error retrieving all objects of "+c.Name, err)
+		return nil, sqlError(err)
+	}
+	defer rows.Close()
+
+	var objects []reflect.Value
+	var docs []bson.Raw
+	for rows.Next() {
+		object := reflect.New(c.Model.Type)
+		scanners := make([]any, len(fields))
+		for i, field := range fields {
+			scanners[i] = fieldScanner{object.Elem().FieldByIndex(field.Index)}
+		}
+		if err := rows.Scan(scanners...); err != nil {
+			return nil, sqlError(err)
+		}
+		if len(rest) == 0 && sortable {
+			objects = append(objects, object)
+			continue
+		}
+		doc, err := bson.Marshal(object.Interface())
+		if err != nil {
+			return nil, err
+		}
+		if ok, err := matches(doc, rest); err != nil || !ok {
+			if err != nil {
+				return nil, err
+			}
+			continue
+		}
+		objects = append(objects, object)
+		docs = append(docs, doc)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, sqlError(err)
+	}
+	if paged {
+		return objects, nil
+	}
+
+	if !sortable {
+		indexes := make([]int, len(objects))
+		for i := range indexes {
+			indexes[i] = i
+		}
+		sort.SliceStable(indexes, func(i, j int) bool {
+			for _, s := range query.Sort {
+				path := strings.Split(s.Field, ".")
+				c := compareValues(docs[indexes[i]].Lookup(path...), docs[indexes[j]].Lookup(path...))
+				if c != 0 {
+					return (c < 0) != s.Desc
+				}
+			}
+			return false
+		})
+		sorted := make([]reflect.Value, len(objects))
+		for i, index := range indexes {
+			sorted[i] = objects[index]
+		}
+		objects = sorted
+	}
+	if query.Skip > 0 {
+		objects = objects[min(query.Skip, int64(len(objects))):]
+	}
+	if query.Limit > 0 && query.Limit < int64(len(objects)) {
+		objects = objects[:query.Limit]
+	}
+	return objects, nil
+}
+
+// Applies the patch to a loaded object, stores it and returns the updated object.
+// Fails with ErrNotFound if the row no longer matches the filter.
+func (b *SQLBackend) patch(ctx context.Context, c Collection, object reflect.Value, patch Patch, filter Filter) (reflect.Value, error) {
+	raw, err := bson.Marshal(object.Interface())
+	if err != nil {
+		return reflect.Value{}, err
+	}
+	if raw, err = applyPatch(raw, patch); err != nil {
+		return reflect.Value{}, err
+	}
+	updated := reflect.New(c.Model.Type)
+	if err := bson.Unmarshal(raw, updated.Interface()); err != nil {
+		return reflect.Value{}, newError(ErrValidation, "the patched object does not fit the model", err)
+	}
+	return updated, b.update(ctx, c, updated, filter)
+}
+
+// Writes every column of the object to its row, if the row still matches the filter. Fails with ErrNotFound otherwise,
+// when the row was changed or deleted since it was loaded.
+func (b *SQLBackend) update(ctx context.Context, c Collection, object reflect.Value, filter Filter) error {
+	idField := c.Model.IDField()
+	var assignments []string
+	var args []any
+	for _, field := range sqlFields(c.Model) {
+		if field == idField {
+			continue
+		}
+		arg, err := sqlValue(object.Elem().FieldByIndex(field.Index).Interface())
+		if err != nil {
+			return err
+		}
+		assignments = append(assignments, quoteIdent(sqlColumn(field))+" = "+b.arg(&args, arg))
+	}
+	where := b.rowWhere(c, object, filter, &args)
+	statement := fmt.Sprintf("UPDATE %s SET %s%s", quoteIdent(c.Name), strings.Join(assignments, ", "), where)
+	res, err := b.conn(ctx).ExecContext(ctx, statement, args...)
+	if err != nil {
+		log.Println("Error updating object:", err)
+		return sqlError(err)
+	}
+	if updated, err := res.RowsAffected(); err != nil || updated == 0 {
+		return errors.Join(newError(ErrNotFound, "", nil), err)
+	}
+	return nil
+}
+
+// Returns the WHERE clause of the row of a loaded object, as long as it still matches the conditions of the filter
+// the database can check. Conditions like the version of the object are checked by the statement writing the row,
+// so concurrent writes can't both succeed.
+func (b *SQLBackend) rowWhere(c Collection, object reflect.Value, filter Filter, args *[]any) string {
+	id := object.Elem().FieldByIndex(c.Model.IDField().Index).Interface()
+	where, _ := b.where(c.Model, append(Filter{{Field: "_id", Op: OpEq, Value: id}}, filter...), args)
+	return where
+}
+
+// Translates the conditions of the filter on plain columns into a WHERE clause.
+// The rest of the conditions are returned, to be checked on the loaded objects.
+func (b *SQLBackend) where(model *Model, filter Filter, args *[]any) (string, Filter) {
+	var clauses []string
+	var rest Filter
+	for _, c := range filter {
+		field := model.FieldByBSON(c.Field)
+		if field == nil || !isSQLScalar(field.Type) {
+			rest = append(rest, c)
+			continue
+		}
+		clause, ok := b.condition(quoteIdent(sqlColumn(field)), c, args)
+		if !ok {
+			rest = append(rest, c)
+			continue
+		}
+		clauses = append(clauses, clause)
+		// LIKE ignores case on some databases, these only narrow the rows down and are checked again.
+		if c.Op == OpContains || c.Op == OpStartsWith {
+			rest = append(rest, c)
+		}
+	}
+	if len(clauses) == 0 {
+		return "", rest
+	}
+	return " WHERE " + strings.Join(clauses, " AND "), rest
+}
+
+// Translates a condition on a column. Reports false for values the database can't compare.
+func (b *SQLBackend) condition(column string, c Condition, args *[]any) (string, bool) {
+	if c.Op == OpIn {
+		values := reflect.ValueOf(c.Value)
+		if values.Kind() != reflect.Slice && values.Kind() != reflect.Array {
+			return "", false
+		}
+		if values.Len() == 0 {
+			return "1 = 0", true
+		}
+		var placeholders []string
+		null := false
+		for i := 0; i < values.Len(); i++ {
+			value, err := sqlValue(values.Index(i).Interface())
+			if err != nil {
+				return "", false
+			}
+			if value == nil {
+				null = true
+				continue
+			}
+			placeholders = append(placeholders, b.arg(args, value))
+		}
+		switch {
+		case !null:
+			return column + " IN (" + strings.Join(placeholders, ", ") + ")", true
+		case len(placeholders) == 0:
+			return column + " IS NULL", true
+		}
+		return "(" + column + " IN (" + strings.Join(placeholders, ", ") + ") OR " + column + " IS NULL)", true
+	}
+
+	value, err := sqlValue(c.Value)
+	if err != nil {
+		return "", false
+	}
+	switch c.Op {
+	case OpEq, "":
+		if value == nil {
+			return column + " IS NULL", true
+		}
+		return column + " = " + b.arg(args, value), true
+	case OpNe:
+		if value == nil {
+			return column + " IS NOT NULL", true
+		}
+		return "(" + column + " <> " + b.arg(args, value) + " OR " + column + " IS NULL)", true
+	case OpGt, OpGte, OpLt, OpLte:
+		if value == nil {
+			return "", false
+		}
+		operator := map[string]string{OpGt: ">", OpGte: ">=", OpLt: "<", OpLte: "<="}[c.Op]
+		return column + " " + operator + " " + b.arg(args, value), true
+	case OpContains, OpIContains, OpStartsWith:
+		pattern := strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`).Replace(fmt.Sprint(c.Value)) + "%"
+		if c.Op != OpStartsWith {
+			pattern = "%" + pattern
+		}
+		if c.Op == OpIContains {
+			return "LOWER(" + column + ") LIKE LOWER(" + b.arg(args, pattern) + `) ESCAPE '\'`, true
+		}
+		return column + " LIKE " + b.arg(args, pattern) + ` ESCAPE '\'`, true
+	}
+	return "", false
+}
+
+// Adds a parameter to the statement and returns its placeholder.
+func (b *SQLBackend) arg(args *[]any, value any) string {
+	*args = append(*args, value)
+	return b.Dialect.Placeholder(len(*args))
+}
+
+// Translates the sort into an ORDER BY clause. Reports false if some field is not a plain column.
+func sqlOrderBy(model *Model, fields []SortField) (string, bool) {
+	var order []string
+	for _, s := range fields {
+		field := model.FieldByBSON(s.Field)
+		if field == nil || !isSQLScalar(field.Type) {
+			return "", false
+		}
+		direction := " ASC"
+		if s.Desc {
+			direction = " DESC"
+		}
+		order = append(order, quoteIdent(sqlColumn(field))+direction)
+	}
+	if len(order) == 0 {
+		return "", true
+	}
+	return " ORDER BY " + strings.Join(order, ", "), true
+}
+
+// Returns the fields of the model that are stored in columns.
+func sqlFields(model *Model) []*Field {
+	var fields []*Field
+	for _, field := range model.Fields {
+		if field.BSONName != "-" {
+			fields = append(fields, field)
+		}
+	}
+	return fields
+}
+
+func sqlColumn(field *Field) string {
+	if field.BSONName == "_id" {
+		return "id"
+	}
+	return field.BSONName
+}
+
+// Returns the column type of a field.
+func sqlType(t reflect.Type) string {
+	t = indirect(t)
+	switch {
+	case t == timeType:
+		return "TIMESTAMP"
+	case t == objectIDType:
+		return "TEXT"
+	}
+	switch t.Kind() {
+	case reflect.Bool:
+		return "BOOLEAN"
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return "BIGINT"
+	case reflect.Float32, reflect.Float64:
+		return "DOUBLE PRECISION"
+	}
+	return "TEXT"
+}
+
+// Reports whether values of the type are stored as they are, rather than as json text.
+func isSQLScalar(t reflect.Type) bool {
+	t = indirect(t)
+	return t == timeType || t == objectIDType || t.Kind() != reflect.Struct && t.Kind() != reflect.Slice &&
+		t.Kind() != reflect.Array && t.Kind() != reflect.Map && t.Kind() != reflect.Interface
+}
+
+func quoteIdent(name string) string {
+	return `"` + strings.ReplaceAll(name, `"`, `""`) + `"`
+}
+
+// Converts a field or filter value into a statement parameter.
+func sqlValue(value any) (any, error) {
+	switch v := value.(type) {
+	case nil:
+		return nil, nil
+	case primitive.ObjectID:
+		return v.Hex(), nil
+	case time.Time:
+		return v.UTC(), nil
+	case primitive.DateTime:
+		return v.Time().UTC(), nil
+	}
+	rv := reflect.ValueOf(value)
+	switch rv.Kind() {
+	case reflect.Pointer:
+		if rv.IsNil() {
+			return nil, nil
+		}
+		return sqlValue(rv.Elem().Interface())
+	case reflect.Bool:
+		return rv.Bool(), nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return rv.Int(), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return int64(rv.Uint()), nil
+	case reflect.Float32, reflect.Float64:
+		return rv.Float(), nil
+	case reflect.String:
+		return rv.String(), nil
+	}
+	data, err := json.Marshal(value)
+	if err != nil {
+		return nil, err
+	}
+	return string(data), nil
+}
+
+// Scans a column into a field of a model.
+type fieldScanner struct {
+	field reflect.Value
+}
+
+func (s fieldScanner) Scan(src any) error {
+	target := s.field
+	if src == nil {
+		target.Set(reflect.Zero(target.Type()))
+		return nil
+	}
+	if target.Kind() == reflect.Pointer {
+		target.Set(reflect.New(target.Type().Elem()))
+		target = target.Elem()
+	}
+	if data, ok := src.([]byte); ok {
+		src = string(data)
+	}
+
+	switch target.Type() {
+	case objectIDType:
+		objectID, err := primitive.ObjectIDFromHex(fmt.Sprint(src))
+		target.Set(reflect.ValueOf(objectID))
+		return err
+	case timeType:
+		t, ok := src.(time.Time)
+		if !ok {
+			var err error
+			if t, err = parseSQLTime(fmt.Sprint(src)); err != nil {
+				return err
+			}
+		}
+		target.Set(reflect.ValueOf(t))
+		return nil
+	}
+
+	text := fmt.Sprint(src)
+	switch target.Kind() {
+	case reflect.Bool:
+		b, err := strconv.ParseBool(text)
+		target.SetBool(b)
+		return err
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		i, err := strconv.ParseInt(text, 10, 64)
+		target.SetInt(i)
+		return err
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		u, err := strconv.ParseUint(text, 10, 64)
+		target.SetUint(u)
+		return err
+	case reflect.Float32, reflect.Float64:
+		f, err := strconv.ParseFloat(text, 64)
+		target.SetFloat(f)
+		return err
+	case reflect.String:
+		target.SetString(text)
+		return nil
+	}
+	return json.Unmarshal([]byte(text), target.Addr().Interface())
+}
+
+// Parses times stored as text.
+func parseSQLTime(text string) (time.Time, error) {
+	for _, layout := range []string{time.RFC3339Nano, "2006-01-02 15:04:05.999999999-07:00", "2006-01-02 15:04:05.999999999"} {
+		if t, err := time.Parse(layout, text); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("cannot parse %q as a time", text)
+}
+
+// Translates database/sql errors into grf errors.
+func sqlError(err error) error {
+	switch {
+	case err == nil:
+		return nil
+	case errors.Is(err, sql.ErrNoRows):
+		return newError(ErrNotFound, "", err)
+	case strings.Contains(strings.ToLower(err.Error()), "unique constraint") || strings.Contains(err.Error(), "duplicate key"):
+		return newError(ErrConflict, "an object with the same unique fields already exists", err)
+	case errors.Is(err, context.DeadlineExceeded):
+		return newError(ErrTimeout, "the database did not respond in time", err)
+	case isSQLTransient(err):
+		return newError(ErrTransient, "the change conflicted with another one, try again", err)
+	}
+	return err
+}
+
+// Reports whether a database/sql error is a conflict with another transaction.
+// Covers SQLite's busy database and PostgreSQL's serialization failures and deadlocks.
+func isSQLTransient(err error) bool {
+	msg := strings.ToLower(err.Error())
+	for _, transient := range []string{"database is locked", "sqlite_busy", "40001", "40p01", "could not serialize access", "deadlock detected"} {
+		if strings.Contains(msg, transient) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,147 @@
+package grf
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+type Invoice struct {
+	Id     int64     `json:"id" bson:"_id"`
+	Number string    `json:"number" bson:"number" grf:"unique,filter"`
+	Total  float64   `json:"total" bson:"total" grf:"filter,sort"`
+	Lines  []string  `json:"lines" bson:"lines"`
+	Due    time.Time `json:"due" bson:"due"`
+}
+
+func TestSQLBackendRoutes(t *testing.T) {
+	db, err := sql.Open("sqlite", ":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	db.SetMaxOpenConns(1)
+	defer db.Close()
+
+	r := http.NewServeMux()
+	RegisterCRUDRoutes[Invoice]("/invoice", ServeMux(r), &Ctx{Backend: NewSQLBackend(db, SQLite)})
+	server := httptest.NewServer(r)
+	defer server.Close()
+
+	due := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	for i, number := range []string{"A-1", "A-2"} {
+		body, _ := json.Marshal(Invoice{Number: number, Total: float64(10 * (i + 1)), Lines: []string{"tea"}, Due: due})
+		res, err := http.Post(server.URL+"/invoice/", "application/json", strings.NewReader(string(body)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		res.Body.Close()
+		if res.StatusCode != http.StatusCreated {
+			t.Fatalf("create %s: status %d", number, res.StatusCode)
+		}
+		if want := "/invoice/" + string(rune('1'+i)); res.Header.Get("Location") != want {
+			t.Fatalf("Location is %s, want %s", res.Header.Get("Location"), want)
+		}
+	}
+
+	res, err := http.Post(server.URL+"/invoice/", "application/json", strings.NewReader(`{"number": "A-1"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+	if res.StatusCode != http.StatusConflict {
+		t.Errorf("duplicate number: status %d, want %d", res.StatusCode, http.StatusConflict)
+	}
+
+	req, _ := http.NewRequest(http.MethodPatch, server.URL+"/invoice/2", strings.NewReader(`{"lines": ["tea", "cake"]}`))
+	req.Header.Set("Content-Type", MergePatchMediaType)
+	res, err = http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		t.Fatalf("patch: status %d", res.StatusCode)
+	}
+
+	res, err = http.Get(server.URL + "/invoice/?total__gte=15&sort=-total")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+	var invoices []Invoice
+	if err := json.NewDecoder(res.Body).Decode(&invoices); err != nil {
+		t.Fatal(err)
+	}
+	if len(invoices) != 1 || invoices[0].Id != 2 || len(invoices[0].Lines) != 2 || !invoices[0].Due.Equal(due) {
+		t.Errorf("got %+v", invoices)
+	}
+}
+
+func TestSQLConcurrentVersions(t *testing.T) {
+	db, err := sql.Open("sqlite", ":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	db.SetMaxOpenConns(1)
+	defer db.Close()
+	backend := NewSQLBackend(db, SQLite)
+	appCtx := &Ctx{Backend: backend}
+
+	mux := http.NewServeMux()
+	RegisterCRUDRoutes[Draft]("/drafts", ServeMux(mux), appCtx)
+	res := httptest.NewRecorder()
+	mux.ServeHTTP(res, httptest.NewRequest(http.MethodPost, "/drafts/", strings.NewReader(`{"title": "a"}`)))
+	location := res.Header().Get("Location")
+
+	// Every request sends the version they all read, only one of them may win.
+	statuses := make(chan int, 8)
+	var wg sync.WaitGroup
+	for i := 0; i < cap(statuses); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			req := httptest.NewRequest(http.MethodPut, location, strings.NewReader(`{"title": "b"}`))
+			req.Header.Set("If-Match", `"1"`)
+			res := httptest.NewRecorder()
+			mux.ServeHTTP(res, req)
+			statuses <- res.Code
+		}()
+	}
+	wg.Wait()
+	close(statuses)
+	counts := map[int]int{}
+	for status := range statuses {
+		counts[status]++
+	}
+	if counts[http.StatusOK] != 1 || counts[http.StatusPreconditionFailed] != cap(statuses)-1 {
+		t.Errorf("got statuses %v, want one 200 and the rest 412", counts)
+	}
+
+	// A write of an object loaded before another change went through doesn't touch the row.
+	ctx := context.Background()
+	c := appCtx.collection(getModel[Draft]())
+	var stale Draft
+	if err := backend.FindOne(ctx, c, nil, &stale); err != nil {
+		t.Fatal(err)
+	}
+	filter := Filter{versionCondition(versionField(c.Model), &stale)}
+	if _, err := backend.UpdateMany(ctx, c, nil, touch(c.Model, Patch{Set: map[string]any{"title": "c"}})); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := backend.patch(ctx, c, reflect.ValueOf(&stale), Patch{Set: map[string]any{"title": "d"}}, filter); !errors.Is(err, ErrNotFound) {
+		t.Errorf("patching a stale object: got %v, want not found", err)
+	}
+	var stored Draft
+	backend.FindOne(ctx, c, nil, &stored)
+	if stored.Title != "c" || stored.Version != 3 {
+		t.Errorf("got %+v, want the concurrent change", stored)
+	}
+}
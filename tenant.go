@@ -0,0 +1,337 @@
+package grf
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// TenantResolver returns the tenant a request is for, "" when the request doesn't say.
+type TenantResolver func(r *http.Request) string
+
+// Takes the tenant from a request header, like X-Tenant.
+func TenantFromHeader(header string) TenantResolver {
+	return func(r *http.Request) string {
+		return strings.TrimSpace(r.Header.Get(header))
+	}
+}
+
+// Takes the tenant from the subdomain of the host the request is sent to, acme for acme.example.com
+// with the domain example.com. Hosts with deeper or without subdomains have no tenant.
+func TenantFromSubdomain(domain string) TenantResolver {
+	suffix := "." + strings.ToLower(strings.Trim(domain, "."))
+	return func(r *http.Request) string {
+		host := r.Host
+		if h, _, err := net.SplitHostPort(host); err == nil {
+			host = h
+		}
+		subdomain, found := strings.CutSuffix(strings.ToLower(host), suffix)
+		if !found || strings.Contains(subdomain, ".") {
+			return ""
+		}
+		return subdomain
+	}
+}
+
+// Takes the tenant from the principal of the request, its Tenant. That is the tenant claim of JWTs,
+// see JWTAuthenticator.TenantClaim, or the tenant of the API key or session.
+func TenantFromPrincipal() TenantResolver {
+	return func(r *http.Request) string {
+		if principal := PrincipalFrom(r.Context()); principal != nil {
+			return principal.Tenant
+		}
+		return ""
+	}
+}
+
+// Takes the tenant from a claim of the principal of the request, like a claim of its JWT.
+func TenantFromClaim(claim string) TenantResolver {
+	return func(r *http.Request) string {
+		if principal := PrincipalFrom(r.Context()); principal != nil {
+			tenant, _ := principal.Claims[claim].(string)
+			return tenant
+		}
+		return ""
+	}
+}
+
+// TenantDatabase is where the data of a tenant is stored.
+type TenantDatabase struct {
+	// Connection string of a deployment of the tenant's own. Tenants without one share the client of TenantDatabases.
+	URI string
+	// Name of the database. Defaults to the name of the tenant.
+	Name string
+}
+
+// How long the connections of tenants with a deployment of their own are kept open without being used.
+var DefaultTenantIdleTimeout = 10 * time.Minute
+
+// TenantDatabases stores the data of every tenant in a database of its own. Set it on the app context and
+// the H handlers run against the database of the tenant of the request, the one Resolve returns.
+// Tenants are provisioned with Register at any time, requests for other tenants are a 404.
+// The connections to tenants with a deployment of their own are opened when they are first used
+// and closed again when they have been idle for IdleTimeout. It is safe for concurrent use.
+type TenantDatabases struct {
+	Resolve TenantResolver
+	// Set when Resolve takes the tenant from the authenticated principal itself, like TenantFromClaim does.
+	// Otherwise the tenant of a request has to be the Tenant of its principal.
+	TrustResolve bool
+	// The client of the tenants without a URI.
+	Client *mongo.Client
+	// Defaults to DefaultTenantIdleTimeout.
+	IdleTimeout time.Duration
+
+	mu      sync.Mutex
+	tenants map[string]TenantDatabase
+	clients map[string]*tenantClient
+}
+
+// A connection to the deployment of a tenant.
+type tenantClient struct {
+	client *mongo.Client
+	// Requests using the connection right now.
+	uses     int
+	lastUsed time.Time
+	// Set when the tenant was moved or unregistered, the last request using the connection closes it.
+	retired bool
+}
+
+// Marks the connection as no longer used for new requests and closes it if no request is using it.
+// The caller holds the lock of the tenant databases.
+func (c *tenantClient) retire() {
+	c.retired = true
+	if c.uses == 0 {
+		go c.client.Disconnect(context.Background())
+	}
+}
+
+// Returns the tenant databases resolving the tenant of requests with resolve. Tenants without a URI use the client.
+func NewTenantDatabases(client *mongo.Client, resolve TenantResolver) *TenantDatabases {
+	return &TenantDatabases{Resolve: resolve, Client: client}
+}
+
+// Adds the tenant, or changes where its data is stored.
+func (t *TenantDatabases) Register(tenant string, database TenantDatabase) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.tenants == nil {
+		t.tenants = map[string]TenantDatabase{}
+	}
+	if old, ok := t.tenants[tenant]; ok && old.URI != database.URI {
+		// Closed once the requests using it are done.
+		if c := t.clients[tenant]; c != nil {
+			delete(t.clients, tenant)
+			c.retire()
+		}
+	}
+	t.tenants[tenant] = database
+	log.Println("Registered tenant", tenant)
+}
+
+// Removes the tenant, requests for it are a 404 from then on. Its connection is closed once the requests using it are done.
+func (t *TenantDatabases) Unregister(ctx context.Context, tenant string) error {
+	t.mu.Lock()
+	c := t.clients[tenant]
+	delete(t.clients, tenant)
+	delete(t.tenants, tenant)
+	inUse := c != nil && c.uses > 0
+	if inUse {
+		c.retired = true
+	}
+	t.mu.Unlock()
+	log.Println("Unregistered tenant", tenant)
+	if !inUse && c != nil {
+		return c.client.Disconnect(ctx)
+	}
+	return nil
+}
+
+// Returns the registered tenants, sorted.
+func (t *TenantDatabases) Tenants() []string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	tenants := make([]string, 0, len(t.tenants))
+	for tenant := range t.tenants {
+		tenants = append(tenants, tenant)
+	}
+	sort.Strings(tenants)
+	return tenants
+}
+
+// Returns the database of the tenant, connecting to its deployment if needed, and the function to call when done with it.
+// The connection isn't closed for being idle before that.
+func (t *TenantDatabases) acquire(ctx context.Context, tenant string) (*mongo.Database, func(), error) {
+	t.EvictIdle(ctx)
+
+	t.mu.Lock()
+	database, ok := t.tenants[tenant]
+	t.mu.Unlock()
+	if !ok {
+		return nil, nil, newError(ErrNotFound, "unknown tenant "+tenant, nil)
+	}
+	name := database.Name
+	if name == "" {
+		name = tenant
+	}
+	if database.URI == "" {
+		if t.Client == nil {
+			return nil, nil, errors.New("no client for the tenant " + tenant)
+		}
+		return t.Client.Database(name), func() {}, nil
+	}
+
+	c, err := t.connect(ctx, tenant, database.URI)
+	if errors.Is(err, errTenantMoved) {
+		return t.acquire(ctx, tenant)
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	release := func() {
+		t.mu.Lock()
+		defer t.mu.Unlock()
+		c.uses--
+		c.lastUsed = time.Now()
+		if c.retired && c.uses == 0 {
+			go c.client.Disconnect(context.Background())
+		}
+	}
+	return c.client.Database(name), release, nil
+}
+
+// Returned by connect when the tenant got another deployment while connecting to the old one.
+var errTenantMoved = errors.New("the tenant was moved")
+
+// Returns the connection to the deployment of the tenant in use, opening it if there is none yet.
+func (t *TenantDatabases) connect(ctx context.Context, tenant, uri string) (*tenantClient, error) {
+	t.mu.Lock()
+	if c := t.clients[tenant]; c != nil {
+		c.uses++
+		t.mu.Unlock()
+		return c, nil
+	}
+	t.mu.Unlock()
+
+	// Connecting may take a while, other tenants are served meanwhile.
+	client, err := mongo.Connect(ctx, options.Client().ApplyURI(uri))
+	if err != nil {
+		return nil, err
+	}
+	log.Println("Connected to the database of tenant", tenant)
+
+	t.mu.Lock()
+	if database, ok := t.tenants[tenant]; !ok || database.URI != uri {
+		// The tenant was unregistered or moved meanwhile, the connection must not be kept.
+		t.mu.Unlock()
+		go client.Disconnect(context.Background())
+		if !ok {
+			return nil, newError(ErrNotFound, "unknown tenant "+tenant, nil)
+		}
+		return nil, errTenantMoved
+	}
+	defer t.mu.Unlock()
+	if c := t.clients[tenant]; c != nil {
+		// Another request connected first.
+		c.uses++
+		go client.Disconnect(context.Background())
+		return c, nil
+	}
+	if t.clients == nil {
+		t.clients = map[string]*tenantClient{}
+	}
+	c := &tenantClient{client: client, uses: 1}
+	t.clients[tenant] = c
+	return c, nil
+}
+
+// Closes the connections that have not been used for IdleTimeout. acquire calls it, call it on a ticker as well
+// to close connections when there are no requests at all.
+func (t *TenantDatabases) EvictIdle(ctx context.Context) {
+	timeout := t.IdleTimeout
+	if timeout <= 0 {
+		timeout = DefaultTenantIdleTimeout
+	}
+	var idle []*tenantClient
+	t.mu.Lock()
+	for tenant, c := range t.clients {
+		if c.uses == 0 && time.Since(c.lastUsed) > timeout {
+			idle = append(idle, c)
+			delete(t.clients, tenant)
+			log.Println("Closing the idle connection of tenant", tenant)
+		}
+	}
+	t.mu.Unlock()
+	for _, c := range idle {
+		if err := c.client.Disconnect(ctx); err != nil {
+			log.Println("Error closing an idle tenant connection.", err)
+		}
+	}
+}
+
+// Closes every connection to the deployments of the tenants.
+func (t *TenantDatabases) Close(ctx context.Context) error {
+	t.mu.Lock()
+	clients := t.clients
+	t.clients = nil
+	t.mu.Unlock()
+	var errs []error
+	for _, c := range clients {
+		errs = append(errs, c.client.Disconnect(ctx))
+	}
+	return errors.Join(errs...)
+}
+
+// Returns a copy of the app context running against the database.
+func (ctx *Ctx) forDatabase(db *mongo.Database) *Ctx {
+	tenantCtx := *ctx
+	tenantCtx.DB = db
+	tenantCtx.Backend = nil
+	tenantCtx.TenantDatabases = nil
+	return &tenantCtx
+}
+
+// Runs fn with a copy of the app context running against the database of the tenant, for code outside of requests.
+func WithTenant(ctx context.Context, appCtx *Ctx, tenant string, fn func(tenantCtx *Ctx) error) error {
+	if appCtx.TenantDatabases == nil {
+		return errors.New("the app context has no tenant databases")
+	}
+	db, release, err := appCtx.TenantDatabases.acquire(ctx, tenant)
+	if err != nil {
+		return err
+	}
+	defer release()
+	return fn(appCtx.forDatabase(db))
+}
+
+// Returns a copy of the app context running against the database of the tenant of the request, and the function
+// to call when the request is done. A principal can only reach its own tenant, unless the resolver is trusted.
+func routeTenant(appCtx *Ctx, r *http.Request) (*Ctx, func(), error) {
+	tenant := appCtx.TenantDatabases.Resolve(r)
+	if tenant == "" {
+		return nil, nil, newError(ErrBadRequest, "the request doesn't say which tenant it is for", nil)
+	}
+	if !appCtx.TenantDatabases.TrustResolve {
+		// Headers and hosts are up to the client, anyone could pick any tenant with them.
+		principal := PrincipalFrom(r.Context())
+		if principal == nil {
+			return nil, nil, newError(ErrUnauthorized, "log in to reach the tenant "+tenant, nil)
+		}
+		if principal.Tenant != tenant {
+			return nil, nil, newError(ErrForbidden, "you don't belong to the tenant "+tenant, nil)
+		}
+	}
+	db, release, err := appCtx.TenantDatabases.acquire(r.Context(), tenant)
+	if err != nil {
+		return nil, nil, err
+	}
+	return appCtx.forDatabase(db), release, nil
+}
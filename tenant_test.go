@@ -0,0 +1,189 @@
+package grf
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+func TestTenantResolvers(t *testing.T) {
+	withPrincipal := func(r *http.Request) *http.Request {
+		return r.WithContext(ContextWithPrincipal(r.Context(), &Principal{ID: "ada", Tenant: "acme", Claims: map[string]any{"org": "globex"}}))
+	}
+	var tests = []struct {
+		name     string
+		resolver TenantResolver
+		host     string
+		header   string
+		request  func(*http.Request) *http.Request
+		want     string
+	}{
+		{"header", TenantFromHeader("X-Tenant"), "example.com", "acme", nil, "acme"},
+		{"no header", TenantFromHeader("X-Tenant"), "example.com", "", nil, ""},
+		{"subdomain", TenantFromSubdomain("example.com"), "Acme.example.com:8080", "", nil, "acme"},
+		{"no subdomain", TenantFromSubdomain("example.com"), "example.com", "", nil, ""},
+		{"deeper subdomain", TenantFromSubdomain("example.com"), "a.acme.example.com", "", nil, ""},
+		{"other domain", TenantFromSubdomain("example.com"), "acme.example.org", "", nil, ""},
+		{"principal", TenantFromPrincipal(), "example.com", "", withPrincipal, "acme"},
+		{"anonymous", TenantFromPrincipal(), "example.com", "", nil, ""},
+		{"claim", TenantFromClaim("org"), "example.com", "", withPrincipal, "globex"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/", nil)
+			r.Host = tt.host
+			r.Header.Set("X-Tenant", tt.header)
+			if tt.request != nil {
+				r = tt.request(r)
+			}
+			if got := tt.resolver(r); got != tt.want {
+				t.Errorf("got tenant %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTenantDatabases(t *testing.T) {
+	ctx := context.Background()
+	// Connecting doesn't reach the server yet, none is needed.
+	client, err := mongo.Connect(ctx, options.Client().ApplyURI("mongodb://localhost:1"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Disconnect(ctx)
+	tenants := NewTenantDatabases(client, TenantFromHeader("X-Tenant"))
+	tenants.Register("acme", TenantDatabase{})
+	tenants.Register("globex", TenantDatabase{URI: "mongodb://localhost:2", Name: "globex_db"})
+	defer tenants.Close(ctx)
+
+	appCtx := &Ctx{TenantDatabases: tenants}
+	mux := http.NewServeMux()
+	ServeMux(mux).Handle(http.MethodGet, "/db", H{Ctx: appCtx, Fn: func(ctx *Ctx, w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(ctx.DB.Name()))
+	}})
+	var tests = []struct {
+		name      string
+		tenant    string
+		principal *Principal
+		status    int
+		db        string
+	}{
+		{"shared client", "acme", &Principal{ID: "ada", Tenant: "acme"}, http.StatusOK, "acme"},
+		{"own deployment", "globex", &Principal{ID: "bob", Tenant: "globex"}, http.StatusOK, "globex_db"},
+		{"other tenant", "globex", &Principal{ID: "ada", Tenant: "acme"}, http.StatusForbidden, ""},
+		{"anonymous", "acme", nil, http.StatusUnauthorized, ""},
+		{"principal without a tenant", "acme", &Principal{ID: "eve"}, http.StatusForbidden, ""},
+		{"unknown tenant", "initech", &Principal{ID: "joe", Tenant: "initech"}, http.StatusNotFound, ""},
+		{"no tenant", "", nil, http.StatusBadRequest, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/db", nil)
+			req.Header.Set("X-Tenant", tt.tenant)
+			if tt.principal != nil {
+				req = req.WithContext(ContextWithPrincipal(req.Context(), tt.principal))
+			}
+			res := httptest.NewRecorder()
+			mux.ServeHTTP(res, req)
+			if res.Code != tt.status || tt.db != "" && res.Body.String() != tt.db {
+				t.Errorf("status %d, body %q, want %d %q", res.Code, res.Body.String(), tt.status, tt.db)
+			}
+		})
+	}
+	if appCtx.DB != nil {
+		t.Error("routing changed the shared app context")
+	}
+
+	// A trusted resolver takes the tenant from the principal, which may name another one than its Tenant.
+	tenants.Resolve, tenants.TrustResolve = TenantFromClaim("org"), true
+	req := httptest.NewRequest(http.MethodGet, "/db", nil)
+	req = req.WithContext(ContextWithPrincipal(req.Context(), &Principal{ID: "ada", Tenant: "acme", Claims: map[string]any{"org": "globex"}}))
+	res := httptest.NewRecorder()
+	mux.ServeHTTP(res, req)
+	if res.Code != http.StatusOK || res.Body.String() != "globex_db" {
+		t.Errorf("trusted resolver: status %d, body %q", res.Code, res.Body.String())
+	}
+}
+
+func TestTenantConnectionPool(t *testing.T) {
+	ctx := context.Background()
+	tenants := &TenantDatabases{IdleTimeout: time.Hour}
+	tenants.Register("globex", TenantDatabase{URI: "mongodb://localhost:2"})
+	defer tenants.Close(ctx)
+
+	first, releaseFirst, err := tenants.acquire(ctx, "globex")
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, releaseSecond, err := tenants.acquire(ctx, "globex")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if first.Client() != second.Client() {
+		t.Error("the tenant got a second connection")
+	}
+
+	tenants.IdleTimeout = time.Nanosecond
+	releaseFirst()
+	time.Sleep(time.Millisecond)
+	tenants.EvictIdle(ctx)
+	if len(tenants.clients) != 1 {
+		t.Error("a connection in use was closed")
+	}
+	releaseSecond()
+	time.Sleep(time.Millisecond)
+	tenants.EvictIdle(ctx)
+	if len(tenants.clients) != 0 {
+		t.Error("the idle connection was kept")
+	}
+
+	if err := WithTenant(ctx, &Ctx{TenantDatabases: tenants}, "globex", func(tenantCtx *Ctx) error {
+		if tenantCtx.DB.Name() != "globex" {
+			t.Errorf("got database %s", tenantCtx.DB.Name())
+		}
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if err := tenants.Unregister(ctx, "globex"); err != nil {
+		t.Fatal(err)
+	}
+	if got := tenants.Tenants(); len(got) != 0 || len(tenants.clients) != 0 {
+		t.Errorf("tenants %v and %d connections left", got, len(tenants.clients))
+	}
+
+	// A connection opened for a tenant unregistered meanwhile isn't kept.
+	if _, err := tenants.connect(ctx, "globex", "mongodb://localhost:2"); !errors.Is(err, ErrNotFound) || len(tenants.clients) != 0 {
+		t.Errorf("got %v and %d connections", err, len(tenants.clients))
+	}
+
+	// The connection of an unregistered tenant is closed by the last request using it.
+	tenants.Register("globex", TenantDatabase{URI: "mongodb://localhost:2"})
+	db, release, err := tenants.acquire(ctx, "globex")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := tenants.Unregister(ctx, "globex"); err != nil {
+		t.Fatal(err)
+	}
+	release()
+	for i := 0; ; i++ {
+		// The server doesn't exist, the request only answers right away once the client is disconnected.
+		pingCtx, cancel := context.WithTimeout(ctx, 10*time.Millisecond)
+		_, err := db.Client().ListDatabaseNames(pingCtx, bson.D{})
+		cancel()
+		if errors.Is(err, mongo.ErrClientDisconnected) {
+			break
+		}
+		if i == 100 {
+			t.Fatal("the connection of the unregistered tenant was kept open")
+		}
+	}
+}
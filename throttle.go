@@ -0,0 +1,332 @@
+package grf
+
+import (
+	"context"
+	"log"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Rate is how many requests a client may make in a period, like 100 a minute.
+// Clients save up to Burst requests while they are quiet, which they may then make at once.
+type Rate struct {
+	Requests int
+	Per      time.Duration
+	// Defaults to Requests.
+	Burst int
+}
+
+// Reports whether the rate limits anything.
+func (r Rate) limited() bool {
+	return r.Requests > 0 && r.Per > 0
+}
+
+func (r Rate) burst() int {
+	if r.Burst > 0 {
+		return r.Burst
+	}
+	return r.Requests
+}
+
+// Returns how many requests are allowed a second.
+func (r Rate) perSecond() float64 {
+	return float64(r.Requests) / r.Per.Seconds()
+}
+
+// ThrottleKey returns who a request is counted for.
+type ThrottleKey func(r *http.Request) string
+
+// Counts requests by the IP address they come from. Behind a proxy that is the proxy's, unless it sets RemoteAddr.
+func ThrottleByIP() ThrottleKey {
+	return func(r *http.Request) string {
+		host, _, err := net.SplitHostPort(r.RemoteAddr)
+		if err != nil {
+			host = r.RemoteAddr
+		}
+		return "ip:" + host
+	}
+}
+
+// Counts requests by their principal, and anonymous requests by their IP address.
+func ThrottleByUser() ThrottleKey {
+	return func(r *http.Request) string {
+		if principal := PrincipalFrom(r.Context()); principal != nil {
+			return "user:" + principal.ID
+		}
+		return ThrottleByIP()(r)
+	}
+}
+
+// Counts requests by the API key they are made with, see APIKeyAuthenticator, and the others by their principal.
+func ThrottleByAPIKey() ThrottleKey {
+	return func(r *http.Request) string {
+		if principal := PrincipalFrom(r.Context()); principal != nil {
+			if key, ok := principal.Claims["apiKey"].(string); ok {
+				return "key:" + key
+			}
+		}
+		return ThrottleByUser()(r)
+	}
+}
+
+// Throttle limits how often clients may call the routes of a resource, like the throttles of Django REST Framework.
+// Requests over the rate are answered with 429 Too Many Requests and a Retry-After header. Every response tells
+// the client where it stands with the X-RateLimit-Limit, X-RateLimit-Remaining and X-RateLimit-Reset headers,
+// the size of the burst, the requests left in it and the seconds until it is full again.
+// A store that fails lets the requests through.
+type Throttle struct {
+	// The rate of requests without a principal. The zero Rate doesn't limit them.
+	Anonymous Rate
+	// The rate of requests with a principal. The zero Rate doesn't limit them.
+	Authenticated Rate
+	// Defaults to ThrottleByAPIKey.
+	Key ThrottleKey
+	// Where the requests are counted. Defaults to a MemoryThrottleStore shared by every throttle,
+	// use a MongoThrottleStore to share the counts between instances.
+	Store ThrottleStore
+	// Routes throttled with the same scope share their counts. Defaults to the resource, and the action
+	// for WithActionThrottle.
+	Scope string
+}
+
+// Throttles every route of the resource. The routes share the counts of a client.
+func WithThrottle(throttle Throttle) RouteOption {
+	return func(c *routeConfig) {
+		c.throttle = &throttle
+	}
+}
+
+// Throttles the routes of one action, instead of the throttle of WithThrottle. They have counts of their own.
+func WithActionThrottle(action Action, throttle Throttle) RouteOption {
+	return func(c *routeConfig) {
+		if c.actionThrottles == nil {
+			c.actionThrottles = map[Action]*Throttle{}
+		}
+		if throttle.Scope == "" {
+			throttle.Scope = c.resource + "." + string(action)
+		}
+		c.actionThrottles[action] = &throttle
+	}
+}
+
+// Returns the throttle of the routes of the action, nil if there is none.
+func (c *routeConfig) throttleFor(action Action) *Throttle {
+	if throttle, ok := c.actionThrottles[action]; ok {
+		return throttle
+	}
+	return c.throttle
+}
+
+// Returns fn throttled as the options of the action ask for.
+func (c *routeConfig) throttled(action Action, fn func(*Ctx, http.ResponseWriter, *http.Request)) func(*Ctx, http.ResponseWriter, *http.Request) {
+	return func(ctx *Ctx, w http.ResponseWriter, r *http.Request) {
+		if throttle := c.throttleFor(action); throttle != nil && !throttle.allow(w, r, c.resource) {
+			return
+		}
+		fn(ctx, w, r)
+	}
+}
+
+// Counts the request and sets the rate limit headers. Writes the 429 response and reports false when it is over the rate.
+func (t *Throttle) allow(w http.ResponseWriter, r *http.Request, scope string) bool {
+	rate := t.Anonymous
+	if PrincipalFrom(r.Context()) != nil {
+		rate = t.Authenticated
+	}
+	if !rate.limited() {
+		return true
+	}
+	if t.Scope != "" {
+		scope = t.Scope
+	}
+	key := t.Key
+	if key == nil {
+		key = ThrottleByAPIKey()
+	}
+	store := t.Store
+	if store == nil {
+		store = defaultThrottleStore
+	}
+
+	result, err := store.Take(r.Context(), scope+"/"+key(r), rate)
+	if err != nil {
+		log.Println("Error throttling", r.Method, r.URL.Path, err)
+		return true
+	}
+	w.Header().Set("X-RateLimit-Limit", strconv.Itoa(rate.burst()))
+	w.Header().Set("X-RateLimit-Remaining", strconv.Itoa(result.Remaining))
+	w.Header().Set("X-RateLimit-Reset", strconv.Itoa(ceilSeconds(result.Reset)))
+	if result.Allowed {
+		return true
+	}
+	w.Header().Set("Retry-After", strconv.Itoa(ceilSeconds(result.RetryAfter)))
+	WriteError(w, r, newError(ErrTooManyRequests, "request was throttled, try again in "+strconv.Itoa(ceilSeconds(result.RetryAfter))+" seconds", nil))
+	return false
+}
+
+// Rounds the duration up to whole seconds.
+func ceilSeconds(d time.Duration) int {
+	return int(math.Ceil(d.Seconds()))
+}
+
+// ThrottleResult is the outcome of counting a request.
+type ThrottleResult struct {
+	Allowed bool
+	// Requests the client may still make right away.
+	Remaining int
+	// How long until the next request is allowed, for requests that were not.
+	RetryAfter time.Duration
+	// How long until the client may make a full burst again.
+	Reset time.Duration
+}
+
+// ThrottleStore counts the requests of clients with a token bucket per key: a bucket holds up to the burst
+// of the rate, every request takes a token out and the bucket fills up at the rate again.
+type ThrottleStore interface {
+	// Takes a token from the bucket of the key, if there is one.
+	Take(ctx context.Context, key string, rate Rate) (ThrottleResult, error)
+}
+
+// Returns the result of a request to a bucket that has tokens left after refilling.
+func bucketResult(tokens float64, rate Rate) ThrottleResult {
+	result := ThrottleResult{Allowed: tokens >= 1}
+	if result.Allowed {
+		tokens--
+	} else {
+		result.RetryAfter = secondsDuration((1 - tokens) / rate.perSecond())
+	}
+	result.Remaining = int(tokens)
+	result.Reset = secondsDuration((float64(rate.burst()) - tokens) / rate.perSecond())
+	return result
+}
+
+func secondsDuration(seconds float64) time.Duration {
+	return time.Duration(seconds * float64(time.Second))
+}
+
+var defaultThrottleStore = NewMemoryThrottleStore()
+
+// MemoryThrottleStore counts requests in memory, for a single instance.
+type MemoryThrottleStore struct {
+	mu      sync.Mutex
+	buckets map[string]*tokenBucket
+}
+
+type tokenBucket struct {
+	tokens  float64
+	updated time.Time
+	rate    Rate
+}
+
+// Returns the tokens in the bucket by now.
+func (b *tokenBucket) refill(now time.Time) float64 {
+	return math.Min(float64(b.rate.burst()), b.tokens+now.Sub(b.updated).Seconds()*b.rate.perSecond())
+}
+
+// The number of buckets after which the full ones are dropped, they are no different from new ones.
+const memoryThrottleBuckets = 10000
+
+func NewMemoryThrottleStore() *MemoryThrottleStore {
+	return &MemoryThrottleStore{buckets: map[string]*tokenBucket{}}
+}
+
+func (s *MemoryThrottleStore) Take(ctx context.Context, key string, rate Rate) (ThrottleResult, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := time.Now()
+	if len(s.buckets) >= memoryThrottleBuckets {
+		s.dropFull(now)
+	}
+	bucket, ok := s.buckets[key]
+	if !ok {
+		bucket = &tokenBucket{tokens: float64(rate.burst()), updated: now}
+		s.buckets[key] = bucket
+	}
+	bucket.rate = rate
+	bucket.tokens = bucket.refill(now)
+	bucket.updated = now
+	result := bucketResult(bucket.tokens, rate)
+	if result.Allowed {
+		bucket.tokens--
+	}
+	return result, nil
+}
+
+// Drops the buckets that have filled up again by now.
+func (s *MemoryThrottleStore) dropFull(now time.Time) {
+	for key, bucket := range s.buckets {
+		if bucket.refill(now) >= float64(bucket.rate.burst()) {
+			delete(s.buckets, key)
+		}
+	}
+}
+
+// MongoThrottleStore counts requests in a collection of a mongodb database, shared by every instance of the app.
+// Each request is a single atomic update. Buckets expire once they are full again, with a TTL index.
+type MongoThrottleStore struct {
+	DB *mongo.Database
+	// Defaults to "throttles".
+	Collection string
+
+	indexOnce sync.Once
+}
+
+func (s *MongoThrottleStore) Take(ctx context.Context, key string, rate Rate) (ThrottleResult, error) {
+	name := s.Collection
+	if name == "" {
+		name = "throttles"
+	}
+	collection := s.DB.Collection(name)
+	s.indexOnce.Do(func() {
+		_, err := collection.Indexes().CreateOne(ctx, mongo.IndexModel{
+			Keys:    bson.D{{Key: "expiresAt", Value: 1}},
+			Options: options.Index().SetExpireAfterSeconds(0),
+		})
+		if err != nil {
+			log.Println("Error creating the TTL index of the throttles.", err)
+		}
+	})
+
+	// Refills the bucket for the time since the last request, by the clock of the database, and takes a token.
+	burst := float64(rate.burst())
+	perMillisecond := rate.perSecond() / 1000
+	refilled := bson.M{"$min": bson.A{burst, bson.M{"$add": bson.A{
+		bson.M{"$ifNull": bson.A{"$tokens", burst}},
+		bson.M{"$multiply": bson.A{bson.M{"$subtract": bson.A{"$$NOW", bson.M{"$ifNull": bson.A{"$updated", "$$NOW"}}}}, perMillisecond}},
+	}}}}
+	pipeline := mongo.Pipeline{
+		{{Key: "$set", Value: bson.M{"tokens": refilled, "updated": "$$NOW"}}},
+		{{Key: "$set", Value: bson.M{"allowed": bson.M{"$gte": bson.A{"$tokens", 1}}}}},
+		{{Key: "$set", Value: bson.M{
+			"tokens":    bson.M{"$cond": bson.A{"$allowed", bson.M{"$subtract": bson.A{"$tokens", 1}}, "$tokens"}},
+			"expiresAt": bson.M{"$add": bson.A{"$$NOW", int64(burst / perMillisecond)}},
+		}}},
+	}
+	var bucket struct {
+		Tokens  float64 `bson:"tokens"`
+		Allowed bool    `bson:"allowed"`
+	}
+	opts := options.FindOneAndUpdate().SetUpsert(true).SetReturnDocument(options.After)
+	err := collection.FindOneAndUpdate(ctx, bson.M{"_id": key}, pipeline, opts).Decode(&bucket)
+	if mongo.IsDuplicateKeyError(err) {
+		// The first requests of a key race to insert its bucket, the losers update the one that won.
+		err = collection.FindOneAndUpdate(ctx, bson.M{"_id": key}, pipeline, opts).Decode(&bucket)
+	}
+	if err != nil {
+		return ThrottleResult{}, mongoError(err)
+	}
+	tokens := bucket.Tokens
+	if bucket.Allowed {
+		// As the bucket was before the request, bucketResult takes the token itself.
+		tokens++
+	}
+	return bucketResult(tokens, rate), nil
+}
@@ -0,0 +1,124 @@
+package grf
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMemoryThrottleStore(t *testing.T) {
+	ctx := context.Background()
+	store := NewMemoryThrottleStore()
+	rate := Rate{Requests: 1, Per: time.Hour, Burst: 3}
+	var tests = []struct {
+		key       string
+		allowed   bool
+		remaining int
+	}{
+		{"ada", true, 2},
+		{"ada", true, 1},
+		{"grace", true, 2},
+		{"ada", true, 0},
+		{"ada", false, 0},
+	}
+	for i, tt := range tests {
+		result, err := store.Take(ctx, tt.key, rate)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if result.Allowed != tt.allowed || result.Remaining != tt.remaining {
+			t.Errorf("request %d: got %+v, want allowed %v with %d remaining", i, result, tt.allowed, tt.remaining)
+		}
+		if !result.Allowed && (result.RetryAfter < 59*time.Minute || result.RetryAfter > time.Hour) {
+			t.Errorf("request %d: retry after %s, want about an hour", i, result.RetryAfter)
+		}
+	}
+
+	fast := Rate{Requests: 100, Per: time.Second, Burst: 1}
+	store.Take(ctx, "linus", fast)
+	time.Sleep(20 * time.Millisecond)
+	if result, _ := store.Take(ctx, "linus", fast); !result.Allowed {
+		t.Error("the bucket didn't fill up again")
+	}
+}
+
+func TestMongoThrottleStore(t *testing.T) {
+	ctx := context.Background()
+	store := &MongoThrottleStore{DB: db, Collection: "throttles_test"}
+	defer db.Collection("throttles_test").Drop(ctx)
+	rate := Rate{Requests: 1, Per: time.Hour, Burst: 2}
+	var tests = []struct {
+		key       string
+		allowed   bool
+		remaining int
+	}{
+		{"ada", true, 1},
+		{"grace", true, 1},
+		{"ada", true, 0},
+		{"ada", false, 0},
+	}
+	for i, tt := range tests {
+		result, err := store.Take(ctx, tt.key, rate)
+		if err != nil {
+			t.Fatalf("Failed to throttle: %v", err)
+		}
+		if result.Allowed != tt.allowed || result.Remaining != tt.remaining {
+			t.Errorf("Request %d: got %+v, want allowed %v with %d remaining", i, result, tt.allowed, tt.remaining)
+		}
+	}
+}
+
+func TestThrottleRoutes(t *testing.T) {
+	secret := []byte("secret")
+	token, _ := SignJWT(map[string]any{"sub": "ada"}, secret)
+	store := NewMemoryThrottleStore()
+	appCtx := &Ctx{Backend: NewMemoryBackend(), Authenticators: []Authenticator{JWTAuthenticator{Key: secret}}}
+	mux := http.NewServeMux()
+	RegisterCRUDRoutes[Memo]("/memos", ServeMux(mux), appCtx, Public(),
+		WithThrottle(Throttle{
+			Anonymous:     Rate{Requests: 1, Per: time.Hour},
+			Authenticated: Rate{Requests: 2, Per: time.Hour},
+			Store:         store,
+		}),
+		WithActionThrottle(ActionCreate, Throttle{Authenticated: Rate{Requests: 1, Per: time.Minute}, Store: store}))
+
+	var tests = []struct {
+		name       string
+		method     string
+		user       bool
+		ip         string
+		status     int
+		remaining  string
+		retryAfter string
+	}{
+		{"anonymous", http.MethodGet, false, "10.0.0.1", http.StatusOK, "0", ""},
+		{"anonymous again", http.MethodGet, false, "10.0.0.1", http.StatusTooManyRequests, "0", "3600"},
+		{"anonymous elsewhere", http.MethodGet, false, "10.0.0.2", http.StatusOK, "0", ""},
+		{"user", http.MethodGet, true, "10.0.0.1", http.StatusOK, "1", ""},
+		{"user again", http.MethodGet, true, "10.0.0.1", http.StatusOK, "0", ""},
+		{"user once more", http.MethodGet, true, "10.0.0.2", http.StatusTooManyRequests, "0", "1800"},
+		{"user creates", http.MethodPost, true, "10.0.0.1", http.StatusCreated, "0", ""},
+		{"user creates again", http.MethodPost, true, "10.0.0.1", http.StatusTooManyRequests, "0", "60"},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest(tt.method, "/memos/", strings.NewReader(`{"title": "walk the dog"}`))
+		req.RemoteAddr = tt.ip + ":1234"
+		if tt.user {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		res := httptest.NewRecorder()
+		mux.ServeHTTP(res, req)
+		if res.Code != tt.status {
+			t.Fatalf("%s: status %d, want %d", tt.name, res.Code, tt.status)
+		}
+		if got := res.Header().Get("X-RateLimit-Remaining"); got != tt.remaining {
+			t.Errorf("%s: X-RateLimit-Remaining %q, want %q", tt.name, got, tt.remaining)
+		}
+		if got := res.Header().Get("Retry-After"); got != tt.retryAfter {
+			t.Errorf("%s: Retry-After %q, want %q", tt.name, got, tt.retryAfter)
+		}
+	}
+}
@@ -0,0 +1,56 @@
+package grf
+
+import (
+	"context"
+	"time"
+)
+
+// Action is what an operation of the generic services does.
+type Action string
+
+// The actions of the generic services and handlers.
+const (
+	ActionList    Action = "list"
+	ActionRead    Action = "read"
+	ActionCreate  Action = "create"
+	ActionReplace Action = "replace"
+	ActionUpdate  Action = "update"
+	ActionDelete  Action = "delete"
+)
+
+// Timeout of an operation when neither the model nor the app context set one.
+const DefaultTimeout = 2 * time.Second
+
+// Timeouter can be implemented by models to pick the timeout of their operations.
+// Returning 0 falls back to the timeouts of the app context, a negative duration means no limit.
+type Timeouter interface {
+	Timeout(action Action) time.Duration
+}
+
+// Returns how long the action on the model K may take. Zero means no limit.
+func timeoutOf[K any](appCtx *Ctx, action Action) time.Duration {
+	timeout := time.Duration(0)
+	if model, ok := any(new(K)).(Timeouter); ok {
+		timeout = model.Timeout(action)
+	}
+	if timeout == 0 {
+		timeout = appCtx.Timeouts[action]
+	}
+	if timeout == 0 {
+		timeout = appCtx.Timeout
+	}
+	if timeout == 0 {
+		timeout = DefaultTimeout
+	}
+	return max(timeout, 0)
+}
+
+// Derives the context an operation of the generic services runs with from the caller's context.
+// The operation is cancelled with the caller's context, or when its timeout runs out.
+func operationContext[K any](ctx context.Context, appCtx *Ctx, action Action) (context.Context, context.CancelFunc) {
+	timeout := timeoutOf[K](appCtx, action)
+	if timeout == 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, timeout)
+}
@@ -0,0 +1,65 @@
+package grf
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"testing"
+	"time"
+)
+
+// A report that needs longer to be listed.
+type Report struct {
+	Title string `json:"title" bson:"title"`
+}
+
+func (r *Report) Timeout(action Action) time.Duration {
+	if action == ActionList {
+		return time.Minute
+	}
+	return 0
+}
+
+func TestTimeoutOf(t *testing.T) {
+	var tests = []struct {
+		name   string
+		appCtx *Ctx
+		action Action
+		want   time.Duration
+		report bool
+	}{
+		{"default", &Ctx{}, ActionRead, DefaultTimeout, false},
+		{"app context", &Ctx{Timeout: time.Second}, ActionRead, time.Second, false},
+		{"action", &Ctx{Timeout: time.Second, Timeouts: map[Action]time.Duration{ActionRead: 5 * time.Second}}, ActionRead, 5 * time.Second, false},
+		{"other action", &Ctx{Timeout: time.Second, Timeouts: map[Action]time.Duration{ActionList: 5 * time.Second}}, ActionRead, time.Second, false},
+		{"no limit", &Ctx{Timeout: -1}, ActionRead, 0, false},
+		{"model", &Ctx{Timeouts: map[Action]time.Duration{ActionList: 5 * time.Second}}, ActionList, time.Minute, true},
+		{"model falls back", &Ctx{Timeout: time.Second}, ActionRead, time.Second, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := timeoutOf[Memo](tt.appCtx, tt.action)
+			if tt.report {
+				got = timeoutOf[Report](tt.appCtx, tt.action)
+			}
+			if got != tt.want {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCancelledContext(t *testing.T) {
+	db, err := sql.Open("sqlite", ":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	appCtx := &Ctx{Backend: NewSQLBackend(db, SQLite)}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := Create(ctx, appCtx, &Memo{Title: "walk the dog"}); !errors.Is(err, context.Canceled) {
+		t.Errorf("got %v, want context.Canceled", err)
+	}
+}
@@ -0,0 +1,148 @@
+package grf
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// How many times WithTransaction runs a transaction that keeps failing with transient errors.
+var TransactionAttempts = 3
+
+type transactionKey struct{}
+
+// Runs fn in a transaction of the app context's backend.
+// The generic services called with the context passed to fn are part of the transaction. Their changes are committed
+// together when fn returns nil and rolled back when it returns an error, which is returned.
+// A transaction failing with a transient error, like a write conflict with another transaction, is run again
+// up to TransactionAttempts times, so fn must be safe to repeat. Transactions started within fn join this one.
+// On MongoDB, transactions need a replica set.
+func WithTransaction(ctx context.Context, appCtx *Ctx, fn func(ctx context.Context) error) error {
+	if ctx.Value(transactionKey{}) != nil {
+		return fn(ctx)
+	}
+	ctx = context.WithValue(ctx, transactionKey{}, true)
+	for attempt := 1; ; attempt++ {
+		err := appCtx.backend().WithTransaction(ctx, fn)
+		if err == nil || !isTransient(err) || attempt >= TransactionAttempts || ctx.Err() != nil {
+			return err
+		}
+		log.Println("Retrying the transaction after a transient error.", err)
+	}
+}
+
+// Reports whether the transaction that failed with the error can be run again.
+func isTransient(err error) bool {
+	var labeled mongo.LabeledError
+	if errors.As(err, &labeled) && (labeled.HasErrorLabel("TransientTransactionError") || labeled.HasErrorLabel("UnknownTransactionCommitResult")) {
+		return true
+	}
+	return errors.Is(err, ErrTransient)
+}
+
+// Runs the write routes in a transaction, see Transactional. Reads are left alone.
+func WithTransactions() RouteOption {
+	return func(c *routeConfig) {
+		c.transactional = true
+	}
+}
+
+// Transactional runs the handler in a transaction, see WithTransaction. The generic services it calls with the
+// request context are part of it. The transaction is rolled back when the handler responds with an error status
+// and committed otherwise. Handlers failing with a transient error are run again with the same request.
+// The response is held back until the transaction is over.
+func Transactional(appCtx *Ctx, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Kept to replay the request if the transaction is retried.
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			WriteError(w, r, decodeError(err))
+			return
+		}
+
+		var response *bufferedResponse
+		var handlerErr error
+		err = WithTransaction(r.Context(), appCtx, func(ctx context.Context) error {
+			response = &bufferedResponse{header: http.Header{}}
+			failure := &handlerFailure{}
+			attempt := r.WithContext(context.WithValue(ctx, handlerFailureKey{}, failure))
+			attempt.Body = io.NopCloser(bytes.NewReader(body))
+			next.ServeHTTP(response, attempt)
+
+			handlerErr = failure.err
+			if handlerErr == nil && response.status >= http.StatusBadRequest {
+				handlerErr = errors.New("the handler responded with " + http.StatusText(response.status))
+			}
+			return handlerErr
+		})
+		if err != nil && handlerErr == nil {
+			// The handler went through but the transaction could not be committed.
+			WriteError(w, r, err)
+			return
+		}
+		response.writeTo(w)
+	})
+}
+
+// Returns fn running in a transaction of the app context it gets, which is the one of the tenant of the request
+// with TenantDatabases. See Transactional.
+func transactional(fn func(*Ctx, http.ResponseWriter, *http.Request)) func(*Ctx, http.ResponseWriter, *http.Request) {
+	return func(ctx *Ctx, w http.ResponseWriter, r *http.Request) {
+		Transactional(ctx, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			fn(ctx, w, r)
+		})).ServeHTTP(w, r)
+	}
+}
+
+type handlerFailureKey struct{}
+
+// The error a transactional handler responded with, recorded by WriteError.
+type handlerFailure struct {
+	err error
+}
+
+// Records the error a handler responds with for Transactional.
+func recordFailure(r *http.Request, err error) {
+	if failure, ok := r.Context().Value(handlerFailureKey{}).(*handlerFailure); ok {
+		failure.err = err
+	}
+}
+
+// A response held back until it is known whether it is sent.
+type bufferedResponse struct {
+	header http.Header
+	status int
+	body   bytes.Buffer
+}
+
+func (b *bufferedResponse) Header() http.Header {
+	return b.header
+}
+
+func (b *bufferedResponse) WriteHeader(status int) {
+	if b.status == 0 {
+		b.status = status
+	}
+}
+
+func (b *bufferedResponse) Write(data []byte) (int, error) {
+	b.WriteHeader(http.StatusOK)
+	return b.body.Write(data)
+}
+
+// Sends the response.
+func (b *bufferedResponse) writeTo(w http.ResponseWriter) {
+	for key, values := range b.header {
+		w.Header()[key] = values
+	}
+	if b.status == 0 {
+		b.status = http.StatusOK
+	}
+	w.WriteHeader(b.status)
+	w.Write(b.body.Bytes())
+}
@@ -0,0 +1,129 @@
+package grf
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func countMemos(t *testing.T, appCtx *Ctx) int {
+	t.Helper()
+	var memos []Memo
+	if err := Read(context.Background(), appCtx, &memos); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	return len(memos)
+}
+
+func TestWithTransaction(t *testing.T) {
+	failure := errors.New("failure")
+	var tests = []struct {
+		name     string
+		errs     []error
+		want     error
+		attempts int
+		count    int
+	}{
+		{"commit", []error{nil}, nil, 1, 2},
+		{"rollback", []error{failure}, failure, 1, 0},
+		{"retry", []error{newError(ErrTransient, "", nil), nil}, nil, 2, 2},
+		{"give up", []error{newError(ErrTransient, "", nil), newError(ErrTransient, "", nil), newError(ErrTransient, "", nil)}, ErrTransient, 3, 0},
+	}
+	for name := range backendContexts(t) {
+		for _, tt := range tests {
+			t.Run(name+"/"+tt.name, func(t *testing.T) {
+				appCtx := backendContexts(t)[name]
+				attempts := 0
+				err := WithTransaction(context.Background(), appCtx, func(ctx context.Context) error {
+					attempts++
+					for _, title := range []string{"a", "b"} {
+						if err := Create(ctx, appCtx, &Memo{Title: title}); err != nil {
+							return err
+						}
+					}
+					// Nested transactions join this one.
+					return WithTransaction(ctx, appCtx, func(ctx context.Context) error {
+						return tt.errs[attempts-1]
+					})
+				})
+				if !errors.Is(err, tt.want) || tt.want == nil && err != nil {
+					t.Errorf("got %v, want %v", err, tt.want)
+				}
+				if attempts != tt.attempts {
+					t.Errorf("ran %d times, want %d", attempts, tt.attempts)
+				}
+				if got := countMemos(t, appCtx); got != tt.count {
+					t.Errorf("%d memos stored, want %d", got, tt.count)
+				}
+			})
+		}
+	}
+}
+
+func TestTransactional(t *testing.T) {
+	var tests = []struct {
+		name     string
+		errs     []error
+		want     int
+		attempts int
+		count    int
+	}{
+		{"commit", []error{nil}, http.StatusCreated, 1, 1},
+		{"rollback", []error{newError(ErrValidation, "", nil)}, http.StatusUnprocessableEntity, 1, 0},
+		{"retry", []error{newError(ErrTransient, "", nil), nil}, http.StatusCreated, 2, 1},
+	}
+	for name := range backendContexts(t) {
+		for _, tt := range tests {
+			t.Run(name+"/"+tt.name, func(t *testing.T) {
+				appCtx := backendContexts(t)[name]
+				attempts := 0
+				handler := Transactional(appCtx, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+					attempts++
+					body, _ := io.ReadAll(r.Body)
+					if err := Create(r.Context(), appCtx, &Memo{Title: string(body)}); err != nil {
+						WriteError(w, r, err)
+						return
+					}
+					if err := tt.errs[attempts-1]; err != nil {
+						WriteError(w, r, err)
+						return
+					}
+					w.WriteHeader(http.StatusCreated)
+				}))
+				res := httptest.NewRecorder()
+				handler.ServeHTTP(res, httptest.NewRequest(http.MethodPost, "/", strings.NewReader("walk the dog")))
+				if res.Code != tt.want {
+					t.Errorf("status %d, want %d", res.Code, tt.want)
+				}
+				if attempts != tt.attempts {
+					t.Errorf("ran %d times, want %d", attempts, tt.attempts)
+				}
+				var memos []Memo
+				Read(context.Background(), appCtx, &memos)
+				if len(memos) != tt.count || tt.count > 0 && memos[0].Title != "walk the dog" {
+					t.Errorf("got %v stored, want %d memos", memos, tt.count)
+				}
+			})
+		}
+	}
+}
+
+func TestWithTransactionsRouteOption(t *testing.T) {
+	appCtx := &Ctx{Backend: NewMemoryBackend()}
+	mux := http.NewServeMux()
+	RegisterCRUDRoutes[Ticket]("/tickets", ServeMux(mux), appCtx, WithTransactions())
+	res := httptest.NewRecorder()
+	mux.ServeHTTP(res, httptest.NewRequest(http.MethodPost, "/tickets/", strings.NewReader(`{"title": "a"}`)))
+	if res.Code != http.StatusCreated || res.Header().Get("Location") == "" {
+		t.Errorf("status %d, Location %q", res.Code, res.Header().Get("Location"))
+	}
+	res = httptest.NewRecorder()
+	mux.ServeHTTP(res, httptest.NewRequest(http.MethodPost, "/tickets/", strings.NewReader(`{"title": ""}`)))
+	if res.Code != http.StatusUnprocessableEntity {
+		t.Errorf("status %d, want %d", res.Code, http.StatusUnprocessableEntity)
+	}
+}
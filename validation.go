@@ -0,0 +1,299 @@
+package grf
+
+import (
+	"errors"
+	"fmt"
+	"net/mail"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"unicode/utf8"
+)
+
+// Validator can be implemented by models for checks that struct tags can't express.
+// It runs after the struct tag rules. Returning ValidationErrors reports several fields at once.
+type Validator interface {
+	Validate() error
+}
+
+// FieldError describes why a single field failed validation.
+// Field is the JSON path of the field, "address.city" or "items[0].name".
+type FieldError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+// ValidationErrors lists every field that failed validation.
+type ValidationErrors []FieldError
+
+func (v ValidationErrors) Error() string {
+	msgs := make([]string, len(v))
+	for i, e := range v {
+		msgs[i] = e.Message
+		if e.Field != "" {
+			msgs[i] = e.Field + ": " + e.Message
+		}
+	}
+	return strings.Join(msgs, "; ")
+}
+
+// Validates the object against the rules in its grf struct tags and its Validate method.
+//
+//	Title string `json:"title" grf:"required,min=3,max=200"`
+//	State string `json:"state" grf:"enum=open|closed"`
+//	Email string `json:"email" grf:"email"`
+//	Code  string `json:"code" grf:"regex=^[A-Z]{3}$"`
+//
+// min and max bound the length of strings, slices and maps and the value of numbers.
+// Empty values only fail the required rule. A regex rule must come last in the tag.
+// The returned error is an ErrValidation carrying ValidationErrors.
+func Validate(object any) error {
+	value := reflect.ValueOf(object)
+	var errs ValidationErrors
+	validateStruct(reflect.Indirect(value), "", &errs)
+
+	if validator, ok := object.(Validator); ok {
+		if err := validator.Validate(); err != nil {
+			var fieldErrors ValidationErrors
+			if errors.As(err, &fieldErrors) {
+				errs = append(errs, fieldErrors...)
+			} else {
+				errs = append(errs, FieldError{Message: err.Error()})
+			}
+		}
+	}
+
+	if len(errs) > 0 {
+		return newError(ErrValidation, "", errs)
+	}
+	return nil
+}
+
+func validateStruct(value reflect.Value, prefix string, errs *ValidationErrors) {
+	if value.Kind() != reflect.Struct {
+		return
+	}
+	for _, field := range modelOf(value.Type()).Fields {
+		validateValue(value.FieldByIndex(field.Index), field.Options, prefix+field.JSONName, errs)
+	}
+}
+
+var validationRules = []string{"min", "max", "enum", "regex", "email"}
+
+func validateValue(value reflect.Value, rules TagOptions, path string, errs *ValidationErrors) {
+	fail := func(format string, args ...any) {
+		*errs = append(*errs, FieldError{Field: path, Message: fmt.Sprintf(format, args...)})
+	}
+
+	if value.IsZero() {
+		if rules.Has("required") {
+			fail("is required")
+			return
+		}
+		// Empty strings, slices, pointers and structs skip the other rules, numbers still have to be in range.
+		if !isNumber(value.Kind()) {
+			return
+		}
+	}
+	value = reflect.Indirect(value)
+
+	for _, rule := range validationRules {
+		arg, ok := rules.Get(rule)
+		if !ok {
+			continue
+		}
+		switch rule {
+		case "min", "max":
+			limit, err := strconv.ParseFloat(arg, 64)
+			if err != nil {
+				fail("has an invalid %s rule %q", rule, arg)
+				continue
+			}
+			size, unit, ok := measure(value)
+			if !ok {
+				continue
+			}
+			if rule == "min" && size < limit {
+				fail("must be at least %s%s", arg, unit)
+			}
+			if rule == "max" && size > limit {
+				fail("must be at most %s%s", arg, unit)
+			}
+		case "enum":
+			allowed := strings.Split(arg, "|")
+			if !containsString(allowed, fmt.Sprint(value.Interface())) {
+				fail("must be one of %s", strings.Join(allowed, ", "))
+			}
+		case "regex":
+			pattern, err := compileRule(arg)
+			if err != nil {
+				fail("has an invalid regex rule %q", arg)
+				continue
+			}
+			if value.Kind() == reflect.String && !pattern.MatchString(value.String()) {
+				fail("must match %s", arg)
+			}
+		case "email":
+			if value.Kind() == reflect.String {
+				address, err := mail.ParseAddress(value.String())
+				if err != nil || address.Address != value.String() {
+					fail("must be a valid email address")
+				}
+			}
+		}
+	}
+
+	switch value.Kind() {
+	case reflect.Struct:
+		if isNestedStruct(value.Type()) {
+			validateStruct(value, path+".", errs)
+		}
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < value.Len(); i++ {
+			item := reflect.Indirect(value.Index(i))
+			if item.Kind() == reflect.Struct && isNestedStruct(item.Type()) {
+				validateStruct(item, fmt.Sprintf("%s[%d].", path, i), errs)
+			}
+		}
+	}
+}
+
+// Returns the size min and max compare against and the unit to report it in.
+func measure(value reflect.Value) (float64, string, bool) {
+	switch value.Kind() {
+	case reflect.String:
+		return float64(utf8.RuneCountInString(value.String())), " characters long", true
+	case reflect.Slice, reflect.Array, reflect.Map:
+		return float64(value.Len()), " items long", true
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(value.Int()), "", true
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return float64(value.Uint()), "", true
+	case reflect.Float32, reflect.Float64:
+		return value.Float(), "", true
+	}
+	return 0, "", false
+}
+
+func containsString(values []string, s string) bool {
+	for _, v := range values {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+var ruleRegexps sync.Map // string -> *regexp.Regexp
+
+func compileRule(pattern string) (*regexp.Regexp, error) {
+	if re, ok := ruleRegexps.Load(pattern); ok {
+		return re.(*regexp.Regexp), nil
+	}
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, err
+	}
+	ruleRegexps.Store(pattern, re)
+	return re, nil
+}
+
+// Validates the fields a patch changes against their struct tag rules.
+// Rules spanning the whole object, like the Validate method, can't be checked without reading it first.
+func validatePatch(model *Model, patch Patch) error {
+	var errs ValidationErrors
+	for path, value := range patch.Set {
+		field, jsonPath := fieldByPath(model, path)
+		if field != nil {
+			validateValue(reflect.ValueOf(value), field.Options, jsonPath, &errs)
+		}
+	}
+	for _, path := range patch.Unset {
+		field, jsonPath := fieldByPath(model, path)
+		if field != nil && field.Options.Has("required") {
+			errs = append(errs, FieldError{Field: jsonPath, Message: "is required"})
+		}
+	}
+	for from, to := range patch.Rename {
+		source, sourcePath := fieldByPath(model, from)
+		if source != nil && source.Options.Has("required") {
+			errs = append(errs, FieldError{Field: sourcePath, Message: "is required"})
+		}
+		// The moved value is not known, it only passes the rules of the destination if they are the ones it was checked against.
+		field, jsonPath := fieldByPath(model, to)
+		if field != nil && !sameRules(source, field) {
+			errs = append(errs, FieldError{Field: jsonPath, Message: "has other rules than " + sourcePath + " and can't be moved into"})
+		}
+	}
+	for path, values := range patch.Push {
+		field, jsonPath := fieldByPath(model, path)
+		if field == nil {
+			continue
+		}
+		// The length after appending depends on the stored array.
+		if field.Options.Has("min") || field.Options.Has("max") {
+			errs = append(errs, FieldError{Field: jsonPath, Message: "has a length rule, replace it instead of appending to it"})
+		}
+		for _, value := range values {
+			item := reflect.Indirect(reflect.ValueOf(value))
+			if item.Kind() == reflect.Struct && isNestedStruct(item.Type()) {
+				validateStruct(item, jsonPath+"[-].", &errs)
+			}
+		}
+	}
+	if len(errs) > 0 {
+		return newError(ErrValidation, "", errs)
+	}
+	return nil
+}
+
+// Reports whether both fields have the same validation rules. A nil field has none.
+func sameRules(a, b *Field) bool {
+	var rulesA, rulesB TagOptions
+	if a != nil {
+		rulesA = a.Options
+	}
+	if b != nil {
+		rulesB = b.Options
+	}
+	if rulesA.Has("required") != rulesB.Has("required") {
+		return false
+	}
+	for _, rule := range validationRules {
+		argA, okA := rulesA.Get(rule)
+		argB, okB := rulesB.Get(rule)
+		if okA != okB || argA != argB {
+			return false
+		}
+	}
+	return true
+}
+
+// Resolves a dotted bson path to its field and JSON path.
+// Array indexes in the path are kept in the JSON path but don't change the field.
+func fieldByPath(model *Model, path string) (*Field, string) {
+	var field *Field
+	var jsonPath []string
+	segments := strings.Split(path, ".")
+	for i, segment := range segments {
+		if _, err := strconv.Atoi(segment); err == nil && field != nil {
+			if i == len(segments)-1 {
+				// A single array element, the rules of the field apply to the whole array.
+				return nil, ""
+			}
+			jsonPath[len(jsonPath)-1] += "[" + segment + "]"
+			continue
+		}
+		if field != nil {
+			model = modelOf(field.Type)
+		}
+		field = model.FieldByBSON(segment)
+		if field == nil {
+			return nil, ""
+		}
+		jsonPath = append(jsonPath, field.JSONName)
+	}
+	return field, strings.Join(jsonPath, ".")
+}
@@ -0,0 +1,140 @@
+package grf
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+type Item struct {
+	Name string `json:"name" bson:"name" grf:"required"`
+}
+
+type Order struct {
+	Title    string  `json:"title" bson:"title" grf:"required,min=3,max=10"`
+	Status   string  `json:"status" bson:"status" grf:"enum=open|closed"`
+	Email    string  `json:"email" bson:"email" grf:"email"`
+	Code     string  `json:"code" bson:"code" grf:"regex=^[A-Z]{2,3}$"`
+	Quantity int     `json:"quantity" bson:"quantity" grf:"min=1,max=100"`
+	Items    []Item  `json:"items" bson:"items" grf:"max=2"`
+	Note     *string `json:"note" bson:"note" grf:"min=2"`
+}
+
+func (o Order) Validate() error {
+	if o.Status == "closed" && len(o.Items) == 0 {
+		return ValidationErrors{{Field: "items", Message: "closed orders need items"}}
+	}
+	return nil
+}
+
+func TestValidateValidObject(t *testing.T) {
+	order := Order{Title: "Groceries", Status: "open", Email: "ann@example.com", Code: "AB", Quantity: 3}
+	if err := Validate(&order); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+func TestValidateReportsEveryField(t *testing.T) {
+	short := "x"
+	order := Order{
+		Title:    "",
+		Status:   "closed",
+		Email:    "not an email",
+		Code:     "abc",
+		Quantity: 0,
+		Items:    nil,
+		Note:     &short,
+	}
+	err := Validate(&order)
+	if !errors.Is(err, ErrValidation) {
+		t.Fatalf("expected a validation error, got %v", err)
+	}
+	var errs ValidationErrors
+	errors.As(err, &errs)
+	var fields []string
+	for _, e := range errs {
+		fields = append(fields, e.Field)
+	}
+	want := []string{"title", "email", "code", "quantity", "note", "items"}
+	if !reflect.DeepEqual(fields, want) {
+		t.Errorf("got failing fields %v, want %v", fields, want)
+	}
+}
+
+func TestValidateNestedPaths(t *testing.T) {
+	order := Order{Title: "Groceries", Quantity: 1, Items: []Item{{Name: "milk"}, {}, {}}}
+	var errs ValidationErrors
+	errors.As(Validate(&order), &errs)
+	var fields []string
+	for _, e := range errs {
+		fields = append(fields, e.Field)
+	}
+	want := []string{"items", "items[1].name", "items[2].name"}
+	if !reflect.DeepEqual(fields, want) {
+		t.Errorf("got failing fields %v, want %v", fields, want)
+	}
+}
+
+func TestValidatePatch(t *testing.T) {
+	patch, err := ParseMergePatch[Order]([]byte(`{"title": "ab", "status": null, "quantity": 500}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	patch.Unset = append(patch.Unset, "title")
+	err = validatePatch(getModel[Order](), patch)
+	var errs ValidationErrors
+	if !errors.As(err, &errs) || len(errs) != 3 {
+		t.Fatalf("expected three field errors, got %v", err)
+	}
+}
+
+func TestValidateJSONPatch(t *testing.T) {
+	var tests = []struct {
+		name  string
+		patch string
+		want  []string
+	}{
+		{"move out of a required field", `[{"op": "move", "from": "/title", "path": "/email"}]`, []string{"title", "email"}},
+		{"move into a field with other rules", `[{"op": "move", "from": "/email", "path": "/code"}]`, []string{"code"}},
+		{"append to a field with a length rule", `[{"op": "add", "path": "/items/-", "value": {"name": "milk"}}]`, []string{"items"}},
+		{"append an invalid item", `[{"op": "add", "path": "/items/-", "value": {}}]`, []string{"items", "items[-].name"}},
+		{"replace", `[{"op": "replace", "path": "/quantity", "value": 5}]`, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			patch, err := ParseJSONPatch[Order]([]byte(tt.patch))
+			if err != nil {
+				t.Fatal(err)
+			}
+			var errs ValidationErrors
+			errors.As(validatePatch(getModel[Order](), patch), &errs)
+			var fields []string
+			for _, e := range errs {
+				fields = append(fields, e.Field)
+			}
+			if !reflect.DeepEqual(fields, tt.want) {
+				t.Errorf("got failing fields %v, want %v", fields, tt.want)
+			}
+		})
+	}
+}
+
+func TestWriteErrorListsFields(t *testing.T) {
+	res := httptest.NewRecorder()
+	req := httptest.NewRequest("POST", "/orders/", nil)
+	WriteError(res, req, Validate(&Order{Quantity: 1}))
+
+	if res.Code != http.StatusUnprocessableEntity {
+		t.Fatalf("Status is %d. Expected: %d", res.Code, http.StatusUnprocessableEntity)
+	}
+	var problem Problem
+	if err := json.Unmarshal(res.Body.Bytes(), &problem); err != nil {
+		t.Fatal(err)
+	}
+	if len(problem.Errors) != 1 || problem.Errors[0].Field != "title" {
+		t.Errorf("got errors %v, want one for title", problem.Errors)
+	}
+}
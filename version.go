@@ -0,0 +1,152 @@
+package grf
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// Versions let clients change objects without clobbering each other's changes.
+// Tag an integer field with `grf:"version"`:
+//
+//	Version int64 `json:"version" bson:"version" grf:"version"`
+//
+// Create sets it to 1 and every change increments it. The field is managed by grf like the audit fields.
+// The ETag of an object is its version, or a hash of its content for models without a version field.
+// Replacing or deleting an object with If-Match only succeeds while its ETag is still one of the given ones,
+// otherwise it fails with ErrPreconditionFailed.
+
+// Returns the version field of the model, nil for models without one.
+func versionField(model *Model) *Field {
+	field := model.FieldWithOption("version")
+	if field != nil && !isIntegerID(field) {
+		panic("grf: the version field " + model.Name + "." + field.Name + " must be an integer")
+	}
+	return field
+}
+
+// Returns the version of object, a pointer to a model with a version field.
+func versionOf(field *Field, object any) int64 {
+	value := reflect.Indirect(reflect.ValueOf(object).Elem().FieldByIndex(field.Index))
+	if !value.IsValid() {
+		return 0
+	}
+	if value.CanInt() {
+		return value.Int()
+	}
+	return int64(value.Uint())
+}
+
+// Sets the version of object, a pointer to a model with a version field.
+func setVersion(field *Field, object any, version int64) {
+	target := reflect.ValueOf(object).Elem().FieldByIndex(field.Index)
+	if target.Kind() == reflect.Pointer {
+		target.Set(reflect.New(target.Type().Elem()))
+		target = target.Elem()
+	}
+	if target.CanInt() {
+		target.SetInt(version)
+	} else {
+		target.SetUint(uint64(version))
+	}
+}
+
+// Returns the strong ETag of object, a pointer to a model. It is the quoted version for models with
+// a version field and a hash of the json of the object for the others.
+func ETag(object any) string {
+	if field := versionField(modelOf(reflect.TypeOf(object))); field != nil {
+		return strconv.Quote(strconv.FormatInt(versionOf(field, object), 10))
+	}
+	data, err := json.Marshal(object)
+	if err != nil {
+		return ""
+	}
+	return contentETag(data)
+}
+
+// Reports whether an If-Match header matches the ETag. Weak ETags never match, see RFC 9110.
+func etagMatches(ifMatch, etag string) bool {
+	for _, candidate := range strings.Split(ifMatch, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" || candidate == etag && etag != "" {
+			return true
+		}
+	}
+	return false
+}
+
+// Returns the condition holding while the object is still at the version of stored.
+func versionCondition(field *Field, stored any) Condition {
+	version := versionOf(field, stored)
+	if version == 0 {
+		// Stored before the model had a version.
+		return Condition{Field: field.BSONName, Op: OpIn, Value: []any{nil, int64(0)}}
+	}
+	return Condition{Field: field.BSONName, Op: OpEq, Value: version}
+}
+
+// Returns the error for an object that changed between reading and writing it.
+// It is a failed precondition if the client asked for a version, a conflict otherwise.
+func changedConcurrently(ifMatch string) error {
+	if ifMatch != "" {
+		return newError(ErrPreconditionFailed, "the object was changed in the meantime", nil)
+	}
+	return newError(ErrConflict, "the object was changed in the meantime", nil)
+}
+
+// Checks the stored object against an If-Match header. An empty header matches anything.
+// Models without a version are compared as clients read them, after their AfterRead hook.
+func checkIfMatch(ctx context.Context, appCtx *Ctx, stored any, ifMatch string) error {
+	if ifMatch == "" {
+		return nil
+	}
+	if versionField(modelOf(reflect.TypeOf(stored))) == nil {
+		// On a copy, the stored object itself is passed on to the other hooks.
+		read := reflect.New(reflect.TypeOf(stored).Elem())
+		read.Elem().Set(reflect.ValueOf(stored).Elem())
+		stored = read.Interface()
+		if err := afterRead(ctx, appCtx, stored); err != nil {
+			return err
+		}
+	}
+	if !etagMatches(ifMatch, ETag(stored)) {
+		return newError(ErrPreconditionFailed, "the object was changed in the meantime", nil)
+	}
+	return nil
+}
+
+// Replaces the object with the given id if it is still at the given version.
+// Fails with ErrPreconditionFailed when the stored object is at another version. The model needs a version field.
+func ReplaceOneIfVersion[K any](ctx context.Context, appCtx *Ctx, object *K, id string, version int64) error {
+	filter, err := idFilter[K](id)
+	if err != nil {
+		return err
+	}
+	if err := requireVersion[K](); err != nil {
+		return err
+	}
+	return replaceOne(ctx, appCtx, object, filter, strconv.Quote(strconv.FormatInt(version, 10)))
+}
+
+// Deletes the object with the given id if it is still at the given version.
+// Fails with ErrPreconditionFailed when the stored object is at another version. The model needs a version field.
+func DeleteIfVersion[K any](ctx context.Context, appCtx *Ctx, id string, version int64) error {
+	filter, err := idFilter[K](id)
+	if err != nil {
+		return err
+	}
+	if err := requireVersion[K](); err != nil {
+		return err
+	}
+	return deleteOne[K](ctx, appCtx, filter, strconv.Quote(strconv.FormatInt(version, 10)))
+}
+
+func requireVersion[K any]() error {
+	if model := getModel[K](); versionField(model) == nil {
+		return fmt.Errorf("%s has no version field", model.Name)
+	}
+	return nil
+}
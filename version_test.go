@@ -0,0 +1,121 @@
+package grf
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type Draft struct {
+	Id      primitive.ObjectID `json:"id,omitempty" bson:"_id,omitempty"`
+	Title   string             `json:"title" bson:"title"`
+	Version int64              `json:"version" bson:"version" grf:"version"`
+}
+
+func TestIfMatch(t *testing.T) {
+	var tests = []struct {
+		method  string
+		ifMatch string
+		body    string
+		want    int
+		etag    string
+	}{
+		{http.MethodGet, "", "", http.StatusOK, `"1"`},
+		{http.MethodPut, `"1"`, `{"title": "b", "version": 7}`, http.StatusOK, `"2"`},
+		{http.MethodPut, `"1"`, `{"title": "c"}`, http.StatusPreconditionFailed, ""},
+		{http.MethodPut, `W/"2"`, `{"title": "c"}`, http.StatusPreconditionFailed, ""},
+		{http.MethodPut, `"5", "2"`, `{"title": "c"}`, http.StatusOK, `"3"`},
+		{http.MethodPut, "", `{"title": "d"}`, http.StatusOK, `"4"`},
+		{http.MethodPatch, "", `{"title": "e"}`, http.StatusOK, `"5"`},
+		{http.MethodDelete, `"4"`, "", http.StatusPreconditionFailed, ""},
+		{http.MethodGet, "", "", http.StatusOK, `"5"`},
+		{http.MethodDelete, `"5"`, "", http.StatusNoContent, ""},
+		{http.MethodPut, "*", `{"title": "f"}`, http.StatusNotFound, ""},
+	}
+	for name, appCtx := range backendContexts(t) {
+		t.Run(name, func(t *testing.T) {
+			mux := http.NewServeMux()
+			RegisterCRUDRoutes[Draft]("/drafts", ServeMux(mux), appCtx)
+			res := httptest.NewRecorder()
+			mux.ServeHTTP(res, httptest.NewRequest(http.MethodPost, "/drafts/", strings.NewReader(`{"title": "a", "version": 7}`)))
+			if res.Code != http.StatusCreated || res.Header().Get("ETag") != `"1"` {
+				t.Fatalf("create: status %d, ETag %s", res.Code, res.Header().Get("ETag"))
+			}
+			location := res.Header().Get("Location")
+
+			for _, tt := range tests {
+				req := httptest.NewRequest(tt.method, location, strings.NewReader(tt.body))
+				if tt.ifMatch != "" {
+					req.Header.Set("If-Match", tt.ifMatch)
+				}
+				res := httptest.NewRecorder()
+				mux.ServeHTTP(res, req)
+				if res.Code != tt.want {
+					t.Fatalf("%s If-Match %s: status %d, want %d, body %s", tt.method, tt.ifMatch, res.Code, tt.want, res.Body.String())
+				}
+				if tt.etag != "" && res.Header().Get("ETag") != tt.etag {
+					t.Fatalf("%s If-Match %s: ETag %s, want %s", tt.method, tt.ifMatch, res.Header().Get("ETag"), tt.etag)
+				}
+			}
+		})
+	}
+}
+
+func TestIfMatchContentHash(t *testing.T) {
+	for name, appCtx := range backendContexts(t) {
+		t.Run(name, func(t *testing.T) {
+			mux := http.NewServeMux()
+			RegisterCRUDRoutes[Memo]("/memos", ServeMux(mux), appCtx)
+			res := httptest.NewRecorder()
+			mux.ServeHTTP(res, httptest.NewRequest(http.MethodPost, "/memos/", strings.NewReader(`{"title": "a"}`)))
+			location := res.Header().Get("Location")
+
+			res = httptest.NewRecorder()
+			mux.ServeHTTP(res, httptest.NewRequest(http.MethodGet, location, nil))
+			etag := res.Header().Get("ETag")
+			if etag == "" {
+				t.Fatal("GET did not send an ETag")
+			}
+
+			for _, want := range []int{http.StatusOK, http.StatusPreconditionFailed} {
+				req := httptest.NewRequest(http.MethodPut, location, strings.NewReader(`{"title": "b"}`))
+				req.Header.Set("If-Match", etag)
+				res = httptest.NewRecorder()
+				mux.ServeHTTP(res, req)
+				if res.Code != want {
+					t.Errorf("PUT: status %d, want %d", res.Code, want)
+				}
+			}
+		})
+	}
+}
+
+func TestReplaceOneIfVersion(t *testing.T) {
+	ctx := context.Background()
+	appCtx := &Ctx{Backend: NewMemoryBackend()}
+	draft := Draft{Title: "a"}
+	if err := Create(ctx, appCtx, &draft); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	id := draft.Id.Hex()
+	if err := ReplaceOneIfVersion(ctx, appCtx, &Draft{Title: "b"}, id, 1); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := ReplaceOneIfVersion(ctx, appCtx, &Draft{Title: "c"}, id, 1); !errors.Is(err, ErrPreconditionFailed) {
+		t.Errorf("got %v, want ErrPreconditionFailed", err)
+	}
+	if err := DeleteIfVersion[Draft](ctx, appCtx, id, 1); !errors.Is(err, ErrPreconditionFailed) {
+		t.Errorf("got %v, want ErrPreconditionFailed", err)
+	}
+	if err := DeleteIfVersion[Draft](ctx, appCtx, id, 2); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if err := ReplaceOneIfVersion(ctx, appCtx, &Memo{Title: "d"}, primitive.NewObjectID().Hex(), 1); err == nil {
+		t.Error("replacing a model without a version field by version did not fail")
+	}
+}